@@ -0,0 +1,182 @@
+// Package admin manages the players and games in the state file of a stopped
+// server.
+package admin
+
+import (
+	"bufio"
+	"fmt"
+	"golang_battleship/api"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"golang_battleship/store"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// actions are the admin subcommands by object and action, mutating actions
+// save the state file afterwards.
+var actions = map[string]map[string]struct {
+	args    int
+	mutates bool
+	run     func(args []string, in *bufio.Reader, out io.Writer) error
+}{
+	"players": {
+		"list":           {0, false, listPlayers},
+		"create":         {1, true, createPlayer},
+		"reset-password": {1, true, resetPassword},
+		"delete":         {1, true, deletePlayer},
+		"promote":        {1, true, promotePlayer},
+		"demote":         {1, true, demotePlayer},
+	},
+	"games": {
+		"list":   {0, false, listGames},
+		"delete": {1, true, deleteGame},
+	},
+}
+
+// Run runs the admin subcommand in args against stateFile. The server saves
+// its state on shutdown, so it has to be stopped meanwhile. Passwords are
+// read from in, one per line.
+func Run(stateFile string, args []string, in io.Reader, out io.Writer) error {
+	if len(stateFile) == 0 {
+		return fmt.Errorf("admin needs a state file, set -state-file")
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("usage: admin players list|create|reset-password|delete|promote|demote [name], admin games list|delete [id]")
+	}
+	objectActions, ok := actions[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown admin object %s, expected players or games", args[0])
+	}
+	action, ok := objectActions[args[1]]
+	if !ok {
+		return fmt.Errorf("unknown action %s for %s", args[1], args[0])
+	}
+	if len(args)-2 != action.args {
+		return fmt.Errorf("%s %s takes %d arguments, got %d", args[0], args[1], action.args, len(args)-2)
+	}
+	if err := store.Load(stateFile); err != nil {
+		return err
+	}
+	if err := action.run(args[2:], bufio.NewReader(in), out); err != nil {
+		return err
+	}
+	if action.mutates {
+		return store.Save(stateFile)
+	}
+	return nil
+}
+
+func readPassword(in *bufio.Reader) (string, error) {
+	line, err := in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if err := api.PasswordRequirements.Validate(password); err != nil {
+		return "", err
+	}
+	return api.HashPassword(password)
+}
+
+func listPlayers(args []string, in *bufio.Reader, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tREGISTERED\tWINS\tLOSSES\tMODERATOR")
+	for _, p := range player.AllPlayersList {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%t\n", p.Name, p.ID, p.RegistrationDate.Format("2006-01-02"), p.Wins, p.Losses, p.Moderator)
+	}
+	return w.Flush()
+}
+
+func createPlayer(args []string, in *bufio.Reader, out io.Writer) error {
+	hash, err := readPassword(in)
+	if err != nil {
+		return err
+	}
+	p, err := player.NewPlayer(args[0], hash)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "created player %s (%s)\n", p.Name, p.ID)
+	return nil
+}
+
+func resetPassword(args []string, in *bufio.Reader, out io.Writer) error {
+	p, ok := player.AllPlayersMap[args[0]]
+	if !ok {
+		return fmt.Errorf("no player with name \"%s\" found", args[0])
+	}
+	hash, err := readPassword(in)
+	if err != nil {
+		return err
+	}
+	p.SetPasswordHash(hash)
+	fmt.Fprintf(out, "reset password of player %s\n", p.Name)
+	return nil
+}
+
+func deletePlayer(args []string, in *bufio.Reader, out io.Writer) error {
+	if _, err := player.DeletePlayer(args[0]); err != nil {
+		return err
+	}
+	game.RemovePlayer(args[0])
+	fmt.Fprintf(out, "deleted player %s\n", args[0])
+	return nil
+}
+
+// promotePlayer makes a player moderator of the chat of all games.
+func promotePlayer(args []string, in *bufio.Reader, out io.Writer) error {
+	return setModerator(args[0], true, out)
+}
+
+func demotePlayer(args []string, in *bufio.Reader, out io.Writer) error {
+	return setModerator(args[0], false, out)
+}
+
+func setModerator(name string, moderator bool, out io.Writer) error {
+	p, ok := player.AllPlayersMap[name]
+	if !ok {
+		return fmt.Errorf("no player with name \"%s\" found", name)
+	}
+	p.Moderator = moderator
+	if moderator {
+		fmt.Fprintf(out, "promoted player %s to moderator\n", p.Name)
+	} else {
+		fmt.Fprintf(out, "demoted player %s from moderator\n", p.Name)
+	}
+	return nil
+}
+
+func listGames(args []string, in *bufio.Reader, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tCREATED\tDESCRIPTION\tPARTICIPANTS")
+	for _, g := range game.AllGames {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", g.ID, stateName(g.State), g.CreationDate.Format("2006-01-02 15:04"), g.Description, strings.Join(g.ListParticipants(), ","))
+	}
+	return w.Flush()
+}
+
+func stateName(state game.GameState) string {
+	for name, s := range game.GameStateMap {
+		if s == state {
+			return name
+		}
+	}
+	return fmt.Sprint(int(state))
+}
+
+func deleteGame(args []string, in *bufio.Reader, out io.Writer) error {
+	g, err := game.GetByUUID(args[0])
+	if err != nil {
+		return err
+	}
+	mu := g.Mutex()
+	mu.Lock()
+	defer mu.Unlock()
+	if err := game.DeleteByUUID(g.ID.String()); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "deleted game %s\n", args[0])
+	return nil
+}
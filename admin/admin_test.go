@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"bytes"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAdmin(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	admin := func(password string, args ...string) (string, error) {
+		var out bytes.Buffer
+		err := Run(stateFile, args, strings.NewReader(password), &out)
+		return out.String(), err
+	}
+
+	if _, err := admin("short\n", "players", "create", "Giorno"); err == nil {
+		t.Errorf("password violating the policy was accepted")
+	}
+	if _, err := admin("goldexperience\n", "players", "create", "Giorno"); err != nil {
+		t.Fatalf("failed to create player: %s", err)
+	}
+	if _, err := admin("stickyfingers\n", "players", "create", "Bruno"); err != nil {
+		t.Fatalf("failed to create player: %s", err)
+	}
+	if _, err := admin("goldexperience\n", "players", "create", "Giorno"); err == nil {
+		t.Errorf("duplicate player was created")
+	}
+	out, err := admin("", "players", "list")
+	if err != nil || !strings.Contains(out, "Giorno") || !strings.Contains(out, "Bruno") {
+		t.Errorf("expected both players listed, got %s, %v", out, err)
+	}
+
+	if _, err := admin("requiem1234\n", "players", "reset-password", "Giorno"); err != nil {
+		t.Fatalf("failed to reset password: %s", err)
+	}
+	player.AllPlayersMap = player.PlayerMap{}
+	player.AllPlayersList = player.PlayerList{}
+	if _, err := admin("", "players", "list"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := player.GetByName("Giorno")
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(p.PasswordHash), []byte("requiem1234")) != nil {
+		t.Errorf("password reset wasn't saved")
+	}
+	if _, err := admin("", "players", "promote", "Giorno"); err != nil {
+		t.Fatalf("failed to promote player: %s", err)
+	}
+	player.AllPlayersMap = player.PlayerMap{}
+	player.AllPlayersList = player.PlayerList{}
+	admin("", "players", "list")
+	if p, _ := player.GetByName("Giorno"); !p.Moderator {
+		t.Errorf("moderator flag wasn't saved")
+	}
+
+	g, _ := game.NewGame(12, 12, 2, "Passione", 2, "Giorno", "Bruno")
+	if _, err := admin("", "players", "delete", "Bruno"); err != nil {
+		t.Fatalf("failed to delete player: %s", err)
+	}
+	out, _ = admin("", "players", "list")
+	if strings.Contains(out, "Bruno") {
+		t.Errorf("deleted player still listed: %s", out)
+	}
+	out, _ = admin("", "games", "list")
+	if !strings.Contains(out, g.ID.String()) || strings.Contains(out, "Bruno") {
+		t.Errorf("expected game without Bruno, got %s", out)
+	}
+	if _, err := admin("", "games", "delete", g.ID.String()); err != nil {
+		t.Fatalf("failed to delete game: %s", err)
+	}
+	if _, err := admin("", "games", "delete", g.ID.String()); err == nil {
+		t.Errorf("deleting a missing game succeeded")
+	}
+
+	for _, args := range [][]string{{}, {"players"}, {"teams", "list"}, {"players", "rename", "Giorno"}, {"players", "delete"}} {
+		if _, err := admin("", args...); err == nil {
+			t.Errorf("invalid admin arguments %v were accepted", args)
+		}
+	}
+	if err := Run("", []string{"players", "list"}, strings.NewReader(""), &bytes.Buffer{}); err == nil {
+		t.Errorf("admin without state file succeeded")
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestInfo is filled while a request passes the middlewares, the player
+// name is only known once CheckJWT authenticated it.
+type requestInfo struct {
+	id         string
+	playername string
+	logger     *log.Entry
+}
+
+// statusRecorder remembers the status written by the handler. It passes
+// Hijack through, which the WebSocket upgrade needs.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer doesn't support hijacking")
+	}
+	if s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// traceRequest tags every request with an id, taken from the X-Request-ID
+// header if the client sent a sane one. The id is echoed in the response
+// header and error envelopes and added to the fields of requestLogger.
+// Once the request is done, it is logged with route template, status,
+// latency and player name, and its latency is added to the metrics.
+func traceRequest(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(REQUEST_ID_HEADER)
+		if len(id) == 0 || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, id)
+		info := &requestInfo{id: id, logger: log.WithField("request_id", id)}
+		recorder := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), battleshipContextKey("requestInfo"), info)))
+
+		route := ""
+		if current := mux.CurrentRoute(r); current != nil {
+			route, _ = current.GetPathTemplate()
+		}
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		latency := time.Since(start)
+		observeRequest(route, r.Method, recorder.status, latency.Seconds())
+		entry := info.logger.WithFields(log.Fields{
+			"method":     r.Method,
+			"route":      route,
+			"path":       r.URL.Path,
+			"status":     recorder.status,
+			"latency_ms": float64(latency.Microseconds()) / 1000,
+			"player":     info.playername,
+		})
+		if recorder.status >= http.StatusInternalServerError {
+			entry.Error("request failed")
+		} else {
+			entry.Info("request served")
+		}
+	})
+}
+
+func getRequestInfoFromContext(r *http.Request) (*requestInfo, bool) {
+	info, ok := r.Context().Value(battleshipContextKey("requestInfo")).(*requestInfo)
+	return info, ok
+}
+
+// setRequestPlayername adds the authenticated player to the access log and
+// the fields of requestLogger.
+func setRequestPlayername(r *http.Request, playername string) {
+	if info, ok := getRequestInfoFromContext(r); ok {
+		info.playername = playername
+		info.logger = info.logger.WithField("player", playername)
+	}
+}
+
+// requestLogger returns a logger with the request id and, once known, the
+// player name as fields.
+func requestLogger(r *http.Request) *log.Entry {
+	if info, ok := getRequestInfoFromContext(r); ok {
+		return info.logger
+	}
+	return log.NewEntry(log.StandardLogger())
+}
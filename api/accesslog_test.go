@@ -0,0 +1,65 @@
+package api
+
+import (
+	"golang_battleship/player"
+	"net/http"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/steinfletcher/apitest"
+)
+
+func TestAccessLog(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	level := log.GetLevel()
+	log.SetLevel(log.InfoLevel)
+	defer log.SetLevel(level)
+
+	router := NewRouter([]byte("abcdefg"), []byte("01234567890123456789012345678901"))
+	player.NewPlayer("Speedwagon", "")
+	_, secret, _ := APITokens.Create("Speedwagon", "access log test", ScopeRead, 0)
+
+	apitest.New().
+		Handler(router).
+		Get(API_PREFIX+"/players/Speedwagon/stats").
+		Header("Authorization", "Bearer "+secret).
+		Header(REQUEST_ID_HEADER, "trace-7").
+		Expect(t).
+		Status(http.StatusOK).
+		Header(REQUEST_ID_HEADER, "trace-7").
+		End()
+
+	entry := hook.LastEntry()
+	if entry == nil {
+		t.Fatal("no access log written")
+	}
+	expected := log.Fields{
+		"request_id": "trace-7",
+		"method":     http.MethodGet,
+		"route":      API_PREFIX + "/players/{name:" + player.ValidPlayernameRegex + "}/stats",
+		"status":     http.StatusOK,
+		"player":     "Speedwagon",
+	}
+	for k, v := range expected {
+		if entry.Data[k] != v {
+			t.Errorf("expected access log field %s to be %v, got %v", k, v, entry.Data[k])
+		}
+	}
+	if _, ok := entry.Data["latency_ms"].(float64); !ok {
+		t.Errorf("access log misses the latency, got %v", entry.Data)
+	}
+
+	hook.Reset()
+	apitest.New().
+		Handler(router).
+		Get(API_PREFIX + "/games").
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+	entry = hook.LastEntry()
+	if entry == nil || entry.Data["status"] != http.StatusUnauthorized || entry.Data["player"] != "" || len(entry.Data["request_id"].(string)) == 0 {
+		t.Errorf("expected access log of unauthorized request, got %v", entry)
+	}
+}
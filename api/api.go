@@ -1,49 +1,96 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"strconv"
 	"time"
 
+	"golang_battleship/arena"
 	"golang_battleship/board"
 	"golang_battleship/game"
 	"golang_battleship/player"
+	"golang_battleship/tournament"
+	"golang_battleship/weapon"
+	"net"
 	"net/http"
+	"runtime"
 
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/mux"
 	ws "github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
 	VERSION               = "1.0"
+	API_VERSION           = "v1"
+	API_PREFIX            = "/api/" + API_VERSION
 	JWT_COOKIE_NAME       = "battleship_jwt"
 	PASSWORD_REHASH_COUNT = 10
+	DEFAULT_PAGE_SIZE     = 20
+	MAX_PAGE_SIZE         = 100
+	REQUEST_ID_HEADER     = "X-Request-ID"
 )
 
+// Commit is the commit the server was built from, set with
+// -ldflags "-X golang_battleship/api.Commit=<commit>".
+var Commit = "unknown"
+
 func Version(w http.ResponseWriter, r *http.Request) {
-	JSONResponse(w, http.StatusOK, VersionResponseBody{Version: VERSION})
+	JSONResponse(w, http.StatusOK, VersionResponseBody{
+		Version:      VERSION,
+		APIVersion:   API_VERSION,
+		Commit:       Commit,
+		GoVersion:    runtime.Version(),
+		RuleVariants: game.RuleVariants,
+		Weapons:      weapon.Names(),
+	})
 }
 
 func RegisterPlayer(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	var b RegisterPlayerBody
 	if err := decoder.Decode(&b); err != nil {
-		JSONErrorResponse(w, http.StatusBadRequest, "Failed to decode JSON body")
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
 		return
 	}
-	p, err := player.NewPlayer(b.Playername, b.Password)
+	if err := PasswordRequirements.Validate(b.Password); err != nil {
+		JSONValidationErrorResponse(w, "Failed to create new player", FieldError{Field: "password", Message: err.Error()})
+		return
+	}
+	passwordHash, err := hashPassword(b.Password, PASSWORD_REHASH_COUNT)
 	if err != nil {
-		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to create new player, %s", err.Error()))
+		JSONErrorResponse(w, http.StatusInternalServerError, "Failed to hash password")
 		return
 	}
-	log.Info(fmt.Printf("registered new player %s", b.Playername))
+	p, err := player.NewPlayer(b.Playername, passwordHash)
+	if err != nil {
+		JSONValidationErrorResponse(w, "Failed to create new player", FieldError{Field: "playername", Message: err.Error()})
+		return
+	}
+	requestLogger(r).Info(fmt.Sprintf("registered new player %s", b.Playername))
 	JSONResponse(w, http.StatusOK, RegisterPlayerResponseBody{ID: p.ID.String()})
 }
 
 func JoinGame(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	if g.NeedsAuthorization() {
+		b := JoinGameBody{InviteCode: r.URL.Query().Get("invite")}
+		if r.ContentLength > 0 {
+			decoder := json.NewDecoder(r.Body)
+			if err := decoder.Decode(&b); err != nil {
+				JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
+				return
+			}
+		}
+		if !authorizedToJoin(g, b) {
+			JSONErrorResponse(w, http.StatusForbidden, fmt.Sprintf("Invalid or expired invite code or password for game with id %s", g.ID))
+			return
+		}
+	}
 	err := g.AddParticipant(*p)
 	if err != nil {
 		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to join game with id %s, %s", g.ID, err))
@@ -52,6 +99,57 @@ func JoinGame(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.
 	JSONResponse(w, http.StatusOK, JoinGameResponseBody{ID: g.ID.String()})
 }
 
+func authorizedToJoin(g *game.Game, b JoinGameBody) bool {
+	if len(b.InviteCode) > 0 && g.ValidInviteCode(b.InviteCode) {
+		return true
+	}
+	if len(g.PasswordHash) > 0 && len(b.Password) > 0 {
+		return bcrypt.CompareHashAndPassword([]byte(g.PasswordHash), []byte(b.Password)) == nil
+	}
+	return false
+}
+
+// CreateInvite creates an invite code for g, which is sent to the friend
+// given in the body.
+func CreateInvite(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	if !g.IsParticipant(p.Name) {
+		JSONErrorResponse(w, http.StatusForbidden, fmt.Sprintf("Only participants may invite players to game with id %s", g.ID))
+		return
+	}
+	var b CreateInviteBody
+	if r.ContentLength > 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&b); err != nil {
+			JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
+			return
+		}
+	}
+	var friend *player.Player
+	if len(b.Friend) > 0 {
+		var err error
+		if friend, err = inviteFriend(p, g, b.Friend); err != nil {
+			JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to invite %s, %s", b.Friend, err))
+			return
+		}
+	}
+	code, expiry, err := g.NewInviteCode()
+	if err != nil {
+		JSONErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if friend != nil {
+		invite := player.GameInvite{GameID: g.ID.String(), From: p.Name, Code: code, Expires: expiry}
+		friend.Invite(invite)
+		live.notify(friend.Name, LiveServerMessage{Type: LiveInvite, Invite: &invite})
+	}
+	JSONResponse(w, http.StatusOK, InviteResponseBody{
+		Code:    code,
+		Link:    fmt.Sprintf("/games/%s/join?invite=%s", g.ID, code),
+		Expires: expiry,
+		Friend:  b.Friend,
+	})
+}
+
 func LeaveGame(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
 	err := g.RemoveParticipant(*p)
 	if err != nil {
@@ -73,53 +171,219 @@ func CreateGame(w http.ResponseWriter, r *http.Request) {
 		Description: game.DefaultDescription,
 	}
 	if err := decoder.Decode(&c); err != nil {
-		JSONErrorResponse(w, http.StatusBadRequest, "Failed to parse request")
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to parse request")
+		return
+	}
+	creator, err := getPlayernameFromContext(r)
+	if err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	g, err := game.NewGame(c.BoardParameters.SizeX, c.BoardParameters.SizeY, c.BoardParameters.MaxShips, c.Description, c.MaxPlayers)
+	var passwordHash string
+	if len(c.Password) > 0 {
+		passwordHash, err = hashPassword(c.Password, PASSWORD_REHASH_COUNT)
+		if err != nil {
+			JSONErrorResponse(w, http.StatusInternalServerError, "Failed to hash game password")
+			return
+		}
+	}
+	g, err := game.NewGame(c.BoardParameters.SizeX, c.BoardParameters.SizeY, c.BoardParameters.MaxShips, c.Description, c.MaxPlayers, creator)
 	if err != nil {
 		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to create new game, %s", err))
 		return
 	}
+	g.Private = c.Private
+	g.PasswordHash = passwordHash
+	if c.BestOf > 1 {
+		if _, err := game.NewSeries(g, c.BestOf, c.CreditSeriesWinnerOnly); err != nil {
+			game.DeleteByUUID(g.ID.String())
+			JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to create new game, %s", err))
+			return
+		}
+	}
 	JSONResponse(w, http.StatusOK, CreateGameResponseBody{ID: g.ID.String()})
 }
 
+// ListGames returns a page of the games matching the query parameters, see
+// parseListGamesQuery. Private games are only listed for their participants.
 func ListGames(w http.ResponseWriter, r *http.Request) {
-	games := make(map[string]game.Game)
-	if state := r.URL.Query().Get("state"); len(state) > 0 {
+	playername, _ := getPlayernameFromContext(r)
+	q, err := parseListGamesQuery(r)
+	if err != nil {
+		JSONValidationErrorResponse(w, "Invalid query", err)
+		return
+	}
+	q.filter.Viewer = playername
+	games, total, next, err := game.List(q.filter, q.sortKey, q.descending, q.cursor, q.limit)
+	if err != nil {
+		JSONValidationErrorResponse(w, "Invalid query", FieldError{Field: "cursor", Message: err.Error()})
+		return
+	}
+	body := ListGamesResponseBody{Games: []GameSummary{}, Total: total, NextCursor: next}
+	for _, g := range games {
+		g.Mutex().Lock()
+		body.Games = append(body.Games, gameSummary(g))
+		g.Mutex().Unlock()
+	}
+	JSONResponse(w, http.StatusOK, body)
+}
+
+type listGamesQuery struct {
+	filter     game.Filter
+	sortKey    game.SortKey
+	descending bool
+	cursor     string
+	limit      int
+}
+
+// parseListGamesQuery reads the filters state, participant, min_free_slots,
+// size_x, size_y, created_after and created_before, the order given by sort
+// (creation_date or free_slots) and order (asc or desc) and the page given
+// by cursor and limit. By default the newest games are listed first.
+func parseListGamesQuery(r *http.Request) (listGamesQuery, error) {
+	var err error
+	query := r.URL.Query()
+	q := listGamesQuery{sortKey: game.SortByCreationDate, descending: true, cursor: query.Get("cursor"), limit: DEFAULT_PAGE_SIZE}
+	q.filter.Participant = query.Get("participant")
+	if state := query.Get("state"); len(state) > 0 {
 		stateint, ok := game.GameStateMap[state]
 		if !ok {
-			JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid game state %s", state))
-			return
+			return q, FieldError{Field: "state", Message: fmt.Sprintf("invalid game state %s", state)}
 		}
-		for _, g := range game.AllGames {
-			if g.State == stateint {
-				games[g.ID.String()] = *g
+		q.filter.State = &stateint
+	}
+	ints := map[string]*int{
+		"min_free_slots": &q.filter.MinFreeSlots,
+		"size_x":         &q.filter.SizeX,
+		"size_y":         &q.filter.SizeY,
+		"limit":          &q.limit,
+	}
+	for name, value := range ints {
+		if v := query.Get(name); len(v) > 0 {
+			if *value, err = strconv.Atoi(v); err != nil || *value < 0 {
+				return q, FieldError{Field: name, Message: fmt.Sprintf("%s must be a non-negative integer", name)}
 			}
 		}
-		JSONResponse(w, http.StatusOK, games)
+	}
+	if q.limit < 1 || q.limit > MAX_PAGE_SIZE {
+		return q, FieldError{Field: "limit", Message: fmt.Sprintf("limit must be an integer between 1 and %d", MAX_PAGE_SIZE)}
+	}
+	dates := map[string]*time.Time{
+		"created_after":  &q.filter.CreatedAfter,
+		"created_before": &q.filter.CreatedBefore,
+	}
+	for name, value := range dates {
+		if v := query.Get(name); len(v) > 0 {
+			if *value, err = time.Parse(time.RFC3339, v); err != nil {
+				return q, FieldError{Field: name, Message: fmt.Sprintf("%s must be a RFC 3339 date", name)}
+			}
+		}
+	}
+	if v := query.Get("sort"); len(v) > 0 {
+		var ok bool
+		if q.sortKey, ok = game.SortKeyMap[v]; !ok {
+			return q, FieldError{Field: "sort", Message: fmt.Sprintf("invalid sort key %s", v)}
+		}
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		q.descending = false
+	default:
+		return q, FieldError{Field: "order", Message: "order must be asc or desc"}
+	}
+	return q, nil
+}
+
+// GetGame returns g as p may see it. Games which need an invite or a
+// password are hidden from anyone who may not watch them, as in ListGames.
+func GetGame(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	if !mayWatch(p, g) {
+		JSONErrorResponse(w, http.StatusNotFound, fmt.Sprintf("no game found for uuid %s", g.ID))
 		return
 	}
+	JSONResponse(w, http.StatusOK, gameView(g, p))
+}
 
-	for _, g := range game.AllGames {
-		games[g.ID.String()] = *g
+func Rematch(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	rematch, err := g.Rematch(p.Name)
+	if err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to create rematch for game with id %s, %s", g.ID, err))
+		return
 	}
-	JSONResponse(w, http.StatusOK, games)
+	JSONResponse(w, http.StatusOK, RematchResponseBody{ID: rematch.ID.String()})
 }
 
-func GetGame(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
-	game := GetGameResponseBody{
-		ID:           g.ID.String(),
-		State:        g.State,
-		CreationDate: g.CreationDate,
-		Participants: g.Participants,
-		CreateGameBody: CreateGameBody{
-			g.BoardParameters,
-			g.MaxParticipants,
-			g.Description,
-		},
+func UpdateGame(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	if !g.IsHost(p.Name) {
+		JSONErrorResponse(w, http.StatusForbidden, fmt.Sprintf("Only the host may change game with id %s", g.ID))
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var b UpdateGameBody
+	if err := decoder.Decode(&b); err != nil {
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
+		return
+	}
+	if b.BoardParameters != nil {
+		if err := g.SetBoardParameters(*b.BoardParameters); err != nil {
+			JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to update game with id %s, %s", g.ID, err))
+			return
+		}
+	}
+	if b.Description != nil {
+		g.Description = *b.Description
+		if len(g.Description) == 0 {
+			g.Description = game.DefaultDescription
+		}
+	}
+	GetGame(w, r, p, g)
+}
+
+func KickPlayer(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	if !g.IsHost(p.Name) {
+		JSONErrorResponse(w, http.StatusForbidden, fmt.Sprintf("Only the host may kick players from game with id %s", g.ID))
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var b KickPlayerBody
+	if err := decoder.Decode(&b); err != nil {
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
+		return
+	}
+	if err := g.Kick(b.Playername); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to kick player %s, %s", b.Playername, err))
+		return
+	}
+	requestLogger(r).Info(fmt.Sprintf("host %s kicked %s from game %s", p.Name, b.Playername, g.ID))
+	GetGame(w, r, p, g)
+}
+
+func LockGame(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	if !g.IsHost(p.Name) {
+		JSONErrorResponse(w, http.StatusForbidden, fmt.Sprintf("Only the host may lock game with id %s", g.ID))
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var b LockGameBody
+	if err := decoder.Decode(&b); err != nil {
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
+		return
+	}
+	g.Locked = b.Locked
+	GetGame(w, r, p, g)
+}
+
+func StartGame(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	if !g.IsHost(p.Name) {
+		JSONErrorResponse(w, http.StatusForbidden, fmt.Sprintf("Only the host may start game with id %s", g.ID))
+		return
+	}
+	if err := g.StartDeployment(); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to start game with id %s, %s", g.ID, err))
+		return
 	}
-	JSONResponse(w, http.StatusOK, game)
+	GetGame(w, r, p, g)
 }
 
 func Scoreboard(w http.ResponseWriter, r *http.Request) {
@@ -128,7 +392,7 @@ func Scoreboard(w http.ResponseWriter, r *http.Request) {
 		var err error
 		rankingint, err = strconv.Atoi(ranking)
 		if err != nil {
-			JSONErrorResponse(w, http.StatusBadRequest, "ranking must be an integer")
+			JSONValidationErrorResponse(w, "Invalid query", FieldError{Field: "ranking", Message: "ranking must be an integer"})
 			return
 		}
 	}
@@ -148,6 +412,94 @@ func Scoreboard(w http.ResponseWriter, r *http.Request) {
 	JSONResponse(w, http.StatusOK, scoreboard)
 }
 
+func PlayerStats(w http.ResponseWriter, r *http.Request) {
+	p, err := player.GetByName(mux.Vars(r)["name"])
+	if err != nil {
+		JSONErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	shipsLost := p.Stats.ShipsLost
+	if shipsLost == nil {
+		shipsLost = map[string]int{}
+	}
+	JSONResponse(w, http.StatusOK, PlayerStatsResponseBody{
+		Name:              p.Name,
+		Wins:              p.Wins,
+		Losses:            p.Losses,
+		ShotsFired:        p.Stats.ShotsFired,
+		Hits:              p.Stats.Hits,
+		Accuracy:          p.Stats.Accuracy(),
+		AverageTurnsToWin: p.Stats.AverageTurnsToWin(),
+		ShipsLost:         shipsLost,
+		FavouriteWeapon:   p.Stats.FavouriteWeapon(),
+		LongestWinStreak:  p.Stats.LongestWinStreak,
+		CurrentWinStreak:  p.Stats.CurrentWinStreak,
+	})
+}
+
+func PlayerMatchHistory(w http.ResponseWriter, r *http.Request) {
+	p, err := player.GetByName(mux.Vars(r)["name"])
+	if err != nil {
+		JSONErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	page, pageSize := 1, DEFAULT_PAGE_SIZE
+	if v := r.URL.Query().Get("page"); len(v) > 0 {
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			JSONValidationErrorResponse(w, "Invalid query", FieldError{Field: "page", Message: "page must be a positive integer"})
+			return
+		}
+	}
+	if v := r.URL.Query().Get("page_size"); len(v) > 0 {
+		if pageSize, err = strconv.Atoi(v); err != nil || pageSize < 1 || pageSize > MAX_PAGE_SIZE {
+			JSONValidationErrorResponse(w, "Invalid query", FieldError{Field: "page_size", Message: fmt.Sprintf("page_size must be an integer between 1 and %d", MAX_PAGE_SIZE)})
+			return
+		}
+	}
+	games, total := p.MatchHistory(page, pageSize)
+	JSONResponse(w, http.StatusOK, MatchHistoryResponseBody{Total: total, Page: page, PageSize: pageSize, Games: games})
+}
+
+func DeployShip(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	decoder := json.NewDecoder(r.Body)
+	var b DeployShipBody
+	if err := decoder.Decode(&b); err != nil {
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
+		return
+	}
+	if err := g.Deploy(p.Name, b.Class, b.X, b.Y, b.Orientation); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to deploy %s, %s", b.Class, err))
+		return
+	}
+	GetGame(w, r, p, g)
+}
+
+func Fire(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	decoder := json.NewDecoder(r.Body)
+	var b FireBody
+	if err := decoder.Decode(&b); err != nil {
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
+		return
+	}
+	results, err := g.Fire(p.Name, b.Target, b.X, b.Y, b.Weapon)
+	if err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to fire at %s, %s", b.Target, err))
+		return
+	}
+	JSONResponse(w, http.StatusOK, FireResponseBody{Results: results, State: g.State, ActivePlayer: g.ActivePlayer, Winner: g.Winner})
+}
+
+// BotArena connects the bot of p to the bot arena via WebSocket.
+func BotArena(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	if !ws.IsWebSocketUpgrade(r) {
+		JSONErrorResponse(w, http.StatusBadRequest, "the bot arena requires a WebSocket upgrade")
+		return
+	}
+	webSocketConnections.Inc()
+	defer webSocketConnections.Dec()
+	arena.BotArena.ServeWebSocket(w, r, p.Name)
+}
+
 func echo(w http.ResponseWriter, r *http.Request) {
 	upgrader := ws.Upgrader{}
 	c, err := upgrader.Upgrade(w, r, nil)
@@ -192,62 +544,130 @@ func logRouterPaths(router *mux.Router) {
 	})
 }
 
-func JSONErrorResponse(w http.ResponseWriter, httpStatus int, message string) {
-	e := ErrorResponseBody{
-		Message: message,
-	}
-	body, _ := json.Marshal(e)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(httpStatus)
-	if len(message) > 0 {
-		w.Write(body)
-	}
-}
-
 func JSONResponse(w http.ResponseWriter, httpStatus int, content interface{}) {
 	body, err := json.Marshal(content)
 	if err != nil {
-		JSONErrorResponse(w, http.StatusInternalServerError, "")
+		log.Error("failed to encode response, ", err)
+		JSONErrorResponse(w, http.StatusInternalServerError, "Failed to encode response")
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(httpStatus)
 	w.Write(body)
 }
 
-func Serve(addr string, port int, jwtSigningKey []byte, csrfAuthKey []byte) {
-	jwtm := JWTMiddleware{jwtSigningKey: jwtSigningKey, jwtCookieName: JWT_COOKIE_NAME, loginHandler: Login}
-	csrfm := csrf.Protect(csrfAuthKey)
+// NewRouter registers the JSON endpoints below API_PREFIX, their unversioned
+// deprecated aliases and the static files.
+func NewRouter(jwtSigningKey []byte, csrfAuthKey []byte) *mux.Router {
+	return NewRouterWithKeys(StaticKeyRing(jwtSigningKey), StaticKeyRing(csrfAuthKey))
+}
+
+// NewRouterWithKeys is NewRouter with key rings, which can be rotated while
+// the router serves.
+func NewRouterWithKeys(jwtKeys *KeyRing, csrfKeys *KeyRing) *mux.Router {
+	jwtm := JWTMiddleware{keys: jwtKeys, jwtCookieName: JWT_COOKIE_NAME, loginHandler: Login}
+	csrfm := csrfProtect(csrfKeys, csrf.Path("/"), csrf.Secure(SecureCookies), csrf.ErrorHandler(http.HandlerFunc(csrfFailure)))
 	defaultRouter := mux.NewRouter()
+	defaultRouter.Use(traceRequest)
+	defaultRouter.NotFoundHandler = traceRequest(http.HandlerFunc(notFound))
+	defaultRouter.MethodNotAllowedHandler = traceRequest(http.HandlerFunc(methodNotAllowed))
 
-	needsAuthRouter := defaultRouter.NewRoute().Subrouter()
+	apiRouter := defaultRouter.PathPrefix(API_PREFIX).Subrouter()
+	needsAuthRouter := apiRouter.NewRoute().Subrouter()
 	needsAuthRouter.Use(jwtm.CheckJWT, csrfm)
+	registerAPIRoutes(apiRouter, needsAuthRouter, jwtm)
 
-	pw, _ := hashPassword("armon", PASSWORD_REHASH_COUNT)
-	player.NewPlayer("armon", pw)
-
-	pw2, _ := hashPassword("rudolf", PASSWORD_REHASH_COUNT)
-	x, _ := player.NewPlayer("rudolf", pw2)
-	x.ScoreWin()
-	x.ScoreWin()
-
-	g1, _ := game.NewGame(12, 12, 2, "testgame please ignore", 2, "armon", "rudolf")
-	log.Info("started game ", g1)
-	g2, _ := game.NewGame(12, 12, 2, "testgame2 please ignore", 2, "armon", "rudolf")
-	log.Info("started game ", g2)
-	g3, _ := game.NewGame(12, 12, 2, "testgame2 please ignore", 2, "armon", "rudolf")
-	g3.State = 2
-	log.Info("started game ", g3)
+	aliasRouter := defaultRouter.NewRoute().Subrouter()
+	aliasRouter.Use(deprecatedAlias)
+	needsAuthAliasRouter := aliasRouter.NewRoute().Subrouter()
+	needsAuthAliasRouter.Use(jwtm.CheckJWT, csrfm)
+	registerAPIRoutes(aliasRouter, needsAuthAliasRouter, jwtm)
 
 	defaultRouter.Path("/").Methods("GET").Handler(http.RedirectHandler("/login.html", http.StatusPermanentRedirect))
-	defaultRouter.Path("/login").Methods("POST").Handler(jwtm)
-	defaultRouter.Path("/version").Methods("GET").HandlerFunc(Version)
 	defaultRouter.Path("/{resource:[a-zA-Z0-9_\\-]+.html}").Methods("GET").Handler(http.FileServer(http.Dir("./static/html/")))
 	defaultRouter.Path("/{resource:[a-zA-Z0-9_\\-]+.css}").Methods("GET").Handler(http.FileServer(http.Dir("./static/stylesheets/")))
 	defaultRouter.Path("/{resource:[a-zA-Z0-9_\\-]+.js}").Methods("GET").Handler(http.FileServer(http.Dir("./static/js/")))
 	defaultRouter.Path("/{resource:[a-zA-Z0-9_\\-]+.(?:ico|png|jpg|jpeg)}").Methods("GET").Handler(http.FileServer(http.Dir("./static/images/")))
+	return defaultRouter
+}
+
+// registerAPIRoutes registers the JSON endpoints, the ones needing
+// authentication on needsAuthRouter.
+func registerAPIRoutes(defaultRouter *mux.Router, needsAuthRouter *mux.Router, jwtm JWTMiddleware) {
+	defaultRouter.Path("/login").Methods("POST").Handler(jwtm)
+	defaultRouter.Path("/version").Methods("GET").HandlerFunc(Version)
+	defaultRouter.Path("/errors").Methods("GET").HandlerFunc(ErrorCodes)
+	defaultRouter.Path("/openapi.json").Methods("GET").HandlerFunc(OpenAPI)
 
 	needsAuthRouter.Path("/players").Methods("GET").HandlerFunc(Scoreboard)
 	needsAuthRouter.Path("/players").Methods("POST").HandlerFunc(RegisterPlayer)
+	needsAuthRouter.Path("/players/me").Methods("GET").Handler(
+		playerHandler{
+			playerValidator: playerValidator,
+			handler:         GetProfile,
+		})
+	needsAuthRouter.Path("/players/me").Methods("PATCH").Handler(
+		playerHandler{
+			playerValidator: playerValidator,
+			handler:         UpdateProfile,
+		})
+	needsAuthRouter.Path("/players/me").Methods("DELETE").Handler(
+		sessionOnly(playerHandler{
+			playerValidator: playerValidator,
+			handler:         DeleteProfile,
+		}))
+	needsAuthRouter.Path("/players/me/password").Methods("POST").Handler(
+		sessionOnly(playerHandler{
+			playerValidator: playerValidator,
+			handler:         ChangePassword,
+		}))
+	needsAuthRouter.Path("/players/me/friends").Methods("GET").Handler(
+		playerHandler{
+			playerValidator: playerValidator,
+			handler:         ListFriends,
+		})
+	needsAuthRouter.Path("/players/me/friends").Methods("POST").Handler(
+		playerHandler{
+			playerValidator: playerValidator,
+			handler:         RequestFriend,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/players/me/friends/{name:%s}/accept", player.ValidPlayernameRegex)).Methods("POST").Handler(
+		playerHandler{
+			playerValidator: playerValidator,
+			handler:         AcceptFriend,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/players/me/friends/{name:%s}", player.ValidPlayernameRegex)).Methods("DELETE").Handler(
+		playerHandler{
+			playerValidator: playerValidator,
+			handler:         RemoveFriend,
+		})
+	needsAuthRouter.Path("/players/me/invites").Methods("GET").Handler(
+		playerHandler{
+			playerValidator: playerValidator,
+			handler:         ListInvites,
+		})
+	needsAuthRouter.Path("/players/me/ws").Methods("GET").Handler(
+		playerHandler{
+			playerValidator: playerValidator,
+			handler:         PlayerSocket,
+		})
+	needsAuthRouter.Path("/players/me/tokens").Methods("GET").Handler(
+		sessionOnly(playerHandler{
+			playerValidator: playerValidator,
+			handler:         ListAPITokens,
+		}))
+	needsAuthRouter.Path("/players/me/tokens").Methods("POST").Handler(
+		sessionOnly(playerHandler{
+			playerValidator: playerValidator,
+			handler:         CreateAPIToken,
+		}))
+	needsAuthRouter.Path(fmt.Sprintf("/players/me/tokens/{id:%s}", game.ValidGameIDRegex)).Methods("DELETE").Handler(
+		sessionOnly(playerHandler{
+			playerValidator: playerValidator,
+			handler:         RevokeAPIToken,
+		}))
+	needsAuthRouter.Path(fmt.Sprintf("/players/{name:%s}/stats", player.ValidPlayernameRegex)).Methods("GET").HandlerFunc(PlayerStats)
+	needsAuthRouter.Path(fmt.Sprintf("/players/{name:%s}/games", player.ValidPlayernameRegex)).Methods("GET").HandlerFunc(PlayerMatchHistory)
 	needsAuthRouter.Path("/games").Methods("GET").HandlerFunc(ListGames)
 	needsAuthRouter.Path("/games").Methods("POST").HandlerFunc(CreateGame)
 	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}", game.ValidGameIDRegex)).Methods("GET").Handler(
@@ -256,6 +676,12 @@ func Serve(addr string, port int, jwtSigningKey []byte, csrfAuthKey []byte) {
 			playerValidator: playerValidator,
 			handler:         GetGame,
 		})
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}", game.ValidGameIDRegex)).Methods("PATCH").Handler(
+		gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         UpdateGame,
+		})
 	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}", game.ValidGameIDRegex)).Methods("DELETE").Handler(
 		gameValidatorHandler{
 			gameValidator:   gameValidator,
@@ -263,35 +689,239 @@ func Serve(addr string, port int, jwtSigningKey []byte, csrfAuthKey []byte) {
 			handler:         DeleteGame,
 		})
 	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/join", game.ValidGameIDRegex)).Methods("GET").Handler(
+		requiresPlay(gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         JoinGame,
+		}))
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/join", game.ValidGameIDRegex)).Methods("POST").Handler(
 		gameValidatorHandler{
 			gameValidator:   gameValidator,
 			playerValidator: playerValidator,
 			handler:         JoinGame,
 		})
-	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/leave", game.ValidGameIDRegex)).Methods("GET").Handler(
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/invites", game.ValidGameIDRegex)).Methods("POST").Handler(
+		gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         CreateInvite,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/rematch", game.ValidGameIDRegex)).Methods("POST").Handler(
+		gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         Rematch,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/deploy", game.ValidGameIDRegex)).Methods("POST").Handler(
+		gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         DeployShip,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/fire", game.ValidGameIDRegex)).Methods("POST").Handler(
+		gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         Fire,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/leave", game.ValidGameIDRegex)).Methods("POST").Handler(
 		gameValidatorHandler{
 			gameValidator:   gameValidator,
 			playerValidator: playerValidator,
 			handler:         LeaveGame,
 		})
 
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/kick", game.ValidGameIDRegex)).Methods("POST").Handler(
+		gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         KickPlayer,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/lock", game.ValidGameIDRegex)).Methods("POST").Handler(
+		gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         LockGame,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/start", game.ValidGameIDRegex)).Methods("POST").Handler(
+		gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         StartGame,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/ws", game.ValidGameIDRegex)).Methods("GET").Handler(
+		gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         GameSocket,
+			unlocked:        true,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/games/{id:%s}/replay", game.ValidGameIDRegex)).Methods("GET").Handler(
+		gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         Replay,
+		})
+
+	needsAuthRouter.Path("/tournaments").Methods("GET").HandlerFunc(ListTournaments)
+	needsAuthRouter.Path("/tournaments").Methods("POST").HandlerFunc(CreateTournament)
+	needsAuthRouter.Path(fmt.Sprintf("/tournaments/{id:%s}", tournament.ValidTournamentIDRegex)).Methods("GET").Handler(
+		tournamentValidatorHandler{
+			tournamentValidator: tournamentValidator,
+			playerValidator:     playerValidator,
+			handler:             GetTournament,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/tournaments/{id:%s}/standings", tournament.ValidTournamentIDRegex)).Methods("GET").Handler(
+		tournamentValidatorHandler{
+			tournamentValidator: tournamentValidator,
+			playerValidator:     playerValidator,
+			handler:             GetStandings,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/tournaments/{id:%s}/register", tournament.ValidTournamentIDRegex)).Methods("POST").Handler(
+		tournamentValidatorHandler{
+			tournamentValidator: tournamentValidator,
+			playerValidator:     playerValidator,
+			handler:             RegisterForTournament,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/tournaments/{id:%s}/withdraw", tournament.ValidTournamentIDRegex)).Methods("POST").Handler(
+		tournamentValidatorHandler{
+			tournamentValidator: tournamentValidator,
+			playerValidator:     playerValidator,
+			handler:             WithdrawFromTournament,
+		})
+	needsAuthRouter.Path(fmt.Sprintf("/tournaments/{id:%s}/start", tournament.ValidTournamentIDRegex)).Methods("POST").Handler(
+		tournamentValidatorHandler{
+			tournamentValidator: tournamentValidator,
+			playerValidator:     playerValidator,
+			handler:             StartTournament,
+		})
+
+	needsAuthRouter.Path("/arena").Methods("GET").Handler(
+		requiresPlay(playerHandler{
+			playerValidator: playerValidator,
+			handler:         BotArena,
+		}))
+
 	needsAuthRouter.Path("/logout").Methods("GET").Handler(
-		logoutHandler{
+		requiresPlay(logoutHandler{
 			jwtBlacklistValidator: jwtBlacklistValidator,
 			handler:               Logout,
-		})
+		}))
+}
+
+// ShutdownTimeout is the time in-flight requests get to finish once Serve
+// is asked to stop.
+var ShutdownTimeout = 15 * time.Second
+
+// seedDemoData adds demo players and games to an empty server.
+func seedDemoData() {
+	pw, _ := hashPassword("armon", PASSWORD_REHASH_COUNT)
+	player.NewPlayer("armon", pw)
+
+	pw2, _ := hashPassword("rudolf", PASSWORD_REHASH_COUNT)
+	x, _ := player.NewPlayer("rudolf", pw2)
+	x.ScoreWin()
+	x.ScoreWin()
 
-	routers := []*mux.Router{defaultRouter, needsAuthRouter}
-	for _, router := range routers {
-		logRouterPaths(router)
+	g1, _ := game.NewGame(12, 12, 2, "testgame please ignore", 2, "armon", "rudolf")
+	log.Info("started game ", g1)
+	g2, _ := game.NewGame(12, 12, 2, "testgame2 please ignore", 2, "armon", "rudolf")
+	log.Info("started game ", g2)
+	g3, _ := game.NewGame(12, 12, 2, "testgame2 please ignore", 2, "armon", "rudolf")
+	g3.State = 2
+	log.Info("started game ", g3)
+}
+
+// Serve runs the server on addr and port until ctx is done. Metrics are
+// served on the same port unless metricsPort is set, which keeps them off
+// the public port. On shutdown no new connections are accepted, WebSocket
+// clients get a close frame and in-flight requests get ShutdownTimeout to
+// finish. With tlsOptions enabled the server speaks HTTPS, cookies are
+// marked Secure and the optional redirect port forwards plain HTTP to it.
+// Rotating jwtKeys and csrfKeys takes effect immediately. The error of a
+// listener failing is returned.
+func Serve(ctx context.Context, addr string, port int, metricsPort int, tlsOptions TLSOptions, jwtKeys *KeyRing, csrfKeys *KeyRing) error {
+	if len(player.AllPlayersList) == 0 {
+		seedDemoData()
+	}
+
+	var tlsConfig *tls.Config
+	if tlsOptions.Enabled() {
+		var err error
+		if tlsConfig, err = tlsOptions.config(addr); err != nil {
+			return fmt.Errorf("failed to set up TLS: %s", err)
+		}
 	}
+	SecureCookies = tlsConfig != nil
 
-	srv := http.Server{
-		Addr:              addr + ":" + fmt.Sprint(port),
-		Handler:           defaultRouter,
+	arena.BotArena.Open()
+	live.Open()
+	game.ResumeClocks()
+	router := NewRouterWithKeys(jwtKeys, csrfKeys)
+	servers := []*http.Server{}
+	if metricsPort > 0 {
+		metricsRouter := mux.NewRouter()
+		metricsRouter.Path("/metrics").Methods("GET").Handler(Metrics())
+		servers = append(servers, &http.Server{
+			Addr:              net.JoinHostPort(addr, strconv.Itoa(metricsPort)),
+			Handler:           metricsRouter,
+			ReadHeaderTimeout: time.Second * 15,
+		})
+	} else {
+		router.Path("/metrics").Methods("GET").Handler(Metrics())
+	}
+	logRouterPaths(router)
+
+	srv := &http.Server{
+		Addr:              net.JoinHostPort(addr, strconv.Itoa(port)),
+		Handler:           router,
 		WriteTimeout:      time.Second * 15,
 		ReadHeaderTimeout: time.Second * 15,
 		IdleTimeout:       time.Second * 30,
+		TLSConfig:         tlsConfig,
+	}
+	servers = append(servers, srv)
+	if tlsConfig != nil && tlsOptions.RedirectPort > 0 {
+		servers = append(servers, &http.Server{
+			Addr:              net.JoinHostPort(addr, strconv.Itoa(tlsOptions.RedirectPort)),
+			Handler:           redirectToHTTPS(port),
+			ReadHeaderTimeout: time.Second * 15,
+		})
+	}
+
+	failed := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s *http.Server) {
+			var err error
+			if s.TLSConfig != nil {
+				log.Info("listening with TLS on ", s.Addr)
+				err = s.ListenAndServeTLS("", "")
+			} else {
+				log.Info("listening on ", s.Addr)
+				err = s.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				failed <- err
+			}
+		}(s)
+	}
+	var err error
+	select {
+	case err = <-failed:
+	case <-ctx.Done():
+		log.Info("shutting down")
+	}
+	// hijacked WebSocket connections aren't closed by Shutdown
+	arena.BotArena.Shutdown()
+	live.Shutdown()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	for _, s := range servers {
+		if shutdownErr := s.Shutdown(shutdownCtx); shutdownErr != nil {
+			log.Warn(fmt.Sprintf("failed to shut down %s gracefully: %s", s.Addr, shutdownErr))
+		}
 	}
-	log.Fatal(srv.ListenAndServe())
+	// no turn timeout or grace period may change a game while it is saved
+	game.StopClocks()
+	return err
 }
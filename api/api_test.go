@@ -1,11 +1,13 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"golang_battleship/game"
 	"golang_battleship/player"
-	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
@@ -14,154 +16,350 @@ import (
 )
 
 func TestRegisterPlayer(t *testing.T) {
-	finish := make(chan struct{})
 	r := mux.NewRouter()
 	r.HandleFunc("/players", Scoreboard)
 	r.HandleFunc("/register", RegisterPlayer)
 
-	go func() {
-		if err := http.ListenAndServe("127.0.0.1:8080", r); err != nil {
-			panic(err)
-		}
-	}()
+	srv := httptest.NewServer(r)
+	defer srv.Close()
 
-	go func() {
-		cli := &http.Client{
-			Timeout: time.Second * 1,
-		}
+	cli := &http.Client{
+		Timeout: time.Second * 10,
+	}
 
-		apitest.New().
-			EnableNetworking(cli).
-			Post("http://127.0.0.1:8080/register").
-			JSON(`{"name": "Rudolf"}`).
-			Expect(t).
-			Status(http.StatusOK).
-			End()
+	apitest.New().
+		EnableNetworking(cli).
+		Post(srv.URL + "/register").
+		JSON(`{"name": "Rudolf", "password": "passwordrudolf"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
 
-		apitest.New().
-			EnableNetworking(cli).
-			Post("http://127.0.0.1:8080/register").
-			JSON(`{"name": "Dagobert"}`).
-			Expect(t).
-			Status(http.StatusOK).
-			End()
+	apitest.New().
+		EnableNetworking(cli).
+		Post(srv.URL + "/register").
+		JSON(`{"name": "Dagobert", "password": "passworddagobert"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
 
-		apitest.New().
-			EnableNetworking(cli).
-			Post("http://127.0.0.1:8080/register").
-			JSON(`{"name": "%Dagobert"}`).
-			Expect(t).
-			Status(http.StatusBadRequest).
-			End()
+	apitest.New().
+		EnableNetworking(cli).
+		Post(srv.URL + "/register").
+		JSON(`{"name": "Gundel"}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
 
-		apitest.New().
-			EnableNetworking(cli).
-			Post("http://127.0.0.1:8080/register").
-			JSON(`{"name": "wwwbbbbbbbbbbiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiicdssdffsdf"}`).
-			Expect(t).
-			Status(http.StatusBadRequest).
-			End()
+	apitest.New().
+		EnableNetworking(cli).
+		Post(srv.URL + "/register").
+		JSON(`{"name": "%Dagobert", "password": "passworddagobert"}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
 
-		apitest.New().
-			EnableNetworking(cli).
-			Get("http://127.0.0.1:8080/players").
-			Expect(t).
-			//Body(`["Rudolf","Dagobert"]`).
-			Status(http.StatusOK).
-			End()
-		finish <- struct{}{}
-	}()
-	<-finish
+	apitest.New().
+		EnableNetworking(cli).
+		Post(srv.URL + "/register").
+		JSON(`{"name": "wwwbbbbbbbbbbiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiiicdssdffsdf", "password": "passwordwww"}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	apitest.New().
+		EnableNetworking(cli).
+		Get(srv.URL + "/players").
+		Expect(t).
+		//Body(`["Rudolf","Dagobert"]`).
+		Status(http.StatusOK).
+		End()
 }
 
 func TestListGames(t *testing.T) {
-	finish := make(chan struct{})
 	r := mux.NewRouter()
 	r.HandleFunc("/games", ListGames)
 	player.NewPlayer("Rudolf", "")
 	player.NewPlayer("Dagobert", "")
 	g, _ := game.NewGame(12, 12, 6, "New Game", 2, "Rudolf", "Dagobert")
 
-	go func() {
-		if err := http.ListenAndServe("127.0.0.1:8080", r); err != nil {
-			panic(err)
-		}
-	}()
+	srv := httptest.NewServer(r)
+	defer srv.Close()
 
-	go func() {
-		cli := &http.Client{
-			Timeout: time.Second * 1,
-		}
+	cli := &http.Client{
+		Timeout: time.Second * 10,
+	}
 
-		r := apitest.New().
-			EnableNetworking(cli).
-			Get("http://127.0.0.1:8080/games").
-			Expect(t).
-			Status(http.StatusOK).
-			End()
+	res := apitest.New().
+		EnableNetworking(cli).
+		Get(srv.URL + "/games").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
 
-		body, _ := ioutil.ReadAll(r.Response.Body)
-		var json_body map[string]json.RawMessage
-		var json_body_game map[string]json.RawMessage
-		err := json.Unmarshal(body, &json_body)
-		if err != nil {
-			t.Errorf("failed to find games in json response dict")
-			t.Fail()
+	var b ListGamesResponseBody
+	if err := json.NewDecoder(res.Response.Body).Decode(&b); err != nil {
+		t.Fatalf("failed to decode games: %s", err)
+	}
+	var summary *GameSummary
+	for i := range b.Games {
+		if b.Games[i].ID == g.ID.String() {
+			summary = &b.Games[i]
 		}
-		err = json.Unmarshal(json_body[g.ID.String()], &json_body_game)
-		if err != nil {
-			t.Errorf("failed to find game id %s in json response dict", g.ID.String())
-			t.Fail()
+	}
+	if summary == nil {
+		t.Fatalf("failed to find game id %s in json response list", g.ID.String())
+	}
+	for _, p := range summary.Participants {
+		if !g.IsParticipant(p) {
+			t.Errorf("got unknown participant %s", p)
 		}
-		var json_body_game_participants []string
-		err = json.Unmarshal(json_body_game["participants"], &json_body_game_participants)
-		if err != nil {
-			t.Errorf("failed to find key participants in game with id %s of json response dict", g.ID.String())
-			t.Fail()
-		}
-		for _, p := range json_body_game_participants {
-			found := 0
-			for _, pn := range g.Participants {
-				if pn.String() == p {
-					found = 1
-					break
-				}
-			}
-			if found == 0 {
-				t.Errorf("got unknown participant %s", p)
-				t.Fail()
-			}
-		}
-		finish <- struct{}{}
-	}()
-	<-finish
+	}
+}
+
+// withPlayername fakes what JWTMiddleware.CheckJWT puts into the request context.
+func withPlayername(playername string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), battleshipContextKey("jwtPlayername"), playername)
+		h.ServeHTTP(w, r.Clone(ctx))
+	})
 }
 
 func TestCreateGame(t *testing.T) {
-	finish := make(chan struct{})
 	r := mux.NewRouter()
-	r.HandleFunc("/games", CreateGame)
+	player.NewPlayer("Rudolf", "")
+	r.Handle("/games", withPlayername("Rudolf", http.HandlerFunc(CreateGame)))
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	cli := &http.Client{
+		Timeout: time.Second * 10,
+	}
+
+	apitest.New().
+		EnableNetworking(cli).
+		Post(srv.URL + "/games").
+		Body(`{}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+}
+
+func TestHostControls(t *testing.T) {
+	player.NewPlayer("Host", "")
+	player.NewPlayer("Guest", "")
+	g, _ := game.NewGame(12, 12, 6, "Host Game", 3, "Host", "Guest")
+	handler := func(playername string, h func(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game)) http.Handler {
+		return withPlayername(playername, gameValidatorHandler{
+			gameValidator:   gameValidator,
+			playerValidator: playerValidator,
+			handler:         h,
+		})
+	}
+	r := mux.NewRouter()
+	r.Path("/games/{id}").Methods("PATCH").Handler(handler("Guest", UpdateGame))
+	r.Path("/games/{id}/kick").Methods("POST").Handler(handler("Guest", KickPlayer))
+	r.Path("/games/{id}/lock").Methods("POST").Handler(handler("Host", LockGame))
+	r.Path("/games/{id}/start").Methods("POST").Handler(handler("Host", StartGame))
+
+	apitest.New().
+		Handler(r).
+		Patch("/games/" + g.ID.String()).
+		JSON(`{"board_parameters": {"size_x": 20, "size_y": 20, "max_ships": 5}}`).
+		Expect(t).
+		Status(http.StatusForbidden).
+		End()
+
+	apitest.New().
+		Handler(r).
+		Post("/games/" + g.ID.String() + "/kick").
+		JSON(`{"name": "Host"}`).
+		Expect(t).
+		Status(http.StatusForbidden).
+		End()
+
+	apitest.New().
+		Handler(r).
+		Post("/games/" + g.ID.String() + "/lock").
+		JSON(`{"locked": true}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	if !g.Locked {
+		t.Errorf("expected game with id %s to be locked", g.ID)
+	}
+
+	apitest.New().
+		Handler(r).
+		Post("/games/" + g.ID.String() + "/start").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	if g.State != game.StateDeployingShips {
+		t.Errorf("expected game with id %s to be deploying ships, got state %d", g.ID, g.State)
+	}
+}
+
+func TestPrivateGame(t *testing.T) {
+	player.NewPlayer("Owner", "")
+	player.NewPlayer("Stranger", "")
+	passwordHash, _ := hashPassword("secret", PASSWORD_REHASH_COUNT)
+	g, _ := game.NewGame(12, 12, 6, "Private Game", 3, "Owner")
+	g.Private = true
+	g.PasswordHash = passwordHash
+	joinHandler := withPlayername("Stranger", gameValidatorHandler{
+		gameValidator:   gameValidator,
+		playerValidator: playerValidator,
+		handler:         JoinGame,
+	})
+	r := mux.NewRouter()
+	r.Path("/games").Methods("GET").Handler(withPlayername("Stranger", http.HandlerFunc(ListGames)))
+	r.Path("/games/{id}/join").Methods("GET", "POST").Handler(joinHandler)
+	r.Path("/games/{id}").Methods("GET").Handler(withPlayername("Stranger", gameValidatorHandler{
+		gameValidator:   gameValidator,
+		playerValidator: playerValidator,
+		handler:         GetGame,
+	}))
 
-	go func() {
-		if err := http.ListenAndServe("127.0.0.1:8080", r); err != nil {
-			panic(err)
+	listed := func() bool {
+		listing := apitest.New().
+			Handler(r).
+			Get("/games").
+			Expect(t).
+			Status(http.StatusOK).
+			End()
+		var b ListGamesResponseBody
+		if err := json.NewDecoder(listing.Response.Body).Decode(&b); err != nil {
+			t.Fatalf("failed to decode games: %s", err)
+		}
+		for _, summary := range b.Games {
+			if summary.ID == g.ID.String() {
+				return true
+			}
 		}
-	}()
+		return false
+	}
+	if listed() {
+		t.Errorf("private game with id %s shows up in public listing", g.ID)
+	}
+	apitest.New().
+		Handler(r).
+		Get("/games/" + g.ID.String()).
+		Expect(t).
+		Status(http.StatusNotFound).
+		End()
+
+	apitest.New().
+		Handler(r).
+		Post("/games/" + g.ID.String() + "/join").
+		JSON(`{"password": "wrong"}`).
+		Expect(t).
+		Status(http.StatusForbidden).
+		End()
 
-	go func() {
-		cli := &http.Client{
-			Timeout: time.Second * 1,
+	code, _, _ := g.NewInviteCode()
+	if listed() {
+		t.Errorf("private game with id %s shows up for an invited player before joining", g.ID)
+	}
+	apitest.New().
+		Handler(r).
+		Get("/games/"+g.ID.String()+"/join").
+		Query("invite", code).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	if !listed() {
+		t.Errorf("private game with id %s doesn't show up for its participant", g.ID)
+	}
+	apitest.New().
+		Handler(r).
+		Get("/games/" + g.ID.String()).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	g.RemoveParticipant(player.Player{Name: "Stranger"})
+	apitest.New().
+		Handler(r).
+		Post("/games/" + g.ID.String() + "/join").
+		JSON(`{"password": "secret"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+}
+
+func TestListGamesPagination(t *testing.T) {
+	player.NewPlayer("Tick", "")
+	player.NewPlayer("Trick", "")
+	player.NewPlayer("Track", "")
+	game.AllGames = []*game.Game{}
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		g, _ := game.NewGame(12+i%2, 12, 5, "Paged Game", 3, "Tick")
+		g.CreationDate = start.Add(time.Duration(i) * time.Minute)
+		if i%2 == 0 {
+			g.AddParticipant(player.Player{Name: "Trick"})
 		}
+	}
+	private, _ := game.NewGame(12, 12, 5, "Private Game", 2, "Track")
+	private.Private = true
+	r := withPlayername("Tick", http.HandlerFunc(ListGames))
 
+	list := func(query string) ListGamesResponseBody {
+		var body ListGamesResponseBody
+		params, _ := url.ParseQuery(query)
 		apitest.New().
-			EnableNetworking(cli).
-			Post("http://127.0.0.1:8080/games").
-			Body(`{}`).
+			Handler(r).
+			Get("/games").
+			QueryCollection(params).
 			Expect(t).
 			Status(http.StatusOK).
-			End()
+			End().
+			JSON(&body)
+		return body
+	}
+
+	first := list("limit=2")
+	if first.Total != 5 || len(first.Games) != 2 || len(first.NextCursor) == 0 {
+		t.Fatalf("expected first page of 2 out of 5 games, got %d of %d", len(first.Games), first.Total)
+	}
+	if !first.Games[0].CreationDate.After(first.Games[1].CreationDate) {
+		t.Errorf("expected newest games first")
+	}
+	seen := map[string]bool{}
+	for page := first; ; page = list("limit=2&cursor=" + page.NextCursor) {
+		for _, g := range page.Games {
+			if seen[g.ID] {
+				t.Errorf("game %s listed twice", g.ID)
+			}
+			seen[g.ID] = true
+		}
+		if len(page.NextCursor) == 0 {
+			break
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("expected to page through 5 games, got %d", len(seen))
+	}
+
+	if b := list("participant=Trick&size_x=12"); b.Total != 3 {
+		t.Errorf("expected 3 games of Trick on 12x12 boards, got %d", b.Total)
+	}
+	if b := list("sort=free_slots&order=desc&min_free_slots=2"); b.Total != 2 || b.Games[0].FreeSlots != 2 {
+		t.Errorf("expected 2 games with 2 free slots, got %d", b.Total)
+	}
+	after := url.QueryEscape(start.Add(90 * time.Second).Format(time.RFC3339))
+	if b := list("order=asc&created_after=" + after); b.Total != 3 || !b.Games[0].CreationDate.Before(b.Games[1].CreationDate) {
+		t.Errorf("expected 3 games created after %s, oldest first, got %d", after, b.Total)
+	}
 
-		finish <- struct{}{}
-	}()
-	<-finish
+	apitest.New().
+		Handler(r).
+		Get("/games").
+		Query("sort", "free_slots").
+		Query("cursor", first.NextCursor).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
 }
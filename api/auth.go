@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"golang_battleship/player"
 	"net/http"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -13,14 +14,27 @@ import (
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 	"github.com/gorilla/csrf"
-	log "github.com/sirupsen/logrus"
 )
 
 type battleshipContextKey string
 
-type jwtBlacklist map[string]int64
+type jwtBlacklist struct {
+	tokens map[string]int64
+	mu     sync.Mutex
+}
+
+// jwtSessions keeps track of the tokens issued per player, mapping their jwt ids to their expiry.
+type jwtSessions struct {
+	sessions map[string]map[string]int64
+	mu       sync.Mutex
+}
+
+var JWTBlacklist = jwtBlacklist{tokens: make(map[string]int64)}
+
+var JWTSessions = jwtSessions{sessions: make(map[string]map[string]int64)}
 
-var JWTBlacklist = jwtBlacklist{}
+// JWTLifetime is the time until jwts issued by Login expire.
+var JWTLifetime = time.Hour
 
 type LoginBody struct {
 	Playername string `json:"playername"`
@@ -28,23 +42,143 @@ type LoginBody struct {
 }
 
 func (j *jwtBlacklist) Blacklist(jwtID string, expiry int64) {
-	i := *j //not sure why this can't be done in one line
-	i[jwtID] = expiry
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.tokens[jwtID] = expiry
 }
 
 func (j *jwtBlacklist) isBlacklisted(jwtID string) bool {
-	i := *j
-	if _, ok := i[jwtID]; !ok {
-		return false
-	}
-	return true
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, ok := j.tokens[jwtID]
+	return ok
+}
+
+// size returns the number of blacklisted tokens.
+func (j *jwtBlacklist) size() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.tokens)
 }
 
 func (j *jwtBlacklist) PurgeExpiredTokens() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
 	now := time.Now().Unix()
-	for id, expiry := range *j {
+	for id, expiry := range j.tokens {
 		if expiry < now {
-			delete(*j, id)
+			delete(j.tokens, id)
+		}
+	}
+}
+
+// Snapshot returns the blacklisted jwt ids by their expiry, for persisting them.
+func (j *jwtBlacklist) Snapshot() map[string]int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	tokens := make(map[string]int64, len(j.tokens))
+	for id, expiry := range j.tokens {
+		tokens[id] = expiry
+	}
+	return tokens
+}
+
+// Restore blacklists the persisted jwt ids which haven't expired yet.
+func (j *jwtBlacklist) Restore(tokens map[string]int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now().Unix()
+	for id, expiry := range tokens {
+		if expiry >= now {
+			j.tokens[id] = expiry
+		}
+	}
+}
+
+func (s *jwtSessions) add(playername string, jwtID string, expiry int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[playername]; !ok {
+		s.sessions[playername] = make(map[string]int64)
+	}
+	s.sessions[playername][jwtID] = expiry
+}
+
+func (s *jwtSessions) remove(playername string, jwtID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions[playername], jwtID)
+}
+
+// count returns the number of sessions playername has open.
+func (s *jwtSessions) count(playername string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions[playername])
+}
+
+// RevokeAll blacklists every token issued to playername.
+func (s *jwtSessions) RevokeAll(playername string) {
+	s.RevokeOthers(playername, "")
+}
+
+// RevokeOthers blacklists every token issued to playername except the one
+// with the id keepJwtID, which stays valid.
+func (s *jwtSessions) RevokeOthers(playername string, keepJwtID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for jwtID, expiry := range s.sessions[playername] {
+		if jwtID == keepJwtID {
+			continue
+		}
+		JWTBlacklist.Blacklist(jwtID, expiry)
+		delete(s.sessions[playername], jwtID)
+	}
+	if len(s.sessions[playername]) == 0 {
+		delete(s.sessions, playername)
+	}
+}
+
+// Snapshot returns the jwt ids issued per player by their expiry, for
+// persisting them.
+func (s *jwtSessions) Snapshot() map[string]map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make(map[string]map[string]int64, len(s.sessions))
+	for playername, ids := range s.sessions {
+		sessions[playername] = make(map[string]int64, len(ids))
+		for id, expiry := range ids {
+			sessions[playername][id] = expiry
+		}
+	}
+	return sessions
+}
+
+// Restore tracks the persisted sessions which haven't expired yet, so they
+// can still be revoked.
+func (s *jwtSessions) Restore(sessions map[string]map[string]int64) {
+	now := time.Now().Unix()
+	for playername, ids := range sessions {
+		for id, expiry := range ids {
+			if expiry >= now {
+				s.add(playername, id, expiry)
+			}
+		}
+	}
+}
+
+func (s *jwtSessions) PurgeExpiredSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().Unix()
+	for playername, sessions := range s.sessions {
+		for id, expiry := range sessions {
+			if expiry < now {
+				delete(sessions, id)
+			}
+		}
+		if len(sessions) == 0 {
+			delete(s.sessions, playername)
 		}
 	}
 }
@@ -55,14 +189,26 @@ func hashPassword(password string, rehashCount int) (string, error) {
 }
 
 func createToken(signingKey []byte, user string, expiresInSeconds int) (string, error) {
+	return signToken(Key{Secret: string(signingKey)}, user, expiresInSeconds)
+}
+
+// signToken creates a jwt signed with key, carrying its ID as kid header.
+func signToken(key Key, user string, expiresInSeconds int) (string, error) {
 	t := jwt.New(jwt.GetSigningMethod("HS256"))
+	if len(key.ID) > 0 {
+		t.Header["kid"] = key.ID
+	}
 	jwtID := uuid.New()
-	t.Claims = &jwt.StandardClaims{
+	claims := &jwt.StandardClaims{
 		ExpiresAt: time.Now().Add(time.Second * time.Duration(expiresInSeconds)).Unix(),
 		Id:        jwtID.String(),
 		Subject:   user,
 	}
-	s, err := t.SignedString(signingKey)
+	t.Claims = claims
+	s, err := t.SignedString([]byte(key.Secret))
+	if err == nil {
+		JWTSessions.add(user, claims.Id, claims.ExpiresAt)
+	}
 	return s, err
 }
 
@@ -72,6 +218,16 @@ func getPlayerFromContext(r *http.Request) (player.Player, error) {
 	return player.GetByName(c.Value(playernameKey).(string))
 }
 
+func getPlayernameFromContext(r *http.Request) (string, error) {
+	var playernameKey battleshipContextKey = "jwtPlayername"
+	c := r.Context()
+	v, ok := c.Value(playernameKey).(string)
+	if !ok {
+		return "", fmt.Errorf("jwt payload key jwtPlayername missing in context")
+	}
+	return v, nil
+}
+
 func getJwtExpiryFromContext(r *http.Request) (int64, error) {
 	var expiryKey battleshipContextKey = "jwtExpiry"
 	c := r.Context()
@@ -94,10 +250,13 @@ func getJwtIDFromContext(r *http.Request) (string, error) {
 
 func Logout(w http.ResponseWriter, r *http.Request, jwtID string, jwtExpiry int64) {
 	JWTBlacklist.Blacklist(jwtID, jwtExpiry)
+	if playername, err := getPlayernameFromContext(r); err == nil {
+		JWTSessions.remove(playername, jwtID)
+	}
 	http.Redirect(w, r, "/login.html", http.StatusSeeOther)
 }
 
-func Login(w http.ResponseWriter, r *http.Request, jwtsigningkey []byte) {
+func Login(w http.ResponseWriter, r *http.Request, jwtSigningKey Key) {
 	var b LoginBody
 	b.Playername = r.PostFormValue("playername")
 	b.Password = r.PostFormValue("password")
@@ -105,31 +264,44 @@ func Login(w http.ResponseWriter, r *http.Request, jwtsigningkey []byte) {
 		decoder := json.NewDecoder(r.Body)
 		err := decoder.Decode(&b)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(err.Error()))
+			JSONErrorCodeResponse(w, http.StatusUnauthorized, ErrInvalidCredentials, "Failed to decode login body")
 			return
 		}
 	}
+	ip := remoteIP(r)
+	if wait := LoginThrottler.RetryAfter(b.Playername, ip); wait > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(wait.Seconds())+1))
+		JSONErrorResponse(w, http.StatusTooManyRequests, "Too many failed logins")
+		return
+	}
 	p, err := player.GetByName(b.Playername)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+		LoginThrottler.Failure(b.Playername, ip, "unknown player")
+		logins.WithLabelValues("failure").Inc()
+		JSONErrorCodeResponse(w, http.StatusUnauthorized, ErrInvalidCredentials, "Unknown player name or wrong password")
 		return
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(p.PasswordHash), []byte(b.Password)); err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
+		LoginThrottler.Failure(b.Playername, ip, "wrong password")
+		logins.WithLabelValues("failure").Inc()
+		JSONErrorCodeResponse(w, http.StatusUnauthorized, ErrInvalidCredentials, "Unknown player name or wrong password")
 		return
 	}
+	LoginThrottler.Success(b.Playername)
+	logins.WithLabelValues("success").Inc()
 
-	t, err := createToken(jwtsigningkey, b.Playername, 60*60)
+	t, err := signToken(jwtSigningKey, b.Playername, int(JWTLifetime/time.Second))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		JSONErrorResponse(w, http.StatusInternalServerError, "Failed to create jwt")
 		return
 	}
 	c := http.Cookie{
 		Name:     JWT_COOKIE_NAME,
+		Path:     "/",
 		Value:    t,
 		SameSite: http.SameSiteStrictMode,
 		HttpOnly: true,
+		Secure:   SecureCookies,
 		Expires:  time.Now().AddDate(1, 0, 0),
 	}
 	http.SetCookie(w, &c)
@@ -137,40 +309,76 @@ func Login(w http.ResponseWriter, r *http.Request, jwtsigningkey []byte) {
 	http.Redirect(w, r, "/dashboard.html", http.StatusSeeOther)
 }
 
+// CheckJWT authenticates by the jwt cookie or, for bots and scripts, by an
+// api token sent as bearer token. Requests with api tokens skip the CSRF check.
 func (jwtm JWTMiddleware) CheckJWT(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if secret, ok := bearerToken(r); ok {
+			checkAPIToken(h, w, r, secret)
+			return
+		}
 		c, err := r.Cookie(jwtm.jwtCookieName)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			JSONErrorResponse(w, http.StatusUnauthorized, "Not logged in")
 			return
 		}
+		keys := jwtm.keyRing()
 		t, err := jwt.ParseWithClaims(c.Value, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return jwtm.jwtSigningKey, nil
+			kid, _ := token.Header["kid"].(string)
+			secret, ok := keys.Lookup(kid)
+			if !ok {
+				return nil, fmt.Errorf("unknown or retired key id %q", kid)
+			}
+			return secret, nil
 		})
 		if err != nil {
-			log.Warn("malformed token, ", err)
-			w.WriteHeader(http.StatusUnauthorized)
+			requestLogger(r).Warn("malformed token, ", err)
+			JSONErrorResponse(w, http.StatusUnauthorized, "Invalid or expired jwt")
 			return
 		}
 		if !t.Valid {
-			log.Warn("invalid token")
-			w.WriteHeader(http.StatusUnauthorized)
+			requestLogger(r).Warn("invalid token")
+			JSONErrorResponse(w, http.StatusUnauthorized, "Invalid or expired jwt")
 			return
 		}
 		claims, ok := t.Claims.(*jwt.StandardClaims)
 		if !ok {
-			log.Warn("malformed claims")
-			w.WriteHeader(http.StatusUnauthorized)
+			requestLogger(r).Warn("malformed claims")
+			JSONErrorResponse(w, http.StatusUnauthorized, "Invalid or expired jwt")
 			return
 		}
 		if JWTBlacklist.isBlacklisted(claims.Id) {
-			w.WriteHeader(http.StatusUnauthorized)
+			JSONErrorResponse(w, http.StatusUnauthorized, "The jwt has been revoked")
 			return
 		}
 
+		setRequestPlayername(r, claims.Subject)
 		ctx := context.WithValue(r.Context(), battleshipContextKey("jwtPlayername"), claims.Subject)
 		ctx = context.WithValue(ctx, battleshipContextKey("jwtID"), claims.Id)
 		ctx = context.WithValue(ctx, battleshipContextKey("jwtExpiry"), claims.ExpiresAt)
 		h.ServeHTTP(w, r.Clone(ctx))
 	})
 }
+
+func checkAPIToken(h http.Handler, w http.ResponseWriter, r *http.Request, secret string) {
+	t, err := APITokens.Authenticate(secret)
+	if err != nil {
+		requestLogger(r).Warn(err)
+		JSONErrorResponse(w, http.StatusUnauthorized, "Invalid, expired or revoked api token")
+		return
+	}
+	if !t.Scope.allowedMethod(r.Method) {
+		JSONErrorCodeResponse(w, http.StatusForbidden, ErrInsufficientScope, fmt.Sprintf("api token scope %s doesn't permit %s requests", t.Scope, r.Method))
+		return
+	}
+	setRequestPlayername(r, t.Playername)
+	ctx := context.WithValue(r.Context(), battleshipContextKey("jwtPlayername"), t.Playername)
+	ctx = context.WithValue(ctx, battleshipContextKey("apiTokenScope"), t.Scope)
+	h.ServeHTTP(w, csrf.UnsafeSkipCheck(r.Clone(ctx)))
+}
+
+func getAPITokenScopeFromContext(r *http.Request) (TokenScope, bool) {
+	var scopeKey battleshipContextKey = "apiTokenScope"
+	scope, ok := r.Context().Value(scopeKey).(TokenScope)
+	return scope, ok
+}
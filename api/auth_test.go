@@ -1,16 +1,20 @@
 package api
 
 import (
+	"context"
 	"golang_battleship/cmd"
 	"golang_battleship/game"
 	"golang_battleship/player"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/gorilla/csrf"
 	"github.com/gorilla/mux"
 	"github.com/steinfletcher/apitest"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestGenerateJwtSigningKey(t *testing.T) {
@@ -85,8 +89,7 @@ func TestCreateToken(t *testing.T) {
 
 func TestLogin(t *testing.T) {
 	jwtSigningKey := []byte("abcdefg")
-	finish := make(chan struct{})
-	jwtm := JWTMiddleware{jwtSigningKey: jwtSigningKey, loginHandler: Login}
+	jwtm := JWTMiddleware{jwtSigningKey: jwtSigningKey, jwtCookieName: JWT_COOKIE_NAME, loginHandler: Login}
 	defaultRouter := mux.NewRouter()
 	needsAuthRouter := defaultRouter.Path("/games").Subrouter()
 	needsAuthRouter.Use(jwtm.CheckJWT)
@@ -98,69 +101,341 @@ func TestLogin(t *testing.T) {
 	player.NewPlayer("Dagobert", passwordHashDagobert)
 	game.NewGame(12, 12, 6, "New Game", 2, "Rudolf", "Dagobert")
 
-	go func() {
-		if err := http.ListenAndServe("127.0.0.1:8080", defaultRouter); err != nil {
-			panic(err)
-		}
-	}()
+	srv := httptest.NewServer(defaultRouter)
+	defer srv.Close()
+
+	// the login redirects to the dashboard, which the test server doesn't serve
+	cli := &http.Client{
+		Timeout: time.Second * 10,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	apitest.New().
+		EnableNetworking(cli).
+		Post(srv.URL + "/login").
+		Body("{\"playername\":\"Rudolf\",\"password\":\"BADPASSWORD\"}").
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	apitest.New().
+		EnableNetworking(cli).
+		Post(srv.URL + "/login").
+		Body("{\"playername\":\"Rudolf\"}").
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
 
-	go func() {
-		cli := &http.Client{
-			Timeout: time.Second * 1,
+	apitest.New().
+		EnableNetworking(cli).
+		Post(srv.URL + "/login").
+		Body("{\"playername\":\"Rudolf\",\"password\":\"\x00\"}").
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	loginresponse := apitest.New().
+		EnableNetworking(cli).
+		Post(srv.URL + "/login").
+		Body("{\"playername\":\"Rudolf\",\"password\":\"passwordrudolf\"}").
+		Expect(t).
+		Status(http.StatusSeeOther).
+		CookiePresent(JWT_COOKIE_NAME).
+		End().Response
+
+	var jwtCookie string
+	for _, c := range loginresponse.Cookies() {
+		if c.Name == JWT_COOKIE_NAME {
+			jwtCookie = c.Value
 		}
-		apitest.New().
-			EnableNetworking(cli).
-			Post("http://127.0.0.1:8080/login").
-			Body("{\"playername\":\"Rudolf\",\"password\":\"BADPASSWORD\"}").
-			Expect(t).
-			Status(http.StatusUnauthorized).
-			End()
+	}
+	if jwtCookie == "" {
+		t.Errorf("no cookie was set after logging in, expected cookie with name %s", JWT_COOKIE_NAME)
+		t.Fail()
+	}
 
-		apitest.New().
-			EnableNetworking(cli).
-			Post("http://127.0.0.1:8080/login").
-			Body("{\"playername\":\"Rudolf\"}").
-			Expect(t).
-			Status(http.StatusUnauthorized).
-			End()
+	apitest.New().
+		EnableNetworking(cli).
+		Get(srv.URL+"/games").
+		Cookie(JWT_COOKIE_NAME, jwtCookie).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+}
 
-		apitest.New().
-			EnableNetworking(cli).
-			Post("http://127.0.0.1:8080/login").
-			Body("{\"playername\":\"Rudolf\",\"password\":\"\x00\"}").
-			Expect(t).
-			Status(http.StatusUnauthorized).
-			End()
+func TestProfile(t *testing.T) {
+	passwordHash, _ := hashPassword("oldpassword", PASSWORD_REHASH_COUNT)
+	player.NewPlayer("Gustav", passwordHash)
+	player.NewPlayer("Daisy", "")
+	g, _ := game.NewGame(12, 12, 6, "Profile Game", 2, "Gustav", "Daisy")
+	token, _ := createToken([]byte("abcdefg"), "Gustav", 60)
+	handler := func(h func(w http.ResponseWriter, r *http.Request, p *player.Player)) http.Handler {
+		return withPlayername("Gustav", playerHandler{playerValidator: playerValidator, handler: h})
+	}
+	r := mux.NewRouter()
+	r.Path("/players/me").Methods("GET").Handler(handler(GetProfile))
+	r.Path("/players/me").Methods("PATCH").Handler(handler(UpdateProfile))
+	r.Path("/players/me").Methods("DELETE").Handler(handler(DeleteProfile))
+	r.Path("/players/me/password").Methods("POST").Handler(handler(ChangePassword))
 
-		loginresponse := apitest.New().
-			EnableNetworking(cli).
-			Post("http://127.0.0.1:8080/login").
-			Body("{\"playername\":\"Rudolf\",\"password\":\"passwordrudolf\"}").
-			Expect(t).
-			Status(http.StatusOK).
-			CookiePresent(JWT_COOKIE_NAME).
-			End().Response
-
-		var jwtCookie string
-		for _, c := range loginresponse.Cookies() {
-			if c.Name == JWT_COOKIE_NAME {
-				jwtCookie = c.Value
-			}
+	apitest.New().
+		Handler(r).
+		Patch("/players/me").
+		JSON(`{"display_name": "Gustav Gans", "avatar": "ship", "preferred_board_size": {"size_x": 14, "size_y": 12}, "default_fleet": [{"class": "Carrier", "x": 0, "y": 0, "orientation": "e"}]}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	if profile := player.AllPlayersMap["Gustav"].Profile; profile.DisplayName != "Gustav Gans" || profile.Avatar != "ship" || len(profile.DefaultFleet) != 1 {
+		t.Errorf("profile was not updated, got %+v", profile)
+	}
+
+	apitest.New().
+		Handler(r).
+		Patch("/players/me").
+		JSON(`{"default_fleet": [{"class": "Carrier", "x": 10, "y": 0, "orientation": "e"}]}`).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+
+	apitest.New().
+		Handler(r).
+		Post("/players/me/password").
+		JSON(`{"current_password": "wrongpassword", "new_password": "newpassword"}`).
+		Expect(t).
+		Status(http.StatusForbidden).
+		End()
+
+	apitest.New().
+		Handler(r).
+		Post("/players/me/password").
+		JSON(`{"current_password": "oldpassword", "new_password": "newpassword"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	if bcrypt.CompareHashAndPassword([]byte(player.AllPlayersMap["Gustav"].PasswordHash), []byte("newpassword")) != nil {
+		t.Errorf("password was not changed")
+	}
+
+	apitest.New().
+		Handler(r).
+		Delete("/players/me").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	if _, err := player.GetByName("Gustav"); err == nil {
+		t.Errorf("player Gustav still exists after deletion")
+	}
+	if g.IsParticipant("Gustav") {
+		t.Errorf("deleted player Gustav still participates in game with id %s", g.ID)
+	}
+	if JWTSessions.count("Gustav") > 0 || JWTBlacklist.size() == 0 {
+		t.Errorf("session %s of deleted player Gustav was not revoked", token)
+	}
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	passwordHash, _ := hashPassword("oldpassword", PASSWORD_REHASH_COUNT)
+	player.NewPlayer("Gladstone", passwordHash)
+	createToken([]byte("abcdefg"), "Gladstone", 60)
+	createToken([]byte("abcdefg"), "Gladstone", 60)
+	ids := []string{}
+	JWTSessions.mu.Lock()
+	for id := range JWTSessions.sessions["Gladstone"] {
+		ids = append(ids, id)
+	}
+	JWTSessions.mu.Unlock()
+	current, other := ids[0], ids[1]
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), battleshipContextKey("jwtPlayername"), "Gladstone")
+		ctx = context.WithValue(ctx, battleshipContextKey("jwtID"), current)
+		playerHandler{playerValidator: playerValidator, handler: ChangePassword}.ServeHTTP(w, r.Clone(ctx))
+	})
+
+	apitest.New().
+		Handler(handler).
+		Post("/players/me/password").
+		JSON(`{"current_password": "oldpassword", "new_password": "newpassword"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	if JWTBlacklist.isBlacklisted(current) {
+		t.Errorf("the session the password was changed with was revoked")
+	}
+	if !JWTBlacklist.isBlacklisted(other) || JWTSessions.count("Gladstone") != 1 {
+		t.Errorf("the other session of Gladstone was not revoked")
+	}
+}
+
+func TestRestoreSkipsExpired(t *testing.T) {
+	expired, valid := time.Now().Add(-time.Hour).Unix(), time.Now().Add(time.Hour).Unix()
+	blacklist := jwtBlacklist{tokens: make(map[string]int64)}
+	blacklist.Restore(map[string]int64{"expired": expired, "valid": valid})
+	if blacklist.isBlacklisted("expired") || !blacklist.isBlacklisted("valid") {
+		t.Errorf("expected only the valid jwt to be restored, got %v", blacklist.Snapshot())
+	}
+	sessions := jwtSessions{sessions: make(map[string]map[string]int64)}
+	sessions.Restore(map[string]map[string]int64{"Gustav": {"expired": expired, "valid": valid}})
+	if sessions.count("Gustav") != 1 {
+		t.Errorf("expected only the valid session to be restored, got %v", sessions.Snapshot())
+	}
+	tokens := apiTokenStore{tokens: make(map[string]*APIToken)}
+	expiry := time.Now().Add(-time.Hour)
+	tokens.Restore([]StoredAPIToken{
+		{APIToken: APIToken{Playername: "Gustav", Name: "expired", ExpiresAt: &expiry}, Hash: "a"},
+		{APIToken: APIToken{Playername: "Gustav", Name: "valid"}, Hash: "b"},
+	})
+	if restored := tokens.List("Gustav"); len(restored) != 1 || restored[0].Name != "valid" {
+		t.Errorf("expected only the valid api token to be restored, got %+v", restored)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, RequireUpper: true, RequireDigit: true}
+	goodPasswords := []string{"Password1", "ÄÖÜabcdef9", "12345678A"}
+	badPasswords := []string{"", "Pass1", "password1", "Password", strings.Repeat("A1", 40)}
+	for _, p := range goodPasswords {
+		if err := policy.Validate(p); err != nil {
+			t.Errorf("valid password %q failed validation: %s", p, err)
 		}
-		if jwtCookie == "" {
-			t.Errorf("no cookie was set after logging in, expected cookie with name %s", JWT_COOKIE_NAME)
-			t.Fail()
+	}
+	for _, p := range badPasswords {
+		if err := policy.Validate(p); err == nil {
+			t.Errorf("invalid password %q validated successfully", p)
 		}
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	lt := NewLoginThrottle(
+		ThrottlePolicy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutThreshold: 4, LockoutDuration: time.Hour},
+		ThrottlePolicy{FreeAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutThreshold: 100, LockoutDuration: time.Hour},
+	)
+	for i := 0; i < 2; i++ {
+		lt.Failure("Scrooge", "10.0.0.1", "wrong password")
+	}
+	if wait := lt.RetryAfter("Scrooge", "10.0.0.1"); wait != 0 {
+		t.Errorf("expected no delay within free attempts, got %s", wait)
+	}
+	lt.Failure("Scrooge", "10.0.0.1", "wrong password")
+	if wait := lt.RetryAfter("Scrooge", "10.0.0.2"); wait <= 0 || wait > time.Minute {
+		t.Errorf("expected backoff of up to a minute, got %s", wait)
+	}
+	lt.Failure("Scrooge", "10.0.0.1", "wrong password")
+	if wait := lt.RetryAfter("Scrooge", "10.0.0.2"); wait <= time.Minute {
+		t.Errorf("expected lockout of an hour, got %s", wait)
+	}
+	if wait := lt.RetryAfter("Donald", "10.0.0.2"); wait != 0 {
+		t.Errorf("expected other accounts on other ips to be unaffected, got %s", wait)
+	}
+	lt.Success("Scrooge")
+	if wait := lt.RetryAfter("Scrooge", "10.0.0.2"); wait != 0 {
+		t.Errorf("expected successful login to reset the account, got %s", wait)
+	}
 
+	expired := NewLoginThrottle(
+		ThrottlePolicy{FreeAttempts: 0, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, LockoutThreshold: 10, LockoutDuration: 5 * time.Millisecond},
+		ThrottlePolicy{FreeAttempts: 0, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, LockoutThreshold: 10, LockoutDuration: 5 * time.Millisecond},
+	)
+	expired.Failure("Scrooge", "10.0.0.1", "wrong password")
+	expired.Failure("Donald", "10.0.0.2", "wrong password")
+	time.Sleep(10 * time.Millisecond)
+	expired.lastSweep = time.Time{}
+	expired.Failure("Huey", "10.0.0.3", "wrong password")
+	if len(expired.accounts) != 1 || len(expired.ips) != 1 {
+		t.Errorf("expected expired attempts to be dropped, got %d accounts and %d ips", len(expired.accounts), len(expired.ips))
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	player.NewPlayer("Gyro", "")
+	jwtm := JWTMiddleware{jwtSigningKey: []byte("abcdefg"), jwtCookieName: JWT_COOKIE_NAME, loginHandler: Login}
+	r := mux.NewRouter()
+	r.Use(jwtm.CheckJWT, csrf.Protect([]byte("01234567890123456789012345678901")))
+	r.Path("/players/me").Methods("GET").Handler(playerHandler{playerValidator: playerValidator, handler: GetProfile})
+	r.Path("/players/me").Methods("PATCH").Handler(playerHandler{playerValidator: playerValidator, handler: UpdateProfile})
+	r.Path("/players/me/tokens").Methods("GET").Handler(sessionOnly(playerHandler{playerValidator: playerValidator, handler: ListAPITokens}))
+
+	readToken, readSecret, _ := APITokens.Create("Gyro", "scoreboard bot", ScopeRead, 0)
+	_, playSecret, _ := APITokens.Create("Gyro", "player bot", ScopePlay, time.Hour)
+	if _, _, err := APITokens.Create("Gyro", "admin bot", TokenScope("admin"), 0); err == nil {
+		t.Errorf("created api token with unknown scope")
+	}
+
+	apitest.New().
+		Handler(r).
+		Get("/players/me").
+		Header("Authorization", "Bearer "+readSecret).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	if tokens := APITokens.List("Gyro"); len(tokens) != 2 {
+		t.Errorf("expected 2 api tokens, got %d", len(tokens))
+	}
+
+	apitest.New().
+		Handler(r).
+		Patch("/players/me").
+		Header("Authorization", "Bearer "+readSecret).
+		JSON(`{"display_name": "Gyro Gearloose"}`).
+		Expect(t).
+		Status(http.StatusForbidden).
+		End()
+
+	apitest.New().
+		Handler(r).
+		Patch("/players/me").
+		Header("Authorization", "Bearer "+playSecret).
+		JSON(`{"display_name": "Gyro Gearloose"}`).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+
+	apitest.New().
+		Handler(r).
+		Get("/players/me/tokens").
+		Header("Authorization", "Bearer "+playSecret).
+		Expect(t).
+		Status(http.StatusForbidden).
+		End()
+
+	if err := APITokens.Revoke("Gyro", readToken.ID.String()); err != nil {
+		t.Errorf("failed to revoke api token: %s", err)
+	}
+	apitest.New().
+		Handler(r).
+		Get("/players/me").
+		Header("Authorization", "Bearer "+readSecret).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+func TestReadScopeCannotChangeState(t *testing.T) {
+	player.NewPlayer("Mista", "")
+	player.NewPlayer("Fugo", "")
+	g, _ := game.NewGame(12, 12, 1, "Passione", 3, "Mista")
+	router := NewRouter([]byte("abcdefg"), []byte("01234567890123456789012345678901"))
+	_, readSecret, _ := APITokens.Create("Fugo", "scoreboard bot", ScopeRead, 0)
+
+	for _, path := range []string{"/games/" + g.ID.String() + "/join", "/logout", "/arena"} {
 		apitest.New().
-			EnableNetworking(cli).
-			Get("http://127.0.0.1:8080/games").
-			Cookie(JWT_COOKIE_NAME, jwtCookie).
+			Handler(router).
+			Get(API_PREFIX+path).
+			Header("Authorization", "Bearer "+readSecret).
 			Expect(t).
-			Status(http.StatusOK).
+			Status(http.StatusForbidden).
 			End()
+	}
+	if g.IsParticipant("Fugo") {
+		t.Errorf("api token with scope read joined game with id %s", g.ID)
+	}
 
-		finish <- struct{}{}
-	}()
-	<-finish
+	apitest.New().
+		Handler(router).
+		Get(API_PREFIX+"/games/"+g.ID.String()+"/leave").
+		Header("Authorization", "Bearer "+readSecret).
+		Expect(t).
+		Status(http.StatusMethodNotAllowed).
+		End()
 }
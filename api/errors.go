@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/csrf"
+)
+
+// ErrorCode identifies the kind of an error independent of its message,
+// clients should match on the code and only display the message.
+type ErrorCode string
+
+const (
+	ErrBadRequest         ErrorCode = "bad_request"
+	ErrInvalidBody        ErrorCode = "invalid_body"
+	ErrValidationFailed   ErrorCode = "validation_failed"
+	ErrUnauthorized       ErrorCode = "unauthorized"
+	ErrInvalidCredentials ErrorCode = "invalid_credentials"
+	ErrForbidden          ErrorCode = "forbidden"
+	ErrInsufficientScope  ErrorCode = "insufficient_scope"
+	ErrCSRFInvalid        ErrorCode = "csrf_invalid"
+	ErrNotFound           ErrorCode = "not_found"
+	ErrMethodNotAllowed   ErrorCode = "method_not_allowed"
+	ErrTooManyRequests    ErrorCode = "too_many_requests"
+	ErrInternal           ErrorCode = "internal_error"
+)
+
+// ErrorCatalogue lists every error code with the status it is sent with.
+// Codes are never removed or reused for a different meaning.
+var ErrorCatalogue = []ErrorCodeDescription{
+	{Code: ErrBadRequest, Status: http.StatusBadRequest, Description: "The request can't be fulfilled in the current state, e.g. firing out of turn or joining a full game"},
+	{Code: ErrInvalidBody, Status: http.StatusBadRequest, Description: "The request body is not valid JSON or doesn't match the expected schema"},
+	{Code: ErrValidationFailed, Status: http.StatusBadRequest, Description: "One or more fields or query parameters are invalid, see field_errors"},
+	{Code: ErrUnauthorized, Status: http.StatusUnauthorized, Description: "The jwt cookie or api token is missing, invalid, expired or revoked"},
+	{Code: ErrInvalidCredentials, Status: http.StatusUnauthorized, Description: "Unknown player name or wrong password"},
+	{Code: ErrForbidden, Status: http.StatusForbidden, Description: "The player isn't allowed to do this, e.g. only the host may start a game"},
+	{Code: ErrInsufficientScope, Status: http.StatusForbidden, Description: "The scope of the api token doesn't permit the request"},
+	{Code: ErrCSRFInvalid, Status: http.StatusForbidden, Description: "The CSRF token or Referer of an unsafe request is missing or invalid"},
+	{Code: ErrNotFound, Status: http.StatusNotFound, Description: "The path or the resource it refers to doesn't exist"},
+	{Code: ErrMethodNotAllowed, Status: http.StatusMethodNotAllowed, Description: "The path doesn't support the request method"},
+	{Code: ErrTooManyRequests, Status: http.StatusTooManyRequests, Description: "Too many failed logins, retry after the seconds in the Retry-After header"},
+	{Code: ErrInternal, Status: http.StatusInternalServerError, Description: "An unexpected server error"},
+}
+
+// FieldError describes why a single field or query parameter is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// statusErrorCodes are the codes of JSONErrorResponse, handlers pass a more
+// specific code to JSONErrorCodeResponse.
+var statusErrorCodes = map[int]ErrorCode{
+	http.StatusBadRequest:          ErrBadRequest,
+	http.StatusUnauthorized:        ErrUnauthorized,
+	http.StatusForbidden:           ErrForbidden,
+	http.StatusNotFound:            ErrNotFound,
+	http.StatusMethodNotAllowed:    ErrMethodNotAllowed,
+	http.StatusTooManyRequests:     ErrTooManyRequests,
+	http.StatusInternalServerError: ErrInternal,
+}
+
+func ErrorCodes(w http.ResponseWriter, r *http.Request) {
+	JSONResponse(w, http.StatusOK, ErrorCatalogue)
+}
+
+// JSONErrorResponse sends the error envelope with the generic code of httpStatus.
+func JSONErrorResponse(w http.ResponseWriter, httpStatus int, message string) {
+	code, ok := statusErrorCodes[httpStatus]
+	if !ok {
+		code = ErrInternal
+	}
+	JSONErrorCodeResponse(w, httpStatus, code, message)
+}
+
+// JSONErrorCodeResponse sends the error envelope, the request id is taken
+// from the response header set by traceRequest.
+func JSONErrorCodeResponse(w http.ResponseWriter, httpStatus int, code ErrorCode, message string, fieldErrors ...FieldError) {
+	if len(message) == 0 {
+		message = http.StatusText(httpStatus)
+	}
+	body, _ := json.Marshal(ErrorResponseBody{
+		Code:        code,
+		Message:     message,
+		RequestID:   w.Header().Get(REQUEST_ID_HEADER),
+		FieldErrors: fieldErrors,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	w.Write(body)
+}
+
+// JSONValidationErrorResponse rejects a request with an invalid field, err
+// is reported in field_errors as well if it is a FieldError.
+func JSONValidationErrorResponse(w http.ResponseWriter, message string, err error) {
+	fieldErrors := []FieldError{}
+	if fe, ok := err.(FieldError); ok {
+		fieldErrors = append(fieldErrors, fe)
+	}
+	JSONErrorCodeResponse(w, http.StatusBadRequest, ErrValidationFailed, fmt.Sprintf("%s, %s", message, err), fieldErrors...)
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	JSONErrorResponse(w, http.StatusNotFound, fmt.Sprintf("no route for %s", r.URL.Path))
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	JSONErrorResponse(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s isn't supported by %s", r.Method, r.URL.Path))
+}
+
+func csrfFailure(w http.ResponseWriter, r *http.Request) {
+	JSONErrorCodeResponse(w, http.StatusForbidden, ErrCSRFInvalid, csrf.FailureReason(r).Error())
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang_battleship/player"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/steinfletcher/apitest"
+)
+
+// expectError asserts the error envelope with code, the request id has to
+// match the response header.
+func expectError(code ErrorCode, fields ...string) func(res *http.Response, req *http.Request) error {
+	return func(res *http.Response, req *http.Request) error {
+		var e ErrorResponseBody
+		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
+			return err
+		}
+		if e.Code != code || len(e.Message) == 0 {
+			return fmt.Errorf("expected error code %s with message, got %+v", code, e)
+		}
+		if len(e.RequestID) == 0 || e.RequestID != res.Header.Get(REQUEST_ID_HEADER) {
+			return fmt.Errorf("request id %s doesn't match header %s", e.RequestID, res.Header.Get(REQUEST_ID_HEADER))
+		}
+		if len(e.FieldErrors) != len(fields) {
+			return fmt.Errorf("expected field errors for %v, got %+v", fields, e.FieldErrors)
+		}
+		for i, f := range fields {
+			if e.FieldErrors[i].Field != f {
+				return fmt.Errorf("expected field error for %s, got %+v", f, e.FieldErrors[i])
+			}
+		}
+		return nil
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	signingKey := []byte("abcdefg")
+	router := NewRouter(signingKey, []byte("01234567890123456789012345678901"))
+	player.NewPlayer("Zeppeli", "")
+	_, secret, _ := APITokens.Create("Zeppeli", "envelope test", ScopeRead, 0)
+	jwt, _ := createToken(signingKey, "Zeppeli", 60)
+
+	apitest.New().
+		Handler(router).
+		Get(API_PREFIX + "/games").
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		Assert(expectError(ErrUnauthorized)).
+		End()
+
+	apitest.New().
+		Handler(router).
+		Get(API_PREFIX+"/games").
+		Header("Authorization", "Bearer bst_invalid").
+		Header(REQUEST_ID_HEADER, "trace-42").
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		Header(REQUEST_ID_HEADER, "trace-42").
+		Assert(expectError(ErrUnauthorized)).
+		End()
+
+	query, _ := url.ParseQuery("limit=0")
+	apitest.New().
+		Handler(router).
+		Get(API_PREFIX+"/games").
+		QueryCollection(query).
+		Header("Authorization", "Bearer "+secret).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		Assert(expectError(ErrValidationFailed, "limit")).
+		End()
+
+	apitest.New().
+		Handler(router).
+		Post(API_PREFIX+"/games").
+		Header("Authorization", "Bearer "+secret).
+		JSON(`{}`).
+		Expect(t).
+		Status(http.StatusForbidden).
+		Assert(expectError(ErrInsufficientScope)).
+		End()
+
+	apitest.New().
+		Handler(router).
+		Post(API_PREFIX+"/games").
+		Cookie(JWT_COOKIE_NAME, jwt).
+		JSON(`{}`).
+		Expect(t).
+		Status(http.StatusForbidden).
+		Assert(expectError(ErrCSRFInvalid)).
+		End()
+
+	apitest.New().
+		Handler(router).
+		Post(API_PREFIX + "/login").
+		JSON(`{"playername": "Zeppeli", "password": "wrong"}`).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		Assert(expectError(ErrInvalidCredentials)).
+		End()
+
+	apitest.New().
+		Handler(router).
+		Get(API_PREFIX + "/nonexistent").
+		Expect(t).
+		Status(http.StatusNotFound).
+		Assert(expectError(ErrNotFound)).
+		End()
+}
+
+func TestErrorCatalogue(t *testing.T) {
+	codes := map[ErrorCode]int{}
+	for _, c := range ErrorCatalogue {
+		if _, ok := codes[c.Code]; ok {
+			t.Errorf("error code %s listed twice", c.Code)
+		}
+		codes[c.Code] = c.Status
+	}
+	for status, code := range statusErrorCodes {
+		if codes[code] != status {
+			t.Errorf("error code %s of status %d is not in the catalogue", code, status)
+		}
+	}
+}
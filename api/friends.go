@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// storedPlayer returns the registered player behind the copy p, answering
+// with not found if they have been deleted meanwhile.
+func storedPlayer(w http.ResponseWriter, p *player.Player) (*player.Player, bool) {
+	stored, ok := player.Lookup(p.Name)
+	if !ok {
+		JSONErrorResponse(w, http.StatusNotFound, fmt.Sprintf("player name %s doesnt exist", p.Name))
+	}
+	return stored, ok
+}
+
+// ListFriends returns the friends of p with their presence and the pending
+// friend requests.
+func ListFriends(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	stored, ok := storedPlayer(w, p)
+	if !ok {
+		return
+	}
+	friends, requests := stored.Friendships()
+	b := FriendsResponseBody{Friends: []FriendStatus{}, Requests: requests, Sent: stored.SentFriendRequests()}
+	for _, name := range friends {
+		status, g := live.presence(name)
+		f := FriendStatus{Name: name, Presence: status}
+		if g != nil {
+			f.GameID = g.ID.String()
+		}
+		b.Friends = append(b.Friends, f)
+	}
+	JSONResponse(w, http.StatusOK, b)
+}
+
+// RequestFriend sends a friend request, accepting a pending one of the other player.
+func RequestFriend(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	decoder := json.NewDecoder(r.Body)
+	var b FriendRequestBody
+	if err := decoder.Decode(&b); err != nil {
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
+		return
+	}
+	stored, ok := storedPlayer(w, p)
+	if !ok {
+		return
+	}
+	accepted, err := stored.RequestFriendship(b.Playername)
+	if err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to send friend request, %s", err))
+		return
+	}
+	notification := LiveFriendRequest
+	if accepted {
+		notification = LiveFriendAccepted
+	}
+	live.notify(b.Playername, LiveServerMessage{Type: notification, Player: p.Name})
+	ListFriends(w, r, p)
+}
+
+func AcceptFriend(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	name := mux.Vars(r)["name"]
+	stored, ok := storedPlayer(w, p)
+	if !ok {
+		return
+	}
+	if err := stored.AcceptFriendship(name); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to accept friend request, %s", err))
+		return
+	}
+	live.notify(name, LiveServerMessage{Type: LiveFriendAccepted, Player: p.Name})
+	ListFriends(w, r, p)
+}
+
+// RemoveFriend ends a friendship, or declines or withdraws a friend request.
+func RemoveFriend(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	stored, ok := storedPlayer(w, p)
+	if !ok {
+		return
+	}
+	if err := stored.RemoveFriendship(mux.Vars(r)["name"]); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to remove friend, %s", err))
+		return
+	}
+	ListFriends(w, r, p)
+}
+
+// ListInvites returns the pending invites of p to games which are still open.
+func ListInvites(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	stored, ok := storedPlayer(w, p)
+	if !ok {
+		return
+	}
+	invites := ListInvitesResponseBody{}
+	for _, i := range stored.PendingInvites() {
+		if g, err := game.GetByUUID(i.GameID); err == nil && g.State == game.StateOpen && !g.IsParticipant(p.Name) {
+			invites = append(invites, i)
+		}
+	}
+	JSONResponse(w, http.StatusOK, invites)
+}
+
+// inviteFriend checks that friend may be invited to g by p.
+func inviteFriend(p *player.Player, g *game.Game, friend string) (*player.Player, error) {
+	stored, ok := player.Lookup(p.Name)
+	if !ok || !stored.IsFriend(friend) {
+		return nil, fmt.Errorf("%s is no friend of %s", friend, p.Name)
+	}
+	f, ok := player.Lookup(friend)
+	if !ok {
+		return nil, fmt.Errorf("no player with name \"%s\" found", friend)
+	}
+	if g.State != game.StateOpen {
+		return nil, fmt.Errorf("game with id %s is not open", g.ID)
+	}
+	if g.IsParticipant(friend) {
+		return nil, fmt.Errorf("%s already participates in game with id %s", friend, g.ID)
+	}
+	return f, nil
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+func TestFriendsAndInvites(t *testing.T) {
+	player.NewPlayer("Jonathan", "")
+	player.NewPlayer("Speedwagon", "")
+	player.NewPlayer("Dio", "")
+	router := NewRouter([]byte("abcdefg"), []byte("01234567890123456789012345678901"))
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	secrets := map[string]string{}
+	for _, name := range []string{"Jonathan", "Speedwagon", "Dio"} {
+		_, secrets[name], _ = APITokens.Create(name, "friends test", ScopePlay, 0)
+	}
+	do := func(name string, method string, path string, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, API_PREFIX+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+secrets[name])
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	friends := func(name string) FriendsResponseBody {
+		var b FriendsResponseBody
+		json.NewDecoder(do(name, http.MethodGet, "/players/me/friends", "").Body).Decode(&b)
+		return b
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+secrets["Speedwagon"])
+	notifications, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+API_PREFIX+"/players/me/ws", header)
+	if err != nil {
+		t.Fatalf("failed to connect to notifications: %s", err)
+	}
+	defer notifications.Close()
+	readLive(t, notifications, LiveWelcome)
+
+	if rec := do("Jonathan", http.MethodPost, "/players/me/friends", `{"name": "Speedwagon"}`); rec.Code != http.StatusOK {
+		t.Fatalf("failed to send friend request, got %d %s", rec.Code, rec.Body)
+	}
+	if m := readLive(t, notifications, LiveFriendRequest); m.Player != "Jonathan" {
+		t.Errorf("expected friend request of Jonathan, got %+v", m)
+	}
+	if b := friends("Speedwagon"); len(b.Requests) != 1 || b.Requests[0] != "Jonathan" {
+		t.Errorf("expected pending request of Jonathan, got %+v", b)
+	}
+	if b := friends("Jonathan"); len(b.Sent) != 1 || len(b.Friends) != 0 {
+		t.Errorf("expected sent request, got %+v", b)
+	}
+	g, _ := game.NewGame(12, 12, 5, "Phantom Blood", 2, "Jonathan")
+	g.Private = true
+	if rec := do("Jonathan", http.MethodPost, "/games/"+g.ID.String()+"/invites", `{"friend": "Speedwagon"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invited a player who isn't a friend yet, got %d", rec.Code)
+	}
+	if rec := do("Speedwagon", http.MethodPost, "/players/me/friends/Jonathan/accept", ""); rec.Code != http.StatusOK {
+		t.Fatalf("failed to accept friend request, got %d %s", rec.Code, rec.Body)
+	}
+	if b := friends("Jonathan"); len(b.Friends) != 1 || b.Friends[0].Name != "Speedwagon" || b.Friends[0].Presence != PresenceOnline {
+		t.Errorf("expected Speedwagon online, got %+v", b)
+	}
+
+	if rec := do("Dio", http.MethodPost, "/games/"+g.ID.String()+"/invites", `{"friend": "Speedwagon"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("non participant invited to game, got %d", rec.Code)
+	}
+	rec := do("Jonathan", http.MethodPost, "/games/"+g.ID.String()+"/invites", `{"friend": "Speedwagon"}`)
+	var invite InviteResponseBody
+	if err := json.NewDecoder(rec.Body).Decode(&invite); err != nil || rec.Code != http.StatusOK || invite.Friend != "Speedwagon" {
+		t.Fatalf("failed to invite friend, got %d, %v", rec.Code, err)
+	}
+	if m := readLive(t, notifications, LiveInvite); m.Invite == nil || m.Invite.GameID != g.ID.String() || m.Invite.Code != invite.Code || m.Invite.From != "Jonathan" {
+		t.Errorf("expected invite to %s, got %+v", g.ID, m)
+	}
+	var invites ListInvitesResponseBody
+	json.NewDecoder(do("Speedwagon", http.MethodGet, "/players/me/invites", "").Body).Decode(&invites)
+	if len(invites) != 1 || invites[0].Code != invite.Code {
+		t.Errorf("expected pending invite, got %+v", invites)
+	}
+	if rec := do("Speedwagon", http.MethodPost, "/games/"+g.ID.String()+"/join", `{"invite": "`+invite.Code+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("failed to join with invite, got %d %s", rec.Code, rec.Body)
+	}
+
+	conn, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+API_PREFIX+"/games/"+g.ID.String()+"/ws", header)
+	if err != nil {
+		t.Fatalf("failed to connect to game: %s", err)
+	}
+	readLive(t, conn, LiveWelcome)
+	if b := friends("Jonathan"); b.Friends[0].Presence != PresenceInLobby || b.Friends[0].GameID != g.ID.String() {
+		t.Errorf("expected Speedwagon in lobby, got %+v", b.Friends[0])
+	}
+	g.StartDeployment()
+	if b := friends("Jonathan"); b.Friends[0].Presence != PresenceInGame {
+		t.Errorf("expected Speedwagon in game, got %+v", b.Friends[0])
+	}
+	conn.Close()
+	notifications.Close()
+	presence := ""
+	for i := 0; i < 100 && presence != PresenceOffline; i++ {
+		time.Sleep(10 * time.Millisecond)
+		presence = friends("Jonathan").Friends[0].Presence
+	}
+	if presence != PresenceOffline {
+		t.Errorf("expected Speedwagon offline after disconnecting, got %s", presence)
+	}
+
+	if rec := do("Speedwagon", http.MethodDelete, "/players/me/friends/Jonathan", ""); rec.Code != http.StatusOK || len(friends("Jonathan").Friends) != 0 {
+		t.Errorf("failed to remove friend, got %d", rec.Code)
+	}
+}
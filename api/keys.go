@@ -0,0 +1,244 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/securecookie"
+)
+
+// the cookie name and max age gorilla/csrf uses by default
+const (
+	csrfCookieName = "_gorilla_csrf"
+	csrfMaxAge     = 12 * 60 * 60
+)
+
+// Key is a JWT signing or CSRF auth key, jwts carry its ID as kid header.
+type Key struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+// KeyFile holds the keys read from the key file, the first key of each list
+// is the current one, the others are only accepted for the grace period.
+type KeyFile struct {
+	JWT  []Key `json:"jwt"`
+	CSRF []Key `json:"csrf"`
+}
+
+type retiredKey struct {
+	Key
+	until time.Time
+}
+
+// KeyRing holds the current key, which signs, and the previous keys, which
+// are still accepted until their grace period ends.
+type KeyRing struct {
+	mu       sync.RWMutex
+	grace    time.Duration
+	current  Key
+	previous []retiredKey
+}
+
+func NewKeyRing(grace time.Duration, keys ...Key) (*KeyRing, error) {
+	k := &KeyRing{grace: grace}
+	if err := k.Rotate(keys...); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// StaticKeyRing holds a single key without ID, for a key from the env.
+func StaticKeyRing(secret []byte) *KeyRing {
+	return &KeyRing{current: Key{Secret: string(secret)}}
+}
+
+func (k *KeyRing) Current() Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+// Lookup returns the secret of the key with id, if it's the current key or
+// a previous one within its grace period. An empty id only matches the
+// current key, tokens issued before key IDs were introduced lack one.
+func (k *KeyRing) Lookup(id string) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if id == k.current.ID {
+		return []byte(k.current.Secret), true
+	}
+	now := time.Now()
+	for _, r := range k.previous {
+		if r.ID == id && r.until.After(now) {
+			return []byte(r.Secret), true
+		}
+	}
+	return nil, false
+}
+
+// accepted returns the secrets of the previous keys within their grace period.
+func (k *KeyRing) accepted() [][]byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	now := time.Now()
+	secrets := [][]byte{}
+	for _, r := range k.previous {
+		if r.until.After(now) {
+			secrets = append(secrets, []byte(r.Secret))
+		}
+	}
+	return secrets
+}
+
+// Rotate makes the first of keys the current key. The replaced current key
+// and the others in keys are accepted for the grace period, keys retired
+// before keep their grace period.
+func (k *KeyRing) Rotate(keys ...Key) error {
+	if err := validateKeys(keys); err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := time.Now()
+	previous := []retiredKey{}
+	retire := func(key Key, until time.Time) {
+		if key.ID == keys[0].ID || len(key.Secret) == 0 || !until.After(now) {
+			return
+		}
+		for _, r := range previous {
+			if r.ID == key.ID {
+				return
+			}
+		}
+		previous = append(previous, retiredKey{key, until})
+	}
+	for _, r := range k.previous {
+		retire(r.Key, r.until)
+	}
+	retire(k.current, now.Add(k.grace))
+	for _, key := range keys[1:] {
+		retire(key, now.Add(k.grace))
+	}
+	k.current = keys[0]
+	k.previous = previous
+	return nil
+}
+
+func validateKeys(keys []Key) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys given")
+	}
+	ids := map[string]bool{}
+	for _, key := range keys {
+		if len(key.Secret) == 0 {
+			return fmt.Errorf("key %q has an empty secret", key.ID)
+		}
+		if len(keys) > 1 && len(key.ID) == 0 {
+			return fmt.Errorf("keys need an id if there are several")
+		}
+		if ids[key.ID] {
+			return fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		ids[key.ID] = true
+	}
+	return nil
+}
+
+// LoadKeyFile reads the JSON key file at path.
+func LoadKeyFile(path string) (KeyFile, error) {
+	var f KeyFile
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return f, fmt.Errorf("failed to read key file: %s", err)
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return f, fmt.Errorf("failed to parse key file %s: %s", path, err)
+	}
+	if err := validateKeys(f.JWT); err != nil {
+		return f, fmt.Errorf("bad jwt keys in %s: %s", path, err)
+	}
+	if err := validateKeys(f.CSRF); err != nil {
+		return f, fmt.Errorf("bad csrf keys in %s: %s", path, err)
+	}
+	for _, key := range f.CSRF {
+		if len(key.Secret) != 32 {
+			return f, fmt.Errorf("csrf key %q has to be 32 bytes long, got %d", key.ID, len(key.Secret))
+		}
+	}
+	return f, nil
+}
+
+func csrfCodec(secret []byte) *securecookie.SecureCookie {
+	sc := securecookie.New(secret, nil)
+	sc.SetSerializer(securecookie.JSONEncoder{})
+	sc.MaxAge(csrfMaxAge)
+	return sc
+}
+
+// csrfProtect checks CSRF tokens with the current key of keys. Cookies signed
+// with a previous key are signed again with the current one, so the tokens
+// handed out before a rotation stay valid.
+func csrfProtect(keys *KeyRing, opts ...csrf.Option) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		var mu sync.Mutex
+		var protectedWith Key
+		var protected http.Handler
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			current := keys.Current()
+			mu.Lock()
+			if protected == nil || protectedWith != current {
+				protected = csrf.Protect([]byte(current.Secret), opts...)(h)
+				protectedWith = current
+			}
+			p := protected
+			mu.Unlock()
+			resignCSRFCookie(keys, current, w, r)
+			p.ServeHTTP(w, r)
+		})
+	}
+}
+
+func resignCSRFCookie(keys *KeyRing, current Key, w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(csrfCookieName)
+	if err != nil {
+		return
+	}
+	var token []byte
+	if csrfCodec([]byte(current.Secret)).Decode(csrfCookieName, c.Value, &token) == nil {
+		return
+	}
+	for _, secret := range keys.accepted() {
+		if csrfCodec(secret).Decode(csrfCookieName, c.Value, &token) != nil {
+			continue
+		}
+		encoded, err := csrfCodec([]byte(current.Secret)).Encode(csrfCookieName, token)
+		if err != nil {
+			return
+		}
+		cookies := r.Cookies()
+		r.Header.Del("Cookie")
+		for _, rc := range cookies {
+			if rc.Name == csrfCookieName {
+				rc.Value = encoded
+			}
+			r.AddCookie(rc)
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     csrfCookieName,
+			Value:    encoded,
+			Path:     "/",
+			MaxAge:   csrfMaxAge,
+			Expires:  time.Now().Add(csrfMaxAge * time.Second),
+			HttpOnly: true,
+			Secure:   SecureCookies,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return
+	}
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"golang_battleship/player"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/csrf"
+)
+
+func TestKeyRing(t *testing.T) {
+	k1, k2, k3 := Key{"k1", "secret1"}, Key{"k2", "secret2"}, Key{"k3", "secret3"}
+	ring, err := NewKeyRing(time.Hour, k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ring.Rotate(k2, k3); err != nil {
+		t.Fatal(err)
+	}
+	if ring.Current() != k2 {
+		t.Errorf("expected k2 to be current, got %+v", ring.Current())
+	}
+	for _, k := range []Key{k1, k2, k3} {
+		if secret, ok := ring.Lookup(k.ID); !ok || string(secret) != k.Secret {
+			t.Errorf("expected %s to be accepted", k.ID)
+		}
+	}
+	if secret, ok := ring.Lookup(""); ok || secret != nil {
+		t.Errorf("token without kid matched a key other than the current one")
+	}
+
+	noGrace, _ := NewKeyRing(0, k1)
+	noGrace.Rotate(k2)
+	if _, ok := noGrace.Lookup("k1"); ok {
+		t.Errorf("previous key accepted without grace period")
+	}
+
+	for _, bad := range [][]Key{{}, {{"k1", ""}}, {k1, {"", "secret"}}, {k1, {"k1", "other"}}} {
+		if err := ring.Rotate(bad...); err == nil {
+			t.Errorf("invalid keys %+v were accepted", bad)
+		}
+	}
+	if ring.Current() != k2 {
+		t.Errorf("failed rotation changed the current key")
+	}
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "keys.json")
+		os.WriteFile(path, []byte(content), 0600)
+		return path
+	}
+	f, err := LoadKeyFile(write(`{"jwt": [{"id": "2", "secret": "new"}, {"id": "1", "secret": "old"}], "csrf": [{"id": "1", "secret": "01234567890123456789012345678901"}]}`))
+	if err != nil || len(f.JWT) != 2 || f.JWT[0].ID != "2" || f.CSRF[0].ID != "1" {
+		t.Errorf("failed to load key file, got %+v, %v", f, err)
+	}
+	for _, bad := range []string{
+		`{"jwt": [{"id": "1", "secret": "s"}], "csrf": [{"id": "1", "secret": "tooshort"}]}`,
+		`{"jwt": [], "csrf": [{"id": "1", "secret": "01234567890123456789012345678901"}]}`,
+		`{"jwt": [{"id": "1", "secret": "s"}, {"id": "1", "secret": "t"}], "csrf": [{"id": "1", "secret": "01234567890123456789012345678901"}]}`,
+		`jwt: []`,
+	} {
+		if _, err := LoadKeyFile(write(bad)); err == nil {
+			t.Errorf("invalid key file %s was accepted", bad)
+		}
+	}
+	if _, err := LoadKeyFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("missing key file was accepted")
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	pw, _ := hashPassword("passwordjoseph", PASSWORD_REHASH_COUNT)
+	player.NewPlayer("Joseph", pw)
+	jwtKeys, _ := NewKeyRing(time.Hour, Key{"k1", "jwtsecret1"})
+	csrfKeys := StaticKeyRing([]byte("01234567890123456789012345678901"))
+	router := NewRouterWithKeys(jwtKeys, csrfKeys)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, API_PREFIX+"/login", strings.NewReader(`{"playername": "Joseph", "password": "passwordjoseph"}`))
+	router.ServeHTTP(rec, req)
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == JWT_COOKIE_NAME {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatalf("login didn't set the jwt cookie, got %d", rec.Code)
+	}
+	token, _, err := new(jwt.Parser).ParseUnverified(cookie.Value, &jwt.StandardClaims{})
+	if err != nil || token.Header["kid"] != "k1" {
+		t.Errorf("expected kid k1 in jwt header, got %v, %v", token, err)
+	}
+
+	getProfile := func(c *http.Cookie) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, API_PREFIX+"/players/me", nil)
+		req.AddCookie(c)
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	jwtKeys.Rotate(Key{"k2", "jwtsecret2"})
+	if code := getProfile(cookie); code != http.StatusOK {
+		t.Errorf("jwt of the previous key rejected within the grace period, got %d", code)
+	}
+	unknown, _ := signToken(Key{"k3", "jwtsecret3"}, "Joseph", 60)
+	if code := getProfile(&http.Cookie{Name: JWT_COOKIE_NAME, Value: unknown}); code != http.StatusUnauthorized {
+		t.Errorf("jwt with unknown kid accepted, got %d", code)
+	}
+	forged, _ := signToken(Key{"k1", "jwtsecret2"}, "Joseph", 60)
+	if code := getProfile(&http.Cookie{Name: JWT_COOKIE_NAME, Value: forged}); code != http.StatusUnauthorized {
+		t.Errorf("jwt with kid of another key accepted, got %d", code)
+	}
+
+	jwtKeys.grace = 0
+	jwtKeys.Rotate(Key{"k4", "jwtsecret4"})
+	jwtKeys.Rotate(Key{"k5", "jwtsecret5"})
+	if code := getProfile(cookie); code != http.StatusOK {
+		t.Errorf("jwt of a key retired earlier lost its grace period, got %d", code)
+	}
+	jwtKeys.previous[0].until = time.Now()
+	if code := getProfile(cookie); code != http.StatusUnauthorized {
+		t.Errorf("jwt accepted after the grace period, got %d", code)
+	}
+}
+
+func TestCSRFKeyRotation(t *testing.T) {
+	keys, _ := NewKeyRing(time.Hour, Key{"k1", "01234567890123456789012345678901"})
+	h := csrfProtect(keys, csrf.Path("/"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-CSRF-Token", csrf.Token(r))
+	}))
+	do := func(method string, token string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set("X-CSRF-Token", token)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	csrfCookie := func(rec *httptest.ResponseRecorder) *http.Cookie {
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == csrfCookieName {
+				return c
+			}
+		}
+		return nil
+	}
+
+	rec := do(http.MethodGet, "", nil)
+	token, cookie := rec.Header().Get("X-CSRF-Token"), csrfCookie(rec)
+	if cookie == nil || len(token) == 0 {
+		t.Fatal("no csrf token handed out")
+	}
+	keys.Rotate(Key{"k2", "abcdefghijabcdefghijabcdefghijab"})
+	rec = do(http.MethodPost, token, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("csrf token of the previous key rejected within the grace period, got %d", rec.Code)
+	}
+	resigned := csrfCookie(rec)
+	if resigned == nil || resigned.Value == cookie.Value {
+		t.Fatal("csrf cookie wasn't signed with the current key")
+	}
+	if rec := do(http.MethodPost, token, resigned); rec.Code != http.StatusOK {
+		t.Errorf("csrf token rejected with the re-signed cookie, got %d", rec.Code)
+	}
+
+	keys.previous[0].until = time.Now()
+	if rec := do(http.MethodPost, token, cookie); rec.Code != http.StatusForbidden {
+		t.Errorf("csrf cookie of the previous key accepted after the grace period, got %d", rec.Code)
+	}
+}
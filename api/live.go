@@ -0,0 +1,414 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	ws "github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// Message types of the game and player WebSockets.
+const (
+	LiveWelcome = "welcome"
+	LiveEvent   = "event"
+	LiveError   = "error"
+	LiveChat    = "chat"
+	LiveMute    = "mute"
+	LiveUnmute  = "unmute"
+
+	LiveFriendRequest  = "friend_request"
+	LiveFriendAccepted = "friend_accepted"
+	LiveInvite         = "invite"
+)
+
+// Presence of a player, derived from their WebSocket connections.
+const (
+	PresenceOffline = "offline"
+	PresenceOnline  = "online"
+	PresenceInLobby = "in_lobby"
+	PresenceInGame  = "in_game"
+)
+
+const (
+	liveSendBuffer     = 64
+	liveMaxMessageSize = 4096
+	liveShutdownReason = "server shutting down"
+)
+
+// liveConn is a WebSocket connection following the events of a game or the
+// notifications of a player. Only its writer goroutine writes messages, fed
+// by send.
+type liveConn struct {
+	conn   *ws.Conn
+	player string
+	send   chan LiveServerMessage
+}
+
+// liveHub passes the events of each game on to its WebSocket connections
+// and notifications to the WebSocket connections of each player.
+type liveHub struct {
+	mu      sync.Mutex
+	games   map[uuid.UUID]map[*liveConn]struct{}
+	players map[string]map[*liveConn]struct{}
+	closing bool
+}
+
+var live = &liveHub{games: map[uuid.UUID]map[*liveConn]struct{}{}, players: map[string]map[*liveConn]struct{}{}}
+
+func init() {
+	game.OnEvent(live.broadcast)
+}
+
+// mayWatch reports whether p may follow the events of g, which participants
+// and moderators may and anyone else unless the game needs an invite.
+func mayWatch(p *player.Player, g *game.Game) bool {
+	return g.IsParticipant(p.Name) || p.Moderator || !g.NeedsAuthorization()
+}
+
+// GameSocket connects p to the events and the chat of g via WebSocket. The
+// query parameter since resumes after the event with that sequence number,
+// so that only the missed events are replayed.
+func GameSocket(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	if !ws.IsWebSocketUpgrade(r) {
+		JSONErrorResponse(w, http.StatusBadRequest, "the game events require a WebSocket upgrade")
+		return
+	}
+	g.Mutex().Lock()
+	watch := mayWatch(p, g)
+	g.Mutex().Unlock()
+	if !watch {
+		JSONErrorResponse(w, http.StatusForbidden, fmt.Sprintf("Only participants may follow game with id %s", g.ID))
+		return
+	}
+	since := 0
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		if since, err = strconv.Atoi(value); err != nil || since < 0 {
+			JSONValidationErrorResponse(w, "Invalid query", FieldError{Field: "since", Message: "since must be a non-negative integer"})
+			return
+		}
+	}
+	upgrader := ws.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		requestLogger(r).Warn("game socket upgrade: ", err)
+		return
+	}
+	webSocketConnections.Inc()
+	defer webSocketConnections.Dec()
+	scope, viaToken := getAPITokenScopeFromContext(r)
+	live.serve(conn, p, g, since, viaToken && !scope.allowedMethod(http.MethodPost))
+}
+
+// PlayerSocket connects p to their notifications via WebSocket, friend
+// requests and invites. Being connected shows p as online to their friends.
+func PlayerSocket(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	if !ws.IsWebSocketUpgrade(r) {
+		JSONErrorResponse(w, http.StatusBadRequest, "notifications require a WebSocket upgrade")
+		return
+	}
+	upgrader := ws.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		requestLogger(r).Warn("player socket upgrade: ", err)
+		return
+	}
+	webSocketConnections.Inc()
+	defer webSocketConnections.Dec()
+	live.servePlayer(conn, p)
+}
+
+// Replay returns the event log of a game which is over, chat included.
+func Replay(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game) {
+	if !mayWatch(p, g) {
+		JSONErrorResponse(w, http.StatusForbidden, fmt.Sprintf("Only participants may replay game with id %s", g.ID))
+		return
+	}
+	if g.State != game.StateFinished && g.State != game.StateAborted {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Game with id %s isn't over yet", g.ID))
+		return
+	}
+	JSONResponse(w, http.StatusOK, ReplayResponseBody{
+		ID:              g.ID.String(),
+		Participants:    g.ListParticipants(),
+		Winner:          g.Winner,
+		BoardParameters: g.BoardParameters,
+		Events:          g.Events(0),
+	})
+}
+
+// serve sends the event history of g after sequence number since followed
+// by its new events until the connection fails, while handling the chat
+// messages of p unless readOnly. Participants whose last connection drops
+// get disconnected from the game, which they may resume within the grace
+// period.
+func (h *liveHub) serve(conn *ws.Conn, p *player.Player, g *game.Game, since int, readOnly bool) {
+	defer conn.Close()
+	c := &liveConn{conn: conn, player: p.Name, send: make(chan LiveServerMessage, liveSendBuffer)}
+	if !h.register(g, c) {
+		c.shutdown()
+		return
+	}
+	defer func() {
+		g.Mutex().Lock()
+		defer g.Mutex().Unlock()
+		if h.deregister(g, c) && g.IsParticipant(p.Name) {
+			g.Disconnect(p.Name)
+		}
+	}()
+	g.Mutex().Lock()
+	if g.IsParticipant(p.Name) {
+		g.Reconnect(p.Name)
+	}
+	// events recorded meanwhile are queued in send, the writer skips the
+	// ones already part of the history
+	history := g.Events(since)
+	g.Mutex().Unlock()
+	last := since
+	if len(history) > 0 {
+		last = history[len(history)-1].Seq
+	}
+	if err := conn.WriteJSON(LiveServerMessage{Type: LiveWelcome, Player: p.Name, Events: history}); err != nil {
+		return
+	}
+	go c.write(last)
+	c.read(func(m LiveClientMessage) error {
+		if readOnly {
+			return fmt.Errorf("the scope of the api token doesn't permit sending messages")
+		}
+		g.Mutex().Lock()
+		defer g.Mutex().Unlock()
+		switch m.Type {
+		case LiveChat:
+			_, err := g.Say(*p, m.Text)
+			return err
+		case LiveMute:
+			return g.Mute(*p, m.Player)
+		case LiveUnmute:
+			return g.Unmute(*p, m.Player)
+		}
+		return fmt.Errorf("unknown message type %q", m.Type)
+	})
+}
+
+// servePlayer sends the notifications of p until the connection fails.
+func (h *liveHub) servePlayer(conn *ws.Conn, p *player.Player) {
+	defer conn.Close()
+	c := &liveConn{conn: conn, player: p.Name, send: make(chan LiveServerMessage, liveSendBuffer)}
+	h.mu.Lock()
+	if h.closing {
+		h.mu.Unlock()
+		c.shutdown()
+		return
+	}
+	if h.players[p.Name] == nil {
+		h.players[p.Name] = map[*liveConn]struct{}{}
+	}
+	h.players[p.Name][c] = struct{}{}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.players[p.Name], c)
+		if len(h.players[p.Name]) == 0 {
+			delete(h.players, p.Name)
+		}
+		close(c.send)
+	}()
+	if err := conn.WriteJSON(LiveServerMessage{Type: LiveWelcome, Player: p.Name}); err != nil {
+		return
+	}
+	go c.write(0)
+	c.read(func(m LiveClientMessage) error {
+		return fmt.Errorf("unknown message type %q", m.Type)
+	})
+}
+
+// notify sends m to the WebSocket connections of playername, if any.
+func (h *liveHub) notify(playername string, m LiveServerMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.players[playername] {
+		if !c.push(m) {
+			c.conn.Close()
+		}
+	}
+}
+
+// presence returns the presence of playername: in game or in lobby while
+// following a game they participate in, which is running or open, online
+// while connected otherwise. The game is returned along.
+func (h *liveHub) presence(playername string) (string, *game.Game) {
+	// serve takes h.mu while holding the game lock, so the followed games
+	// are collected first and locked after releasing h.mu
+	h.mu.Lock()
+	status := PresenceOffline
+	if len(h.players[playername]) > 0 {
+		status = PresenceOnline
+	}
+	following := []uuid.UUID{}
+	for id, conns := range h.games {
+		for c := range conns {
+			if c.player == playername {
+				status = PresenceOnline
+				following = append(following, id)
+				break
+			}
+		}
+	}
+	h.mu.Unlock()
+	var lobby *game.Game
+	for _, id := range following {
+		g, err := game.GetByUUID(id.String())
+		if err != nil {
+			continue
+		}
+		g.Mutex().Lock()
+		participant, state := g.IsParticipant(playername), g.State
+		g.Mutex().Unlock()
+		if !participant {
+			continue
+		}
+		switch state {
+		case game.StateDeployingShips, game.StateRunning:
+			return PresenceInGame, g
+		case game.StateOpen:
+			lobby = g
+		}
+	}
+	if lobby != nil {
+		return PresenceInLobby, lobby
+	}
+	return status, nil
+}
+
+// register tracks c for the events of g, it fails if the server is shutting down.
+func (h *liveHub) register(g *game.Game, c *liveConn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return false
+	}
+	if h.games[g.ID] == nil {
+		h.games[g.ID] = map[*liveConn]struct{}{}
+	}
+	h.games[g.ID][c] = struct{}{}
+	return true
+}
+
+// deregister stops tracking c, it reports whether c was the last connection
+// of its player to g while the server isn't shutting down.
+func (h *liveHub) deregister(g *game.Game, c *liveConn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.games[g.ID], c)
+	if len(h.games[g.ID]) == 0 {
+		delete(h.games, g.ID)
+	}
+	close(c.send)
+	for other := range h.games[g.ID] {
+		if other.player == c.player {
+			return false
+		}
+	}
+	return !h.closing
+}
+
+// broadcast queues e for all connections following g. Connections too slow
+// to keep up are dropped, clients can reconnect for the history.
+func (h *liveHub) broadcast(g *game.Game, e game.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.games[g.ID] {
+		if !c.push(LiveServerMessage{Type: LiveEvent, Event: &e}) {
+			log.Warn(fmt.Sprintf("dropping slow game socket of %s for game %s", c.player, g.ID))
+			c.conn.Close()
+		}
+	}
+}
+
+// Shutdown sends all game and player connections a going away close frame.
+func (h *liveHub) Shutdown() {
+	h.mu.Lock()
+	h.closing = true
+	conns := []*liveConn{}
+	for _, gameConns := range h.games {
+		for c := range gameConns {
+			conns = append(conns, c)
+		}
+	}
+	for _, playerConns := range h.players {
+		for c := range playerConns {
+			conns = append(conns, c)
+		}
+	}
+	h.mu.Unlock()
+	for _, c := range conns {
+		c.shutdown()
+	}
+}
+
+// Open lets a hub which has been shut down accept connections again.
+func (h *liveHub) Open() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closing = false
+}
+
+func (c *liveConn) push(m LiveServerMessage) bool {
+	select {
+	case c.send <- m:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *liveConn) shutdown() {
+	message := ws.FormatCloseMessage(ws.CloseGoingAway, liveShutdownReason)
+	c.conn.WriteControl(ws.CloseMessage, message, time.Now().Add(time.Second))
+	c.conn.Close()
+}
+
+// write sends the queued messages until send is closed, skipping events up
+// to sequence number after.
+func (c *liveConn) write(after int) {
+	failed := false
+	for m := range c.send {
+		if failed || (m.Event != nil && m.Event.Seq <= after) {
+			continue
+		}
+		if err := c.conn.WriteJSON(m); err != nil {
+			failed = true
+			c.conn.Close()
+		}
+	}
+}
+
+// read passes the messages of the client to handle until the connection
+// fails, rejected messages are answered with an error.
+func (c *liveConn) read(handle func(m LiveClientMessage) error) {
+	c.conn.SetReadLimit(liveMaxMessageSize)
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var m LiveClientMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			c.push(LiveServerMessage{Type: LiveError, Reason: "invalid message"})
+			continue
+		}
+		if err := handle(m); err != nil {
+			c.push(LiveServerMessage{Type: LiveError, Reason: err.Error()})
+		}
+	}
+}
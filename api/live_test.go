@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"golang_battleship/chat"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// dialGame connects playername to the game socket of g, query is appended
+// to the url as is.
+func dialGame(t *testing.T, srv *httptest.Server, g *game.Game, playername string, query string) (*ws.Conn, *http.Response, error) {
+	token, _ := createToken([]byte("abcdefg"), playername, 60)
+	header := http.Header{}
+	header.Add("Cookie", JWT_COOKIE_NAME+"="+token)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + API_PREFIX + "/games/" + g.ID.String() + "/ws" + query
+	return ws.DefaultDialer.Dial(url, header)
+}
+
+// readLive reads messages until one of type messageType arrives.
+func readLive(t *testing.T, conn *ws.Conn, messageType string) LiveServerMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var m LiveServerMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatalf("expected %s message, got %s", messageType, err)
+		}
+		if m.Type == messageType {
+			return m
+		}
+	}
+}
+
+// readEvent reads messages until an event of type eventType arrives.
+func readEvent(t *testing.T, conn *ws.Conn, eventType string) game.Event {
+	t.Helper()
+	for {
+		m := readLive(t, conn, LiveEvent)
+		if m.Event.Type == eventType {
+			return *m.Event
+		}
+	}
+}
+
+func TestGameSocketChat(t *testing.T) {
+	game.ChatFilter = chat.NewFilter([]string{"yare"})
+	defer func() { game.ChatFilter = chat.NewFilter(nil) }()
+	host, _ := player.NewPlayer("Okuyasu", "")
+	guest, _ := player.NewPlayer("Koichi", "")
+	player.NewPlayer("Rohan", "")
+	g, _ := game.NewGame(12, 12, 5, "Morioh", 2, host.Name, guest.Name)
+	g.Private = true
+	g.Say(*host, "before anyone connected")
+	srv := httptest.NewServer(NewRouter([]byte("abcdefg"), []byte("01234567890123456789012345678901")))
+	defer srv.Close()
+
+	if _, res, err := dialGame(t, srv, g, "Rohan", ""); err == nil || res.StatusCode != http.StatusForbidden {
+		t.Errorf("outsider connected to private game, got %v", err)
+	}
+	hostConn, _, err := dialGame(t, srv, g, host.Name, "")
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	defer hostConn.Close()
+	welcome := readLive(t, hostConn, LiveWelcome)
+	if last := welcome.Events[len(welcome.Events)-1]; last.Type != game.EventChat || last.Text != "before anyone connected" {
+		t.Errorf("expected chat history in welcome, got %+v", welcome.Events)
+	}
+	guestConn, _, err := dialGame(t, srv, g, guest.Name, "")
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	defer guestConn.Close()
+	readLive(t, guestConn, LiveWelcome)
+
+	guestConn.WriteJSON(LiveClientMessage{Type: LiveChat, Text: "yare yare daze"})
+	for _, conn := range []*ws.Conn{hostConn, guestConn} {
+		if e := readEvent(t, conn, game.EventChat); e.Player != guest.Name || e.Text != "**** **** daze" {
+			t.Errorf("expected filtered chat of %s, got %+v", guest.Name, e)
+		}
+	}
+
+	guestConn.WriteJSON(LiveClientMessage{Type: LiveMute, Player: host.Name})
+	if m := readLive(t, guestConn, LiveError); !strings.Contains(m.Reason, "moderate") {
+		t.Errorf("expected error muting without being moderator, got %+v", m)
+	}
+	hostConn.WriteJSON(LiveClientMessage{Type: LiveMute, Player: guest.Name})
+	if e := readEvent(t, guestConn, game.EventMuted); e.Player != guest.Name {
+		t.Errorf("expected %s to be muted, got %+v", guest.Name, e)
+	}
+	guestConn.WriteJSON(LiveClientMessage{Type: LiveChat, Text: "hello?"})
+	if m := readLive(t, guestConn, LiveError); !strings.Contains(m.Reason, "muted") {
+		t.Errorf("expected error chatting while muted, got %+v", m)
+	}
+	guestConn.WriteMessage(ws.TextMessage, []byte("not json"))
+	readLive(t, guestConn, LiveError)
+
+	g.StartDeployment()
+	if e := readEvent(t, hostConn, game.EventDeploymentStarted); e.Seq == 0 {
+		t.Errorf("game event without sequence number: %+v", e)
+	}
+}
+
+func TestGameSocketResume(t *testing.T) {
+	p1, _ := player.NewPlayer("Jotaro", "")
+	p2, _ := player.NewPlayer("Polnareff", "")
+	g, _ := game.NewGame(12, 12, 5, "Stardust", 2, p1.Name, p2.Name)
+	g.StartDeployment()
+	srv := httptest.NewServer(NewRouter([]byte("abcdefg"), []byte("01234567890123456789012345678901")))
+	defer srv.Close()
+
+	if _, res, err := dialGame(t, srv, g, p1.Name, "?since=-1"); err == nil || res.StatusCode != http.StatusBadRequest {
+		t.Errorf("connected with an invalid sequence number, got %v", err)
+	}
+	conn, _, err := dialGame(t, srv, g, p1.Name, "")
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	welcome := readLive(t, conn, LiveWelcome)
+	last := welcome.Events[len(welcome.Events)-1].Seq
+	conn.Close()
+	for i := 0; i < 100 && !g.IsDisconnected(p1.Name); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !g.IsDisconnected(p1.Name) {
+		t.Fatalf("%s wasn't disconnected after the connection dropped", p1.Name)
+	}
+	g.Say(*p2, "where did you go")
+
+	conn, _, err = dialGame(t, srv, g, p1.Name, "?since="+strconv.Itoa(last))
+	if err != nil {
+		t.Fatalf("failed to reconnect: %s", err)
+	}
+	defer conn.Close()
+	welcome = readLive(t, conn, LiveWelcome)
+	types := []string{}
+	for _, e := range welcome.Events {
+		types = append(types, e.Type)
+		if e.Seq <= last {
+			t.Errorf("replayed event %d which was received before", e.Seq)
+		}
+	}
+	if strings.Join(types, ",") != "disconnected,chat,reconnected" || welcome.Events[0].Deadline == nil {
+		t.Errorf("expected the missed events only, got %+v", welcome.Events)
+	}
+	if g.IsDisconnected(p1.Name) {
+		t.Errorf("%s is still disconnected after reconnecting", p1.Name)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	p1, _ := player.NewPlayer("Josuke", "")
+	p2, _ := player.NewPlayer("Kira", "")
+	g, _ := game.NewGame(12, 12, 5, "Replay", 2, p1.Name, p2.Name)
+	g.Say(*p2, "I just want a quiet life")
+	router := NewRouter([]byte("abcdefg"), []byte("01234567890123456789012345678901"))
+	token, _ := createToken([]byte("abcdefg"), p1.Name, 60)
+	replay := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, API_PREFIX+"/games/"+g.ID.String()+"/replay", nil)
+		req.AddCookie(&http.Cookie{Name: JWT_COOKIE_NAME, Value: token})
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := replay(); rec.Code != http.StatusBadRequest {
+		t.Errorf("replay of a game in progress returned %d", rec.Code)
+	}
+	g.Finish(p1.Name)
+	rec := replay()
+	var b ReplayResponseBody
+	if err := json.NewDecoder(rec.Body).Decode(&b); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("failed to get replay, got %d, %v", rec.Code, err)
+	}
+	types := []string{}
+	for _, e := range b.Events {
+		types = append(types, e.Type)
+	}
+	if b.Winner != p1.Name || strings.Join(types, ",") != "joined,joined,chat,game_over" || b.Events[2].Text != "I just want a quiet life" {
+		t.Errorf("unexpected replay %+v", b)
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"golang_battleship/board"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "battleship"
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	webSocketConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "websocket_connections",
+		Help:      "Open WebSocket connections.",
+	})
+	shotsFired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "shots_fired_total",
+		Help:      "Shots fired in all games, rate() gives the shots per second.",
+	})
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+// gamesCollector counts the games by state whenever metrics are scraped.
+type gamesCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c gamesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c gamesCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := game.CountByState()
+	for name, state := range game.GameStateMap {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(counts[state]), name)
+	}
+}
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		gamesCollector{desc: prometheus.NewDesc(metricsNamespace+"_games", "Games by state.", []string{"state"}, nil)},
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "registered_players",
+			Help:      "Registered players.",
+		}, func() float64 { return float64(player.Count()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "jwt_blacklist_size",
+			Help:      "Revoked jwts not expired yet.",
+		}, func() float64 { return float64(JWTBlacklist.size()) }),
+		webSocketConnections,
+		shotsFired,
+		logins,
+		httpRequestDuration,
+	)
+	game.OnShot(func(g *game.Game, shooter string, results []board.ShotResult) {
+		shotsFired.Inc()
+	})
+}
+
+// Metrics serves the metrics in the Prometheus text format, either on the
+// public router or on a separate admin port.
+func Metrics() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+func observeRequest(route string, method string, status int, seconds float64) {
+	if len(route) == 0 {
+		route = "unmatched"
+	}
+	httpRequestDuration.WithLabelValues(route, method, strconv.Itoa(status)).Observe(seconds)
+}
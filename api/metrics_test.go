@@ -0,0 +1,81 @@
+package api
+
+import (
+	"fmt"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/steinfletcher/apitest"
+)
+
+func TestMetrics(t *testing.T) {
+	router := NewRouter([]byte("abcdefg"), []byte("01234567890123456789012345678901"))
+	apitest.New().
+		Handler(router).
+		Get(API_PREFIX + "/version").
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+	apitest.New().
+		Handler(router).
+		Post(API_PREFIX + "/login").
+		JSON(`{"playername": "nobody", "password": "wrong"}`).
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		End()
+
+	res := httptest.NewRecorder()
+	Metrics().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(res.Body)
+	for _, expected := range []string{
+		`battleship_games{state="running"}`,
+		`battleship_registered_players`,
+		`battleship_websocket_connections 0`,
+		`battleship_shots_fired_total`,
+		`battleship_logins_total{result="failure"}`,
+		`battleship_jwt_blacklist_size`,
+		`battleship_http_request_duration_seconds_count{method="GET",route="` + API_PREFIX + `/version",status="200"}`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("metrics miss %s", expected)
+		}
+	}
+}
+
+// TestScrapeWhileChanging scrapes the metrics while players and games are
+// created, which the race detector checks.
+func TestScrapeWhileChanging(t *testing.T) {
+	started := make(chan struct{})
+	done := make(chan struct{})
+	scraped := make(chan struct{})
+	go func() {
+		defer close(scraped)
+		for {
+			Metrics().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			select {
+			case started <- struct{}{}:
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+	<-started
+	for i := 0; i < 100; i++ {
+		host, guest := fmt.Sprintf("ScrapedHost%d", i), fmt.Sprintf("ScrapedGuest%d", i)
+		player.NewPlayer(host, "")
+		player.NewPlayer(guest, "")
+		g, _ := game.NewGame(12, 12, 1, "Scraped", 2, host, guest)
+		g.Mutex().Lock()
+		g.StartDeployment()
+		g.Mutex().Unlock()
+		JWTBlacklist.Blacklist(host, 0)
+	}
+	close(done)
+	<-scraped
+}
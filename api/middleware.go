@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"golang_battleship/game"
 	"golang_battleship/player"
+	"golang_battleship/tournament"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -47,20 +48,80 @@ func gameValidator(w http.ResponseWriter, r *http.Request) (*game.Game, error) {
 	return g, nil
 }
 
+func tournamentValidator(w http.ResponseWriter, r *http.Request) (*tournament.Tournament, error) {
+	rvars := mux.Vars(r)
+	tournamentID, ok := rvars["id"]
+	if !ok {
+		JSONErrorResponse(w, http.StatusBadRequest, "")
+		return nil, fmt.Errorf("no tournament id provided in request path")
+	}
+	t, err := tournament.GetByUUID(tournamentID)
+	if err != nil {
+		JSONErrorResponse(w, http.StatusNotFound, err.Error())
+		return nil, fmt.Errorf("no tournament found for id %s", tournamentID)
+	}
+	return t, nil
+}
+
+// deprecatedAlias marks responses of the unversioned paths as deprecated and
+// points to their successor below API_PREFIX.
+func deprecatedAlias(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", API_PREFIX, r.URL.Path))
+		h.ServeHTTP(w, r)
+	})
+}
+
+// sessionOnly rejects requests authenticated by api token, account
+// management requires a login with password.
+func sessionOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := getAPITokenScopeFromContext(r); ok {
+			JSONErrorResponse(w, http.StatusForbidden, "api tokens cannot be used for account management")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// requiresPlay rejects api tokens lacking the play scope, for GET routes
+// which change state nonetheless.
+func requiresPlay(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scope, ok := getAPITokenScopeFromContext(r); ok && scope != ScopePlay {
+			JSONErrorCodeResponse(w, http.StatusForbidden, ErrInsufficientScope, fmt.Sprintf("api token scope %s doesn't permit %s", scope, r.URL.Path))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 type JWTMiddleware struct {
 	jwtSigningKey []byte
+	// keys replace jwtSigningKey if set, so the keys can be rotated at runtime
+	keys          *KeyRing
 	jwtCookieName string
-	loginHandler  func(w http.ResponseWriter, r *http.Request, jwtSigningKey []byte)
+	loginHandler  func(w http.ResponseWriter, r *http.Request, jwtSigningKey Key)
+}
+
+func (jwtm JWTMiddleware) keyRing() *KeyRing {
+	if jwtm.keys != nil {
+		return jwtm.keys
+	}
+	return StaticKeyRing(jwtm.jwtSigningKey)
 }
 
 func (jwtm JWTMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	jwtm.loginHandler(w, r, jwtm.jwtSigningKey)
+	jwtm.loginHandler(w, r, jwtm.keyRing().Current())
 }
 
 type gameValidatorHandler struct {
 	gameValidator   func(w http.ResponseWriter, r *http.Request) (*game.Game, error)
 	playerValidator func(w http.ResponseWriter, r *http.Request) (*player.Player, error)
 	handler         func(w http.ResponseWriter, r *http.Request, p *player.Player, g *game.Game)
+	// unlocked handlers lock the game by themselves, such as long lived sockets
+	unlocked bool
 }
 
 func (gv gameValidatorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -72,9 +133,46 @@ func (gv gameValidatorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return
 	}
+	if !gv.unlocked {
+		g.Mutex().Lock()
+		defer g.Mutex().Unlock()
+	}
 	gv.handler(w, r, p, g)
 }
 
+type playerHandler struct {
+	playerValidator func(w http.ResponseWriter, r *http.Request) (*player.Player, error)
+	handler         func(w http.ResponseWriter, r *http.Request, p *player.Player)
+}
+
+func (ph playerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, err := ph.playerValidator(w, r)
+	if err != nil {
+		return
+	}
+	ph.handler(w, r, p)
+}
+
+type tournamentValidatorHandler struct {
+	tournamentValidator func(w http.ResponseWriter, r *http.Request) (*tournament.Tournament, error)
+	playerValidator     func(w http.ResponseWriter, r *http.Request) (*player.Player, error)
+	handler             func(w http.ResponseWriter, r *http.Request, p *player.Player, t *tournament.Tournament)
+}
+
+func (tv tournamentValidatorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, err := tv.playerValidator(w, r)
+	if err != nil {
+		return
+	}
+	t, err := tv.tournamentValidator(w, r)
+	if err != nil {
+		return
+	}
+	t.Mutex().Lock()
+	defer t.Mutex().Unlock()
+	tv.handler(w, r, p, t)
+}
+
 type logoutHandler struct {
 	jwtBlacklistValidator func(w http.ResponseWriter, r *http.Request) (string, int64, error)
 	handler               func(w http.ResponseWriter, r *http.Request, jwtID string, expiry int64)
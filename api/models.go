@@ -3,17 +3,34 @@ package api
 import (
 	"golang_battleship/board"
 	"golang_battleship/game"
+	"golang_battleship/player"
+	"golang_battleship/tournament"
 	"time"
 )
 
+// ErrorResponseBody is the envelope of every error response.
 type ErrorResponseBody struct {
-	Message string `json:"message"`
+	Code        ErrorCode    `json:"code"`
+	Message     string       `json:"message"`
+	RequestID   string       `json:"request_id,omitempty"`
+	FieldErrors []FieldError `json:"field_errors,omitempty"`
+}
+
+type ErrorCodeDescription struct {
+	Code        ErrorCode `json:"code"`
+	Status      int       `json:"status"`
+	Description string    `json:"description"`
 }
 
 type Playername string
 
 type VersionResponseBody struct {
-	Version string `json:"version"`
+	Version      string   `json:"version"`
+	APIVersion   string   `json:"api_version"`
+	Commit       string   `json:"commit"`
+	GoVersion    string   `json:"go_version"`
+	RuleVariants []string `json:"rule_variants"`
+	Weapons      []string `json:"weapons"`
 }
 
 type RegisterPlayerBody struct {
@@ -26,19 +43,118 @@ type RegisterPlayerResponseBody struct {
 }
 
 type CreateGameBody struct {
-	BoardParameters board.BoardParameters `json:"board_parameters"`
-	MaxPlayers      int                   `json:"max_players,omitempty"`
-	Description     string                `json:"description,omitempty"`
+	BoardParameters        board.BoardParameters `json:"board_parameters"`
+	MaxPlayers             int                   `json:"max_players,omitempty"`
+	Description            string                `json:"description,omitempty"`
+	Private                bool                  `json:"private,omitempty"`
+	Password               string                `json:"password,omitempty"`
+	BestOf                 int                   `json:"best_of,omitempty"`
+	CreditSeriesWinnerOnly bool                  `json:"credit_series_winner_only,omitempty"`
+}
+
+type JoinGameBody struct {
+	Password   string `json:"password,omitempty"`
+	InviteCode string `json:"invite,omitempty"`
+}
+
+type CreateInviteBody struct {
+	Friend string `json:"friend,omitempty"`
+}
+
+type InviteResponseBody struct {
+	Code    string    `json:"code"`
+	Link    string    `json:"link"`
+	Expires time.Time `json:"expires"`
+	Friend  string    `json:"friend,omitempty"`
 }
 
+// Viewer roles of a game, participants see their own fleet on top of what
+// spectators see.
+const (
+	ViewerParticipant = "participant"
+	ViewerSpectator   = "spectator"
+)
+
+// GetGameResponseBody is a game as seen by the viewer. Fleet is only set
+// for participants and holds their own ships, the ships of opponents are
+// never part of it.
 type GetGameResponseBody struct {
-	ID           string             `json:"id"`
-	State        game.GameState     `json:"state"`
-	CreationDate time.Time          `json:"creation_date"`
-	Participants []game.Participant `json:"participants"`
+	ID           string         `json:"id"`
+	State        game.GameState `json:"state"`
+	CreationDate time.Time      `json:"creation_date"`
+	Participants []string       `json:"participants"`
+	Creator      string         `json:"creator"`
+	Host         string         `json:"host"`
+	Locked       bool           `json:"locked"`
+	HasPassword  bool           `json:"has_password"`
+	Winner       string         `json:"winner,omitempty"`
+	RematchID    string         `json:"rematch_id,omitempty"`
+	Series       *game.Series   `json:"series,omitempty"`
+	Viewer       string         `json:"viewer"`
+	Boards       []BoardView    `json:"boards"`
+	Fleet        []ShipView     `json:"fleet,omitempty"`
 	CreateGameBody
 }
 
+// BoardView is the board of a participant as every viewer may see it, it
+// carries no ship positions.
+type BoardView struct {
+	Player        string `json:"player"`
+	ShipsDeployed int    `json:"ships_deployed"`
+	ShipsSunk     int    `json:"ships_sunk"`
+	Forfeited     bool   `json:"forfeited"`
+}
+
+// ShipView is a ship of the fleet of the viewer, as it was deployed.
+type ShipView struct {
+	DeployShipBody
+	Hits int  `json:"hits"`
+	Sunk bool `json:"sunk"`
+}
+
+type UpdateGameBody struct {
+	BoardParameters *board.BoardParameters `json:"board_parameters,omitempty"`
+	Description     *string                `json:"description,omitempty"`
+}
+
+type KickPlayerBody struct {
+	Playername string `json:"name"`
+}
+
+type LockGameBody struct {
+	Locked bool `json:"locked"`
+}
+
+// GameSummary is a game as listed, like the views of a game it carries no
+// ship positions.
+type GameSummary struct {
+	ID              string                `json:"id"`
+	State           game.GameState        `json:"state"`
+	Description     string                `json:"description"`
+	CreationDate    time.Time             `json:"creation_date"`
+	Participants    []string              `json:"participants"`
+	MaxParticipants int                   `json:"max_participants"`
+	FreeSlots       int                   `json:"free_slots"`
+	BoardParameters board.BoardParameters `json:"board_parameters"`
+	Creator         string                `json:"creator"`
+	Host            string                `json:"host"`
+	Locked          bool                  `json:"locked"`
+	Private         bool                  `json:"private"`
+	HasPassword     bool                  `json:"has_password"`
+	Winner          string                `json:"winner,omitempty"`
+	ActivePlayer    string                `json:"active_player,omitempty"`
+	Turn            int                   `json:"turn"`
+	SeriesID        string                `json:"series_id,omitempty"`
+	RematchID       string                `json:"rematch_id,omitempty"`
+	Boards          []BoardView           `json:"boards"`
+}
+
+type ListGamesResponseBody struct {
+	Games      []GameSummary `json:"games"`
+	Total      int           `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
 type CreateGameResponseBody struct {
 	ID string `json:"id"`
 }
@@ -47,6 +163,10 @@ type LeaveGameResponseBody struct {
 	ID string `json:"id"`
 }
 
+type RematchResponseBody struct {
+	ID string `json:"id"`
+}
+
 type JoinGameResponseBody struct {
 	ID string `json:"id"`
 }
@@ -58,3 +178,143 @@ type ScoreboardEntry struct {
 }
 
 type ScoreboardResponseBody []ScoreboardEntry
+
+type DeployShipBody struct {
+	Class       string `json:"class"`
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	Orientation string `json:"orientation"`
+}
+
+type FireBody struct {
+	Target string `json:"target"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Weapon string `json:"weapon,omitempty"`
+}
+
+type FireResponseBody struct {
+	Results      []board.ShotResult `json:"results"`
+	State        game.GameState     `json:"state"`
+	ActivePlayer string             `json:"active_player,omitempty"`
+	Winner       string             `json:"winner,omitempty"`
+}
+
+type PlayerStatsResponseBody struct {
+	Name              string         `json:"name"`
+	Wins              int            `json:"wins"`
+	Losses            int            `json:"losses"`
+	ShotsFired        int            `json:"shots_fired"`
+	Hits              int            `json:"hits"`
+	Accuracy          float64        `json:"accuracy"`
+	AverageTurnsToWin float64        `json:"average_turns_to_win"`
+	ShipsLost         map[string]int `json:"ships_lost"`
+	FavouriteWeapon   string         `json:"favourite_weapon,omitempty"`
+	LongestWinStreak  int            `json:"longest_win_streak"`
+	CurrentWinStreak  int            `json:"current_win_streak"`
+}
+
+type MatchHistoryResponseBody struct {
+	Total    int                  `json:"total"`
+	Page     int                  `json:"page"`
+	PageSize int                  `json:"page_size"`
+	Games    []player.MatchRecord `json:"games"`
+}
+
+type CreateTournamentBody struct {
+	Name            string                `json:"name"`
+	Format          string                `json:"format"`
+	Seeding         string                `json:"seeding,omitempty"`
+	MaxPlayers      int                   `json:"max_players,omitempty"`
+	BoardParameters board.BoardParameters `json:"board_parameters"`
+}
+
+type CreateTournamentResponseBody struct {
+	ID string `json:"id"`
+}
+
+type GetTournamentResponseBody struct {
+	*tournament.Tournament
+	Standings []tournament.Standing `json:"standings"`
+}
+
+type StandingsResponseBody []tournament.Standing
+
+type ProfileResponseBody struct {
+	Name             string    `json:"name"`
+	ID               string    `json:"id"`
+	RegistrationDate time.Time `json:"registration_date"`
+	player.Profile
+}
+
+type UpdateProfileBody struct {
+	DisplayName        *string              `json:"display_name,omitempty"`
+	Avatar             *string              `json:"avatar,omitempty"`
+	PreferredBoardSize *player.BoardSize    `json:"preferred_board_size,omitempty"`
+	DefaultFleet       *[]player.FleetEntry `json:"default_fleet,omitempty"`
+}
+
+type ChangePasswordBody struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type CreateAPITokenBody struct {
+	Name      string     `json:"name"`
+	Scope     TokenScope `json:"scope"`
+	ExpiresIn int        `json:"expires_in,omitempty"`
+}
+
+type CreateAPITokenResponseBody struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+type ListAPITokensResponseBody []APIToken
+
+// LiveClientMessage is sent by clients on the game WebSocket, chat carries
+// text, mute and unmute name the player.
+type LiveClientMessage struct {
+	Type   string `json:"type"`
+	Text   string `json:"text,omitempty"`
+	Player string `json:"player,omitempty"`
+}
+
+// LiveServerMessage is sent by the server on the game WebSocket: welcome
+// with the event history, event for every new game event and error for a
+// rejected client message. The player WebSocket sends friend_request and
+// friend_accepted naming the player and invite.
+type LiveServerMessage struct {
+	Type   string             `json:"type"`
+	Player string             `json:"player,omitempty"`
+	Events []game.Event       `json:"events,omitempty"`
+	Event  *game.Event        `json:"event,omitempty"`
+	Invite *player.GameInvite `json:"invite,omitempty"`
+	Reason string             `json:"reason,omitempty"`
+}
+
+type ReplayResponseBody struct {
+	ID              string                `json:"id"`
+	Participants    []string              `json:"participants"`
+	Winner          string                `json:"winner,omitempty"`
+	BoardParameters board.BoardParameters `json:"board_parameters"`
+	Events          []game.Event          `json:"events"`
+}
+
+type FriendRequestBody struct {
+	Playername string `json:"name"`
+}
+
+type FriendStatus struct {
+	Name     string `json:"name"`
+	Presence string `json:"presence"`
+	GameID   string `json:"game_id,omitempty"`
+}
+
+type FriendsResponseBody struct {
+	Friends  []FriendStatus `json:"friends"`
+	Requests []string       `json:"requests"`
+	Sent     []string       `json:"sent"`
+}
+
+type ListInvitesResponseBody []player.GameInvite
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"golang_battleship/game"
+	"golang_battleship/tournament"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// apiOperation documents a single route below API_PREFIX and its deprecated
+// alias, unless it is unversioned. Request and response are values of the
+// body types, their schemas are derived from the json tags.
+type apiOperation struct {
+	method      string
+	path        string
+	unversioned bool
+	operationID string
+	summary     string
+	auth        bool
+	query       []string
+	request     interface{}
+	response    interface{}
+}
+
+type openAPISchemas map[string]interface{}
+
+const openAPIVersion = "3.0.3"
+
+var apiOperations = []apiOperation{
+	{method: "GET", path: "/", unversioned: true, operationID: "Index", summary: "Redirects to the login page"},
+	{method: "POST", path: "/login", operationID: "Login", summary: "Logs in with form values or JSON body, sets the jwt cookie and redirects to the dashboard", request: LoginBody{}},
+	{method: "GET", path: "/version", operationID: "Version", summary: "Returns the API version", response: VersionResponseBody{}},
+	{method: "GET", path: "/errors", operationID: "ErrorCodes", summary: "Lists the error codes of the error envelope", response: []ErrorCodeDescription{}},
+	{method: "GET", path: "/openapi.json", operationID: "OpenAPI", summary: "Returns this document"},
+	{method: "GET", path: "/{resource}", unversioned: true, operationID: "StaticFile", summary: "Serves html, css, js and image files"},
+	{method: "GET", path: "/players", operationID: "Scoreboard", summary: "Lists the best players", auth: true, query: []string{"ranking"}, response: ScoreboardResponseBody{}},
+	{method: "POST", path: "/players", operationID: "RegisterPlayer", summary: "Registers a player", auth: true, request: RegisterPlayerBody{}, response: RegisterPlayerResponseBody{}},
+	{method: "GET", path: "/players/me", operationID: "GetProfile", summary: "Returns the profile of the logged in player", auth: true, response: ProfileResponseBody{}},
+	{method: "PATCH", path: "/players/me", operationID: "UpdateProfile", summary: "Updates the profile of the logged in player", auth: true, request: UpdateProfileBody{}, response: ProfileResponseBody{}},
+	{method: "DELETE", path: "/players/me", operationID: "DeleteProfile", summary: "Deletes the account of the logged in player", auth: true},
+	{method: "POST", path: "/players/me/password", operationID: "ChangePassword", summary: "Changes the password of the logged in player", auth: true, request: ChangePasswordBody{}},
+	{method: "GET", path: "/players/me/friends", operationID: "ListFriends", summary: "Lists the friends of the logged in player with their presence and the pending friend requests", auth: true, response: FriendsResponseBody{}},
+	{method: "POST", path: "/players/me/friends", operationID: "RequestFriend", summary: "Sends a friend request, accepting a pending one of the other player", auth: true, request: FriendRequestBody{}, response: FriendsResponseBody{}},
+	{method: "POST", path: "/players/me/friends/{name}/accept", operationID: "AcceptFriend", summary: "Accepts a friend request", auth: true, response: FriendsResponseBody{}},
+	{method: "DELETE", path: "/players/me/friends/{name}", operationID: "RemoveFriend", summary: "Removes a friend, or declines or withdraws a friend request", auth: true, response: FriendsResponseBody{}},
+	{method: "GET", path: "/players/me/invites", operationID: "ListInvites", summary: "Lists the pending invites of friends to open games", auth: true, response: ListInvitesResponseBody{}},
+	{method: "GET", path: "/players/me/ws", operationID: "PlayerSocket", summary: "Receives friend requests and invites via WebSocket, being connected shows the player online", auth: true},
+	{method: "GET", path: "/players/me/tokens", operationID: "ListAPITokens", summary: "Lists the api tokens of the logged in player", auth: true, response: ListAPITokensResponseBody{}},
+	{method: "POST", path: "/players/me/tokens", operationID: "CreateAPIToken", summary: "Creates an api token, its secret is only returned once", auth: true, request: CreateAPITokenBody{}, response: CreateAPITokenResponseBody{}},
+	{method: "DELETE", path: "/players/me/tokens/{id}", operationID: "RevokeAPIToken", summary: "Revokes an api token", auth: true},
+	{method: "GET", path: "/players/{name}/stats", operationID: "PlayerStats", summary: "Returns the statistics of a player", auth: true, response: PlayerStatsResponseBody{}},
+	{method: "GET", path: "/players/{name}/games", operationID: "PlayerMatchHistory", summary: "Returns the match history of a player, most recent first", auth: true, query: []string{"page", "page_size"}, response: MatchHistoryResponseBody{}},
+	{method: "GET", path: "/games", operationID: "ListGames", summary: "Lists a page of games, newest first unless sorted otherwise", auth: true, query: []string{"state", "participant", "min_free_slots", "size_x", "size_y", "created_after", "created_before", "sort", "order", "cursor", "limit"}, response: ListGamesResponseBody{}},
+	{method: "POST", path: "/games", operationID: "CreateGame", summary: "Creates a game hosted by the logged in player", auth: true, request: CreateGameBody{}, response: CreateGameResponseBody{}},
+	{method: "GET", path: "/games/{id}", operationID: "GetGame", summary: "Returns a game", auth: true, response: GetGameResponseBody{}},
+	{method: "PATCH", path: "/games/{id}", operationID: "UpdateGame", summary: "Updates the settings of an open game", auth: true, request: UpdateGameBody{}},
+	{method: "DELETE", path: "/games/{id}", operationID: "DeleteGame", summary: "Deletes a game", auth: true},
+	{method: "GET", path: "/games/{id}/join", operationID: "JoinGameByLink", summary: "Joins a game by invite link", auth: true, query: []string{"invite"}, response: JoinGameResponseBody{}},
+	{method: "POST", path: "/games/{id}/join", operationID: "JoinGame", summary: "Joins a game, private games need a password or invite code", auth: true, request: JoinGameBody{}, response: JoinGameResponseBody{}},
+	{method: "POST", path: "/games/{id}/invites", operationID: "CreateInvite", summary: "Creates an invite code for a private game, sending it to the friend given", auth: true, request: CreateInviteBody{}, response: InviteResponseBody{}},
+	{method: "POST", path: "/games/{id}/rematch", operationID: "Rematch", summary: "Creates or returns the rematch of a finished game", auth: true, response: RematchResponseBody{}},
+	{method: "POST", path: "/games/{id}/deploy", operationID: "DeployShip", summary: "Deploys a ship", auth: true, request: DeployShipBody{}},
+	{method: "POST", path: "/games/{id}/fire", operationID: "Fire", summary: "Fires at the board of another participant", auth: true, request: FireBody{}, response: FireResponseBody{}},
+	{method: "POST", path: "/games/{id}/leave", operationID: "LeaveGame", summary: "Leaves a game", auth: true, response: LeaveGameResponseBody{}},
+	{method: "POST", path: "/games/{id}/kick", operationID: "KickPlayer", summary: "Kicks a participant, host only", auth: true, request: KickPlayerBody{}},
+	{method: "POST", path: "/games/{id}/lock", operationID: "LockGame", summary: "Locks or unlocks a game for joining, host only", auth: true, request: LockGameBody{}},
+	{method: "POST", path: "/games/{id}/start", operationID: "StartGame", summary: "Starts the deployment of ships, host only", auth: true},
+	{method: "GET", path: "/games/{id}/ws", operationID: "GameSocket", summary: "Follows the events and chat of a game via WebSocket, resuming after the event sequence number since, messages are LiveClientMessage and LiveServerMessage", auth: true, query: []string{"since"}},
+	{method: "GET", path: "/games/{id}/replay", operationID: "Replay", summary: "Returns the events of a game which is over, chat included", auth: true, response: ReplayResponseBody{}},
+	{method: "GET", path: "/tournaments", operationID: "ListTournaments", summary: "Lists tournaments by id", auth: true, query: []string{"state"}, response: map[string]tournament.Tournament{}},
+	{method: "POST", path: "/tournaments", operationID: "CreateTournament", summary: "Creates a tournament organized by the logged in player", auth: true, request: CreateTournamentBody{}, response: CreateTournamentResponseBody{}},
+	{method: "GET", path: "/tournaments/{id}", operationID: "GetTournament", summary: "Returns a tournament with its standings", auth: true, response: GetTournamentResponseBody{}},
+	{method: "GET", path: "/tournaments/{id}/standings", operationID: "GetStandings", summary: "Returns the standings of a tournament", auth: true, response: StandingsResponseBody{}},
+	{method: "POST", path: "/tournaments/{id}/register", operationID: "RegisterForTournament", summary: "Registers the logged in player for a tournament", auth: true},
+	{method: "POST", path: "/tournaments/{id}/withdraw", operationID: "WithdrawFromTournament", summary: "Withdraws the logged in player from a tournament", auth: true},
+	{method: "POST", path: "/tournaments/{id}/start", operationID: "StartTournament", summary: "Starts a tournament, organizer only", auth: true},
+	{method: "GET", path: "/arena", operationID: "BotArena", summary: "Connects a bot to the bot arena via WebSocket", auth: true},
+	{method: "GET", path: "/logout", operationID: "Logout", summary: "Logs out and revokes the jwt", auth: true},
+}
+
+var (
+	openAPISpec     map[string]interface{}
+	openAPISpecOnce sync.Once
+)
+
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	JSONResponse(w, http.StatusOK, OpenAPISpec())
+}
+
+// OpenAPISpec returns the OpenAPI document of all apiOperations.
+func OpenAPISpec() map[string]interface{} {
+	openAPISpecOnce.Do(func() {
+		schemas := openAPISchemas{}
+		paths := map[string]map[string]interface{}{}
+		add := func(path string, method string, o map[string]interface{}) {
+			if _, ok := paths[path]; !ok {
+				paths[path] = map[string]interface{}{}
+			}
+			paths[path][strings.ToLower(method)] = o
+		}
+		for _, op := range apiOperations {
+			if op.unversioned {
+				add(op.path, op.method, schemas.operation(op))
+				continue
+			}
+			add(API_PREFIX+op.path, op.method, schemas.operation(op))
+			alias := schemas.operation(op)
+			alias["operationId"] = op.operationID + "Deprecated"
+			alias["deprecated"] = true
+			add(op.path, op.method, alias)
+		}
+		openAPISpec = map[string]interface{}{
+			"openapi": openAPIVersion,
+			"info": map[string]interface{}{
+				"title":   "golang_battleship",
+				"version": VERSION,
+			},
+			"paths": paths,
+			"components": map[string]interface{}{
+				"schemas": schemas,
+				"securitySchemes": map[string]interface{}{
+					"cookieAuth": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": JWT_COOKIE_NAME},
+					"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "api token"},
+				},
+			},
+		}
+	})
+	return openAPISpec
+}
+
+func (s openAPISchemas) operation(op apiOperation) map[string]interface{} {
+	parameters := []interface{}{}
+	for _, segment := range strings.Split(op.path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     strings.Trim(segment, "{}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	for _, q := range op.query {
+		parameters = append(parameters, map[string]interface{}{
+			"name":   q,
+			"in":     "query",
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	ok := map[string]interface{}{"description": "OK"}
+	if op.response != nil {
+		ok["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": s.schema(reflect.TypeOf(op.response))},
+		}
+	}
+	o := map[string]interface{}{
+		"operationId": op.operationID,
+		"summary":     op.summary,
+		"parameters":  parameters,
+		"responses": map[string]interface{}{
+			"200": ok,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": s.schema(reflect.TypeOf(ErrorResponseBody{}))},
+				},
+			},
+		},
+	}
+	if op.request != nil {
+		o["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": s.schema(reflect.TypeOf(op.request))},
+			},
+		}
+	}
+	if op.auth {
+		o["security"] = []interface{}{
+			map[string]interface{}{"cookieAuth": []string{}},
+			map[string]interface{}{"bearerAuth": []string{}},
+		}
+	}
+	return o
+}
+
+// schema returns the schema of t, named structs are added to s and referenced.
+func (s openAPISchemas) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(uuid.UUID{}):
+		return map[string]interface{}{"type": "string", "format": "uuid"}
+	case reflect.TypeOf(ErrorCode("")):
+		codes := []ErrorCode{}
+		for _, c := range ErrorCatalogue {
+			codes = append(codes, c.Code)
+		}
+		return map[string]interface{}{"type": "string", "enum": codes}
+	case reflect.TypeOf(game.Participant{}):
+		// participants are marshalled as their name
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.schema(t.Elem())
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return s.object(t)
+		}
+		if _, ok := s[t.Name()]; !ok {
+			s[t.Name()] = map[string]interface{}{}
+			s[t.Name()] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+// object describes the exported fields of struct t the way encoding/json
+// marshals them, embedded structs without json tag are inlined.
+func (s openAPISchemas) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (len(f.PkgPath) > 0 && !f.Anonymous) {
+			continue
+		}
+		parts := strings.SplitN(tag, ",", 2)
+		name, options := parts[0], ""
+		if len(parts) > 1 {
+			options = parts[1]
+		}
+		if f.Anonymous && len(name) == 0 {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inlined := s.object(embedded)
+				for k, v := range inlined["properties"].(map[string]interface{}) {
+					properties[k] = v
+				}
+				if r, ok := inlined["required"].([]string); ok {
+					required = append(required, r...)
+				}
+				continue
+			}
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		properties[name] = s.schema(f.Type)
+		if !strings.Contains(options, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+	o := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		o["required"] = required
+	}
+	return o
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/steinfletcher/apitest"
+)
+
+// openAPIPath turns a mux path template into an OpenAPI path by dropping
+// the regular expressions of path variables.
+func openAPIPath(template string) string {
+	var b strings.Builder
+	depth := 0
+	skipping := false
+	for _, r := range template {
+		switch {
+		case r == '{':
+			depth += 1
+			if depth == 1 {
+				b.WriteRune(r)
+			}
+		case r == '}':
+			depth -= 1
+			if depth == 0 {
+				skipping = false
+				b.WriteRune(r)
+			}
+		case r == ':' && depth == 1:
+			skipping = true
+		case depth == 0 || (depth == 1 && !skipping):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	paths := OpenAPISpec()["paths"].(map[string]map[string]interface{})
+	documented := map[string]bool{}
+	router := NewRouter([]byte("abcdefg"), []byte("01234567890123456789012345678901"))
+	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		path := openAPIPath(template)
+		for _, method := range methods {
+			op, ok := paths[path][strings.ToLower(method)].(map[string]interface{})
+			if !ok {
+				t.Errorf("route %s %s is missing in the OpenAPI spec", method, path)
+				continue
+			}
+			documented[method+" "+path] = true
+			// authenticated routes sit on a subrouter of the versioned or alias subrouter
+			if _, secured := op["security"]; secured != (len(ancestors) > 1) {
+				t.Errorf("security of route %s %s doesn't match the OpenAPI spec", method, path)
+			}
+		}
+		return nil
+	})
+	for path, ops := range paths {
+		for method := range ops {
+			if !documented[strings.ToUpper(method)+" "+path] {
+				t.Errorf("OpenAPI spec documents %s %s, which is not routed", strings.ToUpper(method), path)
+			}
+		}
+	}
+
+	schemas := OpenAPISpec()["components"].(map[string]interface{})["schemas"].(openAPISchemas)
+	for _, name := range []string{"CreateGameBody", "GetGameResponseBody", "GameSummary", "Tournament", "Standing", "APIToken"} {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("schema %s is missing in the OpenAPI spec", name)
+		}
+	}
+
+	apitest.New().
+		Handler(router).
+		Get(API_PREFIX + "/openapi.json").
+		Expect(t).
+		Status(http.StatusOK).
+		Assert(func(res *http.Response, req *http.Request) error {
+			var spec map[string]interface{}
+			return json.NewDecoder(res.Body).Decode(&spec)
+		}).
+		End()
+}
+
+func TestDeprecatedAliases(t *testing.T) {
+	router := NewRouter([]byte("abcdefg"), []byte("01234567890123456789012345678901"))
+	apitest.New().
+		Handler(router).
+		Get("/version").
+		Expect(t).
+		Status(http.StatusOK).
+		Header("Deprecation", "true").
+		Header("Link", `<`+API_PREFIX+`/version>; rel="successor-version"`).
+		End()
+
+	apitest.New().
+		Handler(router).
+		Get("/games").
+		Expect(t).
+		Status(http.StatusUnauthorized).
+		Header("Deprecation", "true").
+		End()
+
+	apitest.New().
+		Handler(router).
+		Get(API_PREFIX + "/version").
+		Expect(t).
+		Status(http.StatusOK).
+		HeaderNotPresent("Deprecation").
+		Assert(func(res *http.Response, req *http.Request) error {
+			var v VersionResponseBody
+			if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+				return err
+			}
+			if v.APIVersion != API_VERSION || len(v.GoVersion) == 0 || len(v.RuleVariants) == 0 {
+				return fmt.Errorf("incomplete version info %+v", v)
+			}
+			return nil
+		}).
+		End()
+}
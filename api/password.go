@@ -0,0 +1,65 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// bcrypt ignores everything past 72 bytes
+const maxPasswordBytes = 72
+
+var PasswordRequirements = PasswordPolicy{MinLength: 8}
+
+func (pp PasswordPolicy) Validate(password string) error {
+	if len([]rune(password)) < pp.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", pp.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must not exceed %d bytes", maxPasswordBytes)
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	missing := []string{}
+	if pp.RequireUpper && !upper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if pp.RequireLower && !lower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if pp.RequireDigit && !digit {
+		missing = append(missing, "a digit")
+	}
+	if pp.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("password must contain %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// HashPassword hashes password like RegisterPlayer, for managing players
+// offline.
+func HashPassword(password string) (string, error) {
+	return hashPassword(password, PASSWORD_REHASH_COUNT)
+}
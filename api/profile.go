@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang_battleship/board"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"golang_battleship/tournament"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func GetProfile(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	w.Header().Set("X-CSRF-Token", csrf.Token(r))
+	JSONResponse(w, http.StatusOK, ProfileResponseBody{
+		Name:             p.Name,
+		ID:               p.ID.String(),
+		RegistrationDate: p.RegistrationDate,
+		Profile:          p.Profile,
+	})
+}
+
+func UpdateProfile(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	decoder := json.NewDecoder(r.Body)
+	var b UpdateProfileBody
+	if err := decoder.Decode(&b); err != nil {
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
+		return
+	}
+	profile := p.Profile
+	if b.DisplayName != nil {
+		profile.DisplayName = *b.DisplayName
+	}
+	if b.Avatar != nil {
+		profile.Avatar = *b.Avatar
+	}
+	if b.PreferredBoardSize != nil {
+		profile.PreferredBoardSize = b.PreferredBoardSize
+	}
+	if b.DefaultFleet != nil {
+		profile.DefaultFleet = *b.DefaultFleet
+	}
+	bp := board.BoardParameters{
+		SizeX:    game.DefaultBoardsizeX,
+		SizeY:    game.DefaultBoardsizeY,
+		MaxShips: len(profile.DefaultFleet),
+	}
+	if profile.PreferredBoardSize != nil {
+		bp.SizeX, bp.SizeY = profile.PreferredBoardSize.SizeX, profile.PreferredBoardSize.SizeY
+	}
+	if bp.MaxShips == 0 {
+		bp.MaxShips = game.DefaultMaxships
+	}
+	if err := game.ValidateBoardParameters(bp); err != nil {
+		JSONValidationErrorResponse(w, "Invalid preferred board size", FieldError{Field: "preferred_board_size", Message: err.Error()})
+		return
+	}
+	if err := game.ValidateFleet(bp, profile.DefaultFleet); err != nil {
+		JSONValidationErrorResponse(w, "Invalid default fleet", FieldError{Field: "default_fleet", Message: err.Error()})
+		return
+	}
+	if _, ok := player.Lookup(p.Name); !ok {
+		JSONErrorResponse(w, http.StatusNotFound, fmt.Sprintf("player name %s doesnt exist", p.Name))
+		return
+	}
+	updated, err := player.Update(p.Name, func(stored *player.Player) error {
+		return stored.UpdateProfile(profile)
+	})
+	if err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to update profile, %s", err))
+		return
+	}
+	GetProfile(w, r, &updated)
+}
+
+func ChangePassword(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	decoder := json.NewDecoder(r.Body)
+	var b ChangePasswordBody
+	if err := decoder.Decode(&b); err != nil {
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(p.PasswordHash), []byte(b.CurrentPassword)); err != nil {
+		JSONErrorCodeResponse(w, http.StatusForbidden, ErrInvalidCredentials, "Current password is incorrect")
+		return
+	}
+	if err := PasswordRequirements.Validate(b.NewPassword); err != nil {
+		JSONValidationErrorResponse(w, "Failed to change password", FieldError{Field: "new_password", Message: err.Error()})
+		return
+	}
+	passwordHash, err := hashPassword(b.NewPassword, PASSWORD_REHASH_COUNT)
+	if err != nil {
+		JSONErrorResponse(w, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+	if _, err := player.Update(p.Name, func(stored *player.Player) error {
+		stored.SetPasswordHash(passwordHash)
+		return nil
+	}); err != nil {
+		JSONErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	// keep the session the password was changed with, if any
+	jwtID, _ := getJwtIDFromContext(r)
+	JWTSessions.RevokeOthers(p.Name, jwtID)
+	requestLogger(r).Info(fmt.Sprintf("player %s changed their password", p.Name))
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteProfile removes the player along with their game participations,
+// tournament registrations and sessions.
+func DeleteProfile(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	if _, err := player.DeletePlayer(p.Name); err != nil {
+		JSONErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	game.RemovePlayer(p.Name)
+	for _, t := range tournament.List() {
+		t.Mutex().Lock()
+		t.Withdraw(p.Name)
+		t.Mutex().Unlock()
+	}
+	JWTSessions.RevokeAll(p.Name)
+	APITokens.RevokeAll(p.Name)
+	http.SetCookie(w, &http.Cookie{
+		Name:     JWT_COOKIE_NAME,
+		Path:     "/",
+		Value:    "",
+		SameSite: http.SameSiteStrictMode,
+		HttpOnly: true,
+		Secure:   SecureCookies,
+		Expires:  time.Unix(0, 0),
+	})
+	requestLogger(r).Info(fmt.Sprintf("deleted player %s", p.Name))
+	w.WriteHeader(http.StatusOK)
+}
+
+func ListAPITokens(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	JSONResponse(w, http.StatusOK, ListAPITokensResponseBody(APITokens.List(p.Name)))
+}
+
+func CreateAPIToken(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	decoder := json.NewDecoder(r.Body)
+	var b CreateAPITokenBody
+	if err := decoder.Decode(&b); err != nil {
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to decode JSON body")
+		return
+	}
+	t, secret, err := APITokens.Create(p.Name, b.Name, b.Scope, time.Duration(b.ExpiresIn)*time.Second)
+	if err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to create api token, %s", err))
+		return
+	}
+	requestLogger(r).Info(fmt.Sprintf("player %s created api token %s with scope %s", p.Name, t.ID, t.Scope))
+	JSONResponse(w, http.StatusOK, CreateAPITokenResponseBody{APIToken: *t, Token: secret})
+}
+
+func RevokeAPIToken(w http.ResponseWriter, r *http.Request, p *player.Player) {
+	id := mux.Vars(r)["id"]
+	if err := APITokens.Revoke(p.Name, id); err != nil {
+		JSONErrorResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	requestLogger(r).Info(fmt.Sprintf("player %s revoked api token %s", p.Name, id))
+	w.WriteHeader(http.StatusOK)
+}
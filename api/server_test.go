@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"golang_battleship/arena"
+	"golang_battleship/player"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestServeShutdown(t *testing.T) {
+	player.NewPlayer("Pucci", "")
+	_, secret, _ := APITokens.Create("Pucci", "shutdown test", ScopePlay, 0)
+	port := freePort(t)
+	base := fmt.Sprintf("127.0.0.1:%d", port)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// shutting down closes the hub of the game sockets and the bot arena
+	// shared by all tests
+	defer live.Open()
+	defer arena.BotArena.Open()
+	served := make(chan error)
+	go func() {
+		served <- Serve(ctx, "127.0.0.1", port, 0, TLSOptions{}, StaticKeyRing([]byte("abcdefg")), StaticKeyRing([]byte("01234567890123456789012345678901")))
+	}()
+
+	var res *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if res, err = http.Get("http://" + base + API_PREFIX + "/version"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("server didn't come up: %v", err)
+	}
+	res.Body.Close()
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+secret)
+	conn, _, err := ws.DefaultDialer.Dial("ws://"+base+API_PREFIX+"/arena", header)
+	if err != nil {
+		t.Fatalf("failed to connect to the bot arena: %s", err)
+	}
+	defer conn.Close()
+	var welcome arena.ServerMessage
+	if err := conn.ReadJSON(&welcome); err != nil || welcome.Type != arena.TypeWelcome {
+		t.Fatalf("expected welcome, got %+v, %v", welcome, err)
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("expected clean shutdown, got %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't shut down")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var m arena.ServerMessage
+		err := conn.ReadJSON(&m)
+		if err == nil {
+			continue
+		}
+		if !ws.IsCloseError(err, ws.CloseGoingAway) {
+			t.Errorf("expected going away close frame, got %s", err)
+		}
+		break
+	}
+	if _, err := http.Get("http://" + base + API_PREFIX + "/version"); err == nil {
+		t.Errorf("server still accepts connections after shutdown")
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ThrottlePolicy allows FreeAttempts failed logins, after that every further
+// attempt has to wait BaseDelay, doubling with each failure up to MaxDelay.
+// Reaching LockoutThreshold failures locks out for LockoutDuration.
+type ThrottlePolicy struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+}
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+type LoginThrottle struct {
+	Account   ThrottlePolicy
+	IP        ThrottlePolicy
+	accounts  map[string]*loginAttempts
+	ips       map[string]*loginAttempts
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+type FailedLogin struct {
+	Playername string    `json:"playername"`
+	IP         string    `json:"ip"`
+	Reason     string    `json:"reason"`
+	Date       time.Time `json:"date"`
+}
+
+const maxAuditLogSize = 1000
+
+// throttleSweepInterval is the minimum time between two sweeps of expired
+// login attempts.
+const throttleSweepInterval = time.Minute
+
+var LoginThrottler = NewLoginThrottle(
+	ThrottlePolicy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutThreshold: 10, LockoutDuration: 15 * time.Minute},
+	ThrottlePolicy{FreeAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutThreshold: 50, LockoutDuration: 15 * time.Minute},
+)
+
+// FailedLoginAuditLog holds the most recent failed logins, oldest first.
+var FailedLoginAuditLog []FailedLogin
+
+func NewLoginThrottle(account ThrottlePolicy, ip ThrottlePolicy) *LoginThrottle {
+	return &LoginThrottle{
+		Account:  account,
+		IP:       ip,
+		accounts: make(map[string]*loginAttempts),
+		ips:      make(map[string]*loginAttempts),
+	}
+}
+
+func (tp ThrottlePolicy) retryAfter(a *loginAttempts, now time.Time) time.Duration {
+	if a == nil {
+		return 0
+	}
+	if now.Before(a.lockedUntil) {
+		return a.lockedUntil.Sub(now)
+	}
+	if a.failures <= tp.FreeAttempts {
+		return 0
+	}
+	delay := tp.BaseDelay << (a.failures - tp.FreeAttempts - 1)
+	if delay > tp.MaxDelay || delay <= 0 {
+		delay = tp.MaxDelay
+	}
+	if wait := a.lastFailure.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// expired reports whether a neither throttles nor counts towards a lockout
+// anymore, so it can be dropped.
+func (tp ThrottlePolicy) expired(a *loginAttempts, now time.Time) bool {
+	return now.Sub(a.lastFailure) > tp.LockoutDuration && tp.retryAfter(a, now) == 0
+}
+
+func (tp ThrottlePolicy) sweep(attempts map[string]*loginAttempts, now time.Time) {
+	for key, a := range attempts {
+		if tp.expired(a, now) {
+			delete(attempts, key)
+		}
+	}
+}
+
+// sweep drops the expired attempts of accounts and ips at most once per
+// throttleSweepInterval. lt.mu has to be held.
+func (lt *LoginThrottle) sweep(now time.Time) {
+	if now.Sub(lt.lastSweep) < throttleSweepInterval {
+		return
+	}
+	lt.lastSweep = now
+	lt.Account.sweep(lt.accounts, now)
+	lt.IP.sweep(lt.ips, now)
+}
+
+func (tp ThrottlePolicy) fail(attempts map[string]*loginAttempts, key string, now time.Time) {
+	a, ok := attempts[key]
+	if !ok || now.Sub(a.lastFailure) > tp.LockoutDuration {
+		a = &loginAttempts{}
+		attempts[key] = a
+	}
+	a.failures += 1
+	a.lastFailure = now
+	if tp.LockoutThreshold > 0 && a.failures >= tp.LockoutThreshold {
+		a.lockedUntil = now.Add(tp.LockoutDuration)
+		a.failures = 0
+		log.WithField("key", key).Warn("login locked out until ", a.lockedUntil)
+	}
+}
+
+// RetryAfter returns how long the next login for playername from ip has to wait.
+func (lt *LoginThrottle) RetryAfter(playername string, ip string) time.Duration {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	now := time.Now()
+	wait := lt.Account.retryAfter(lt.accounts[playername], now)
+	if ipWait := lt.IP.retryAfter(lt.ips[ip], now); ipWait > wait {
+		wait = ipWait
+	}
+	return wait
+}
+
+func (lt *LoginThrottle) Failure(playername string, ip string, reason string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	now := time.Now()
+	lt.sweep(now)
+	lt.Account.fail(lt.accounts, playername, now)
+	lt.IP.fail(lt.ips, ip, now)
+	FailedLoginAuditLog = append(FailedLoginAuditLog, FailedLogin{Playername: playername, IP: ip, Reason: reason, Date: now})
+	if len(FailedLoginAuditLog) > maxAuditLogSize {
+		FailedLoginAuditLog = FailedLoginAuditLog[len(FailedLoginAuditLog)-maxAuditLogSize:]
+	}
+	log.WithFields(log.Fields{
+		"audit":      "login_failed",
+		"playername": playername,
+		"ip":         ip,
+		"reason":     reason,
+	}).Warn("failed login")
+}
+
+// Success resets the failures of playername, failures of the ip are kept so
+// logging into an own account doesn't lift the throttling of an ip.
+func (lt *LoginThrottle) Success(playername string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	delete(lt.accounts, playername)
+	lt.sweep(time.Now())
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TLSOptions configure HTTPS, Serve listens in plain HTTP if neither a
+// certificate nor SelfSigned is given.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// SelfSigned generates a certificate at startup, for development only.
+	SelfSigned bool
+	// RedirectPort is a plain HTTP port redirecting to HTTPS, 0 disables it.
+	RedirectPort int
+}
+
+const selfSignedLifetime = 365 * 24 * time.Hour
+
+// SecureCookies marks the jwt and CSRF cookies Secure, Serve sets it when
+// TLS is on.
+var SecureCookies = false
+
+func (o TLSOptions) Enabled() bool {
+	return o.SelfSigned || len(o.CertFile) > 0
+}
+
+// config loads the certificate or generates a self-signed one for host.
+func (o TLSOptions) config(host string) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	if o.SelfSigned {
+		cert, err = selfSignedCertificate(host)
+	} else {
+		cert, err = tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// selfSignedCertificate creates a certificate for localhost and host, its
+// fingerprint is logged so clients can verify it.
+func selfSignedCertificate(host string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"golang_battleship development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	} else if ip == nil && len(host) > 0 {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	log.Warn(fmt.Sprintf("generated self-signed certificate for development, sha256 fingerprint %x", sha256.Sum256(der)))
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// redirectToHTTPS redirects every request to the same path on the HTTPS port.
+func redirectToHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		target := "https://" + net.JoinHostPort(host, strconv.Itoa(port)) + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"golang_battleship/arena"
+	"golang_battleship/player"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeTLS(t *testing.T) {
+	defer func() { SecureCookies = false }()
+	pw, _ := hashPassword("passwordnarancia", PASSWORD_REHASH_COUNT)
+	player.NewPlayer("Narancia", pw)
+	port, redirectPort := freePort(t), freePort(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// shutting down closes the hub of the game sockets and the bot arena
+	// shared by all tests
+	defer live.Open()
+	defer arena.BotArena.Open()
+	served := make(chan error)
+	go func() {
+		served <- Serve(ctx, "127.0.0.1", port, 0, TLSOptions{SelfSigned: true, RedirectPort: redirectPort}, StaticKeyRing([]byte("abcdefg")), StaticKeyRing([]byte("01234567890123456789012345678901")))
+	}()
+	defer func() {
+		cancel()
+		<-served
+	}()
+
+	cli := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: 10 * time.Second,
+	}
+	base := fmt.Sprintf("https://127.0.0.1:%d", port)
+	var res *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if res, err = cli.Get(base + API_PREFIX + "/version"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("TLS server didn't come up: %v", err)
+	}
+	res.Body.Close()
+
+	res, err = cli.Post(base+API_PREFIX+"/login", "application/json", strings.NewReader(`{"playername": "Narancia", "password": "passwordnarancia"}`))
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	res.Body.Close()
+	cookies := res.Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("login didn't set the jwt cookie")
+	}
+	for _, c := range cookies {
+		if !c.Secure {
+			t.Errorf("cookie %s isn't marked Secure", c.Name)
+		}
+	}
+
+	res, err = cli.Get(fmt.Sprintf("http://127.0.0.1:%d%s/version?x=1", redirectPort, API_PREFIX))
+	if err != nil {
+		t.Fatalf("redirect port unreachable: %s", err)
+	}
+	res.Body.Close()
+	expected := fmt.Sprintf("https://127.0.0.1:%d%s/version?x=1", port, API_PREFIX)
+	if res.StatusCode != http.StatusPermanentRedirect || res.Header.Get("Location") != expected {
+		t.Errorf("expected redirect to %s, got %d %s", expected, res.StatusCode, res.Header.Get("Location"))
+	}
+}
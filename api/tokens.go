@@ -0,0 +1,197 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TokenScope string
+
+// APIToken is a personal access token for bots and scripts. Only the sha256
+// hash of the secret is kept, the secret is handed out once on creation.
+type APIToken struct {
+	ID           uuid.UUID  `json:"id"`
+	Name         string     `json:"name"`
+	Playername   string     `json:"playername"`
+	Scope        TokenScope `json:"scope"`
+	CreationDate time.Time  `json:"creation_date"`
+	LastUsed     *time.Time `json:"last_used,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	hash         string
+}
+
+// StoredAPIToken is an api token as persisted, along with the hash of its secret.
+type StoredAPIToken struct {
+	APIToken
+	Hash string `json:"hash"`
+}
+
+type apiTokenStore struct {
+	tokens map[string]*APIToken
+	mu     sync.Mutex
+}
+
+const (
+	ScopeRead TokenScope = "read"
+	ScopePlay TokenScope = "play"
+)
+
+const (
+	apiTokenPrefix = "bst_"
+	apiTokenSize   = 32
+	maxTokenName   = 64
+)
+
+var APITokens = apiTokenStore{tokens: make(map[string]*APIToken)}
+
+func hashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create issues a new token for playername and returns it along with its secret.
+func (s *apiTokenStore) Create(playername string, name string, scope TokenScope, expiresIn time.Duration) (*APIToken, string, error) {
+	if scope != ScopeRead && scope != ScopePlay {
+		return nil, "", fmt.Errorf("invalid token scope %s, must be %s or %s", scope, ScopeRead, ScopePlay)
+	}
+	if len(name) == 0 || len(name) > maxTokenName {
+		return nil, "", fmt.Errorf("token name must be between 1 and %d characters long", maxTokenName)
+	}
+	if expiresIn < 0 {
+		return nil, "", fmt.Errorf("token expiry must not be negative")
+	}
+	b := make([]byte, apiTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("failed to generate api token: %s", err)
+	}
+	secret := apiTokenPrefix + hex.EncodeToString(b)
+	t := &APIToken{
+		ID:           uuid.New(),
+		Name:         name,
+		Playername:   playername,
+		Scope:        scope,
+		CreationDate: time.Now(),
+		hash:         hashAPIToken(secret),
+	}
+	if expiresIn > 0 {
+		expiry := t.CreationDate.Add(expiresIn)
+		t.ExpiresAt = &expiry
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[t.hash] = t
+	return t, secret, nil
+}
+
+func (s *apiTokenStore) List(playername string) []APIToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := []APIToken{}
+	for _, t := range s.tokens {
+		if t.Playername == playername {
+			tokens = append(tokens, *t)
+		}
+	}
+	return tokens
+}
+
+func (s *apiTokenStore) Revoke(playername string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.tokens {
+		if t.Playername == playername && t.ID.String() == id {
+			delete(s.tokens, hash)
+			return nil
+		}
+	}
+	return fmt.Errorf("no api token with id %s found", id)
+}
+
+func (s *apiTokenStore) RevokeAll(playername string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, t := range s.tokens {
+		if t.Playername == playername {
+			delete(s.tokens, hash)
+		}
+	}
+}
+
+// Snapshot returns all tokens along with their hashes, for persisting them.
+func (s *apiTokenStore) Snapshot() []StoredAPIToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := []StoredAPIToken{}
+	for hash, t := range s.tokens {
+		tokens = append(tokens, StoredAPIToken{APIToken: *t, Hash: hash})
+	}
+	return tokens
+}
+
+// Restore adds the persisted tokens which haven't expired yet.
+func (s *apiTokenStore) Restore(tokens []StoredAPIToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, stored := range tokens {
+		if _, ok := s.tokens[stored.Hash]; ok || (stored.ExpiresAt != nil && stored.ExpiresAt.Before(now)) {
+			continue
+		}
+		t := stored.APIToken
+		t.hash = stored.Hash
+		s.tokens[t.hash] = &t
+	}
+}
+
+// Authenticate looks up the token for secret and records its usage.
+func (s *apiTokenStore) Authenticate(secret string) (APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[hashAPIToken(secret)]
+	if !ok {
+		return APIToken{}, fmt.Errorf("unknown api token")
+	}
+	now := time.Now()
+	if t.ExpiresAt != nil && t.ExpiresAt.Before(now) {
+		return APIToken{}, fmt.Errorf("api token %s has expired", t.ID)
+	}
+	t.LastUsed = &now
+	return *t, nil
+}
+
+// AuthenticateBot resolves the api token of a bot connecting to the bot arena,
+// which needs the play scope.
+func AuthenticateBot(secret string) (string, error) {
+	t, err := APITokens.Authenticate(secret)
+	if err != nil {
+		return "", err
+	}
+	if t.Scope != ScopePlay {
+		return "", fmt.Errorf("api token %s lacks scope %s", t.ID, ScopePlay)
+	}
+	return t.Playername, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")), true
+}
+
+// allowedMethod reports whether scope permits requests with the given method.
+func (scope TokenScope) allowedMethod(method string) bool {
+	if scope == ScopePlay {
+		return true
+	}
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang_battleship/board"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"golang_battleship/tournament"
+	"net/http"
+)
+
+func CreateTournament(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	c := CreateTournamentBody{
+		Format:  "single-elimination",
+		Seeding: "wins",
+		BoardParameters: board.BoardParameters{
+			SizeX:    game.DefaultBoardsizeX,
+			SizeY:    game.DefaultBoardsizeY,
+			MaxShips: game.DefaultMaxships,
+		},
+		MaxPlayers: tournament.DefaultMaxParticipants,
+	}
+	if err := decoder.Decode(&c); err != nil {
+		JSONErrorCodeResponse(w, http.StatusBadRequest, ErrInvalidBody, "Failed to parse request")
+		return
+	}
+	organizer, err := getPlayernameFromContext(r)
+	if err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	format, ok := tournament.FormatMap[c.Format]
+	if !ok {
+		JSONValidationErrorResponse(w, "Failed to create new tournament", FieldError{Field: "format", Message: fmt.Sprintf("invalid tournament format %s", c.Format)})
+		return
+	}
+	seeding, ok := tournament.SeedingMap[c.Seeding]
+	if !ok {
+		JSONValidationErrorResponse(w, "Failed to create new tournament", FieldError{Field: "seeding", Message: fmt.Sprintf("invalid seeding %s", c.Seeding)})
+		return
+	}
+	t, err := tournament.NewTournament(c.Name, organizer, format, seeding, c.MaxPlayers, c.BoardParameters)
+	if err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to create new tournament, %s", err))
+		return
+	}
+	JSONResponse(w, http.StatusOK, CreateTournamentResponseBody{ID: t.ID.String()})
+}
+
+func ListTournaments(w http.ResponseWriter, r *http.Request) {
+	tournaments := make(map[string]tournament.Tournament)
+	stateint := tournament.TournamentState(-1)
+	if state := r.URL.Query().Get("state"); len(state) > 0 {
+		var ok bool
+		stateint, ok = tournament.TournamentStateMap[state]
+		if !ok {
+			JSONValidationErrorResponse(w, "Invalid query", FieldError{Field: "state", Message: fmt.Sprintf("invalid tournament state %s", state)})
+			return
+		}
+	}
+	for _, t := range tournament.List() {
+		t.Mutex().Lock()
+		if stateint == -1 || t.State == stateint {
+			tournaments[t.ID.String()] = t.Snapshot()
+		}
+		t.Mutex().Unlock()
+	}
+	JSONResponse(w, http.StatusOK, tournaments)
+}
+
+func GetTournament(w http.ResponseWriter, r *http.Request, p *player.Player, t *tournament.Tournament) {
+	JSONResponse(w, http.StatusOK, GetTournamentResponseBody{Tournament: t, Standings: t.Standings()})
+}
+
+func GetStandings(w http.ResponseWriter, r *http.Request, p *player.Player, t *tournament.Tournament) {
+	JSONResponse(w, http.StatusOK, StandingsResponseBody(t.Standings()))
+}
+
+func RegisterForTournament(w http.ResponseWriter, r *http.Request, p *player.Player, t *tournament.Tournament) {
+	if err := t.Register(p.Name); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to register for tournament with id %s, %s", t.ID, err))
+		return
+	}
+	GetTournament(w, r, p, t)
+}
+
+func WithdrawFromTournament(w http.ResponseWriter, r *http.Request, p *player.Player, t *tournament.Tournament) {
+	if err := t.Withdraw(p.Name); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to withdraw from tournament with id %s, %s", t.ID, err))
+		return
+	}
+	GetTournament(w, r, p, t)
+}
+
+func StartTournament(w http.ResponseWriter, r *http.Request, p *player.Player, t *tournament.Tournament) {
+	if t.Organizer != p.Name {
+		JSONErrorResponse(w, http.StatusForbidden, fmt.Sprintf("Only the organizer may start tournament with id %s", t.ID))
+		return
+	}
+	if err := t.Start(); err != nil {
+		JSONErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Failed to start tournament with id %s, %s", t.ID, err))
+		return
+	}
+	requestLogger(r).Info(fmt.Sprintf("organizer %s started tournament %s", p.Name, t.ID))
+	GetTournament(w, r, p, t)
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"golang_battleship/game"
+	"golang_battleship/player"
+)
+
+// gameView builds g as viewer p may see it. Spectators get the boards of
+// all participants without ship positions, participants their own fleet on
+// top. Ships are only ever copied into a response from the fleet of the
+// viewer.
+func gameView(g *game.Game, p *player.Player) GetGameResponseBody {
+	body := GetGameResponseBody{
+		ID:           g.ID.String(),
+		State:        g.State,
+		CreationDate: g.CreationDate,
+		Participants: g.ListParticipants(),
+		Creator:      g.Creator,
+		Host:         g.Host,
+		Locked:       g.Locked,
+		HasPassword:  len(g.PasswordHash) > 0,
+		Winner:       g.Winner,
+		Viewer:       ViewerSpectator,
+		Boards:       boardViews(g),
+		CreateGameBody: CreateGameBody{
+			BoardParameters: g.BoardParameters,
+			MaxPlayers:      g.MaxParticipants,
+			Description:     g.Description,
+			Private:         g.Private,
+		},
+	}
+	if g.IsParticipant(p.Name) {
+		body.Viewer = ViewerParticipant
+		body.Fleet = fleetView(g, p.Name)
+	}
+	if g.RematchID != nil {
+		body.RematchID = g.RematchID.String()
+	}
+	if g.SeriesID != nil {
+		body.Series, _ = game.GetSeriesByUUID(g.SeriesID.String())
+	}
+	if body.Series != nil {
+		body.BestOf = body.Series.BestOf
+		body.CreditSeriesWinnerOnly = body.Series.CreditWinnerOnly
+	}
+	return body
+}
+
+// gameSummary builds g as listed, the same for every viewer.
+func gameSummary(g *game.Game) GameSummary {
+	summary := GameSummary{
+		ID:              g.ID.String(),
+		State:           g.State,
+		Description:     g.Description,
+		CreationDate:    g.CreationDate,
+		Participants:    g.ListParticipants(),
+		MaxParticipants: g.MaxParticipants,
+		FreeSlots:       g.FreeSlots(),
+		BoardParameters: g.BoardParameters,
+		Creator:         g.Creator,
+		Host:            g.Host,
+		Locked:          g.Locked,
+		Private:         g.Private,
+		HasPassword:     len(g.PasswordHash) > 0,
+		Winner:          g.Winner,
+		ActivePlayer:    g.ActivePlayer,
+		Turn:            g.Turn,
+		Boards:          boardViews(g),
+	}
+	if g.SeriesID != nil {
+		summary.SeriesID = g.SeriesID.String()
+	}
+	if g.RematchID != nil {
+		summary.RematchID = g.RematchID.String()
+	}
+	return summary
+}
+
+func boardViews(g *game.Game) []BoardView {
+	boards := []BoardView{}
+	for _, name := range g.ListParticipants() {
+		deployed, _ := g.ShipsDeployed(name)
+		sunk, _ := g.ShipsSunk(name)
+		boards = append(boards, BoardView{Player: name, ShipsDeployed: deployed, ShipsSunk: sunk, Forfeited: g.HasForfeited(name)})
+	}
+	return boards
+}
+
+// fleetView returns the ships of playername, only to be sent to playername.
+func fleetView(g *game.Game, playername string) []ShipView {
+	ships, _ := g.Fleet(playername)
+	fleet := []ShipView{}
+	for _, s := range ships {
+		stern := s.SternCoordinate()
+		fleet = append(fleet, ShipView{
+			DeployShipBody: DeployShipBody{Class: s.ClassName(), X: stern.X(), Y: stern.Y(), Orientation: s.Heading()},
+			Hits:           s.Hits(),
+			Sunk:           s.Destroyed(),
+		})
+	}
+	return fleet
+}
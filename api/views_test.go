@@ -0,0 +1,240 @@
+package api
+
+import (
+	"encoding/json"
+	"golang_battleship/arena"
+	"golang_battleship/board"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+type cell struct{ x, y int }
+
+// cells collects the x/y pairs of all JSON objects in payload, which is
+// how ships and shots are located in every response.
+func cells(t *testing.T, payload []byte) []cell {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		t.Fatalf("invalid JSON payload %s: %s", payload, err)
+	}
+	found := []cell{}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			x, okX := v["x"].(float64)
+			y, okY := v["y"].(float64)
+			if okX && okY {
+				found = append(found, cell{int(x), int(y)})
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(v)
+	return found
+}
+
+// TestNoShipPositionsLeak plays a game and a bot arena match while
+// collecting every API and WebSocket payload of both participants and a
+// spectator. The only coordinates a viewer may receive are those of shots
+// and, for a participant, of their own ships.
+func TestNoShipPositionsLeak(t *testing.T) {
+	host, _ := player.NewPlayer("Hinata", "")
+	guest, _ := player.NewPlayer("Kageyama", "")
+	spectator, _ := player.NewPlayer("Tsukishima", "")
+	viewers := []string{host.Name, guest.Name, spectator.Name}
+	g, _ := game.NewGame(12, 12, 1, "Karasuno", 2, host.Name, guest.Name)
+	router := NewRouter([]byte("abcdefg"), []byte("01234567890123456789012345678901"))
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	secrets := map[string]string{}
+	for _, name := range viewers {
+		_, secrets[name], _ = APITokens.Create(name, "leak test", ScopePlay, 0)
+	}
+	payloads := map[string][][]byte{}
+	do := func(name string, method string, path string, body string) []byte {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, API_PREFIX+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+secrets[name])
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s of %s failed with %d %s", method, path, name, rec.Code, rec.Body)
+		}
+		b, _ := io.ReadAll(rec.Body)
+		payloads[name] = append(payloads[name], b)
+		return b
+	}
+	look := func() {
+		for _, name := range viewers {
+			do(name, http.MethodGet, "/games/"+g.ID.String(), "")
+			do(name, http.MethodGet, "/games", "")
+		}
+	}
+	conns := map[string]*ws.Conn{}
+	for _, name := range viewers {
+		conn, _, err := dialGame(t, srv, g, name, "")
+		if err != nil {
+			t.Fatalf("%s failed to connect: %s", name, err)
+		}
+		defer conn.Close()
+		conns[name] = conn
+	}
+
+	path := "/games/" + g.ID.String()
+	do(host.Name, http.MethodPost, path+"/start", "")
+	do(host.Name, http.MethodPost, path+"/deploy", `{"class": "Cruiser", "x": 4, "y": 0, "orientation": "w"}`)
+	look()
+	do(guest.Name, http.MethodPost, path+"/deploy", `{"class": "Cruiser", "x": 4, "y": 5, "orientation": "w"}`)
+	look()
+	shots := map[cell]bool{}
+	fire := func(shooter string, target string, x, y int) {
+		shots[cell{x, y}] = true
+		body, _ := json.Marshal(FireBody{Target: target, X: x, Y: y})
+		do(shooter, http.MethodPost, path+"/fire", string(body))
+		look()
+	}
+	fire(host.Name, guest.Name, 0, 5)
+	fire(guest.Name, host.Name, 11, 11)
+	fire(host.Name, guest.Name, 6, 6)
+	fire(guest.Name, host.Name, 0, 0)
+	g.Forfeit(guest.Name)
+	look()
+	for _, name := range viewers {
+		do(name, http.MethodGet, path+"/replay", "")
+	}
+
+	for _, name := range viewers {
+		conn := conns[name]
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("expected game over on the socket of %s, got %s", name, err)
+			}
+			payloads[name] = append(payloads[name], data)
+			var m LiveServerMessage
+			json.Unmarshal(data, &m)
+			if m.Event != nil && m.Event.Type == game.EventGameOver {
+				break
+			}
+		}
+	}
+
+	// the participants play a match in the bot arena as well, which the
+	// spectator looks at afterwards
+	defaultBoard := arena.BotArena.BoardParameters
+	arena.BotArena.BoardParameters = board.BoardParameters{SizeX: 12, SizeY: 12, MaxShips: 1}
+	defer func() {
+		arena.BotArena.BoardParameters = defaultBoard
+	}()
+	dialArena := func(name string) *ws.Conn {
+		header := http.Header{}
+		header.Add("Authorization", "Bearer "+secrets[name])
+		conn, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+API_PREFIX+"/arena", header)
+		if err != nil {
+			t.Fatalf("%s failed to connect to the arena: %s", name, err)
+		}
+		return conn
+	}
+	bot := func(conn *ws.Conn, deploy DeployShipBody, target string, targets []cell, received chan<- [][]byte) {
+		payloads := [][]byte{}
+		defer func() { received <- payloads }()
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			payloads = append(payloads, data)
+			var m arena.ServerMessage
+			json.Unmarshal(data, &m)
+			switch {
+			case m.Type == arena.TypeDeployRequest:
+				conn.WriteJSON(arena.BotMessage{Type: arena.TypeDeploy, Seq: m.Seq, Class: deploy.Class, X: deploy.X, Y: deploy.Y, Orientation: deploy.Orientation})
+			case m.Type == arena.TypeFireRequest && len(targets) > 0:
+				conn.WriteJSON(arena.BotMessage{Type: arena.TypeFire, Seq: m.Seq, Target: target, X: targets[0].x, Y: targets[0].y})
+				targets = targets[1:]
+			case m.Type == arena.TypeGameOver:
+				return
+			}
+		}
+	}
+	hostBot := dialArena(host.Name)
+	defer hostBot.Close()
+	for _, expected := range []string{arena.TypeWelcome, arena.TypeWaiting} {
+		_, data, err := hostBot.ReadMessage()
+		var m arena.ServerMessage
+		json.Unmarshal(data, &m)
+		if err != nil || m.Type != expected {
+			t.Fatalf("expected %s from the arena, got %s %s", expected, data, err)
+		}
+		payloads[host.Name] = append(payloads[host.Name], data)
+	}
+	guestBot := dialArena(guest.Name)
+	defer guestBot.Close()
+	hostTargets := []cell{{0, 7}, {1, 7}, {2, 7}, {3, 7}, {4, 7}}
+	guestTargets := []cell{{7, 11}, {8, 11}, {9, 11}, {10, 11}, {11, 11}}
+	for _, c := range append(hostTargets, guestTargets...) {
+		shots[c] = true
+	}
+	hostReceived, guestReceived := make(chan [][]byte), make(chan [][]byte)
+	go bot(hostBot, DeployShipBody{Class: "Cruiser", X: 4, Y: 2, Orientation: "w"}, guest.Name, hostTargets, hostReceived)
+	go bot(guestBot, DeployShipBody{Class: "Cruiser", X: 4, Y: 7, Orientation: "w"}, host.Name, guestTargets, guestReceived)
+	payloads[host.Name] = append(payloads[host.Name], <-hostReceived...)
+	payloads[guest.Name] = append(payloads[guest.Name], <-guestReceived...)
+	var over arena.ServerMessage
+	json.Unmarshal(payloads[host.Name][len(payloads[host.Name])-1], &over)
+	if over.Type != arena.TypeGameOver || over.Winner != host.Name {
+		t.Fatalf("expected %s to win the arena match, got %+v", host.Name, over)
+	}
+	do(spectator.Name, http.MethodGet, "/games/"+over.GameID, "")
+	do(spectator.Name, http.MethodGet, "/games", "")
+
+	own := map[string]map[cell]bool{
+		host.Name:      {{0, 0}: true, {1, 0}: true, {2, 0}: true, {3, 0}: true, {4, 0}: true, {0, 2}: true, {1, 2}: true, {2, 2}: true, {3, 2}: true, {4, 2}: true},
+		guest.Name:     {{0, 5}: true, {1, 5}: true, {2, 5}: true, {3, 5}: true, {4, 5}: true, {0, 7}: true, {1, 7}: true, {2, 7}: true, {3, 7}: true, {4, 7}: true},
+		spectator.Name: {},
+	}
+	for _, name := range viewers {
+		seenOwn := false
+		for _, payload := range payloads[name] {
+			for _, c := range cells(t, payload) {
+				// the sterns are never shot, so only the fleet shows them
+				if own[name][c] && !shots[c] {
+					seenOwn = true
+				}
+				if !shots[c] && !own[name][c] {
+					t.Errorf("%s received x:%d/y:%d, which is neither a shot nor their own ship: %s", name, c.x, c.y, payload)
+				}
+			}
+		}
+		if seenOwn != (name != spectator.Name) {
+			t.Errorf("expected %s to see their own fleet only if participating, got %t", name, seenOwn)
+		}
+	}
+
+	var view GetGameResponseBody
+	json.Unmarshal(do(spectator.Name, http.MethodGet, path, ""), &view)
+	if view.Viewer != ViewerSpectator || view.Fleet != nil || len(view.Boards) != 2 || view.Boards[1].ShipsDeployed != 1 || !view.Boards[1].Forfeited {
+		t.Errorf("unexpected spectator view %+v", view)
+	}
+	json.Unmarshal(do(host.Name, http.MethodGet, path, ""), &view)
+	if view.Viewer != ViewerParticipant || len(view.Fleet) != 1 || view.Fleet[0].Class != "Cruiser" || view.Fleet[0].X != 4 || view.Fleet[0].Orientation != "w" || view.Fleet[0].Hits != 1 {
+		t.Errorf("unexpected participant view %+v", view)
+	}
+}
@@ -0,0 +1,444 @@
+package arena
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang_battleship/board"
+	"golang_battleship/game"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// Arena pairs connected bots into games and plays them. Bots have to answer
+// every request within Deadline, after MaxIllegalMoves illegal or late
+// answers within a game they get disqualified.
+type Arena struct {
+	Deadline        time.Duration
+	MaxIllegalMoves int
+	BoardParameters board.BoardParameters
+	// Authenticate resolves the token of a hello message to a playername.
+	Authenticate func(token string) (string, error)
+	queue        []*bot
+	bots         map[*bot]struct{}
+	listeners    []net.Listener
+	closing      bool
+	mu           sync.Mutex
+}
+
+type bot struct {
+	name      string
+	conn      lineConn
+	incoming  chan BotMessage
+	gone      chan struct{}
+	matchDone chan struct{}
+	strikes   int
+	seq       int
+	mu        sync.Mutex
+}
+
+const (
+	DefaultDeadline        = 5 * time.Second
+	DefaultMaxIllegalMoves = 3
+)
+
+const helloTimeout = 10 * time.Second
+
+const shutdownReason = "server shutting down"
+
+var BotArena = NewArena(DefaultDeadline, DefaultMaxIllegalMoves)
+
+func NewArena(deadline time.Duration, maxIllegalMoves int) *Arena {
+	return &Arena{
+		Deadline:        deadline,
+		MaxIllegalMoves: maxIllegalMoves,
+		BoardParameters: board.BoardParameters{SizeX: game.DefaultBoardsizeX, SizeY: game.DefaultBoardsizeY, MaxShips: game.DefaultMaxships},
+	}
+}
+
+// ListenTCP accepts bots on a plain TCP listener. Their first line has to be
+// a hello message carrying an api token. It returns nil once the arena is
+// shut down.
+func (a *Arena) ListenTCP(addr string, port int) error {
+	l, err := net.Listen("tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	if a.closing {
+		a.mu.Unlock()
+		return l.Close()
+	}
+	a.listeners = append(a.listeners, l)
+	a.mu.Unlock()
+	log.Info(fmt.Sprintf("Bot arena listening on %s", l.Addr()))
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if a.shuttingDown() {
+				return nil
+			}
+			return err
+		}
+		go a.ServeConn(conn)
+	}
+}
+
+// Shutdown stops accepting bots and disconnects the connected ones, WebSocket
+// bots get a close frame. Games in progress are forfeited by the bots leaving.
+func (a *Arena) Shutdown() {
+	a.mu.Lock()
+	a.closing = true
+	listeners := a.listeners
+	bots := []*bot{}
+	for b := range a.bots {
+		bots = append(bots, b)
+	}
+	a.listeners = nil
+	a.mu.Unlock()
+	for _, l := range listeners {
+		l.Close()
+	}
+	for _, b := range bots {
+		b.send(ServerMessage{Type: TypeError, Reason: shutdownReason})
+		b.conn.Shutdown(shutdownReason)
+	}
+}
+
+// Open lets an arena which has been shut down accept bots again.
+func (a *Arena) Open() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closing = false
+}
+
+func (a *Arena) shuttingDown() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.closing
+}
+
+// ServeConn authenticates the bot on conn and lets it play until it disconnects.
+func (a *Arena) ServeConn(conn net.Conn) {
+	c := newTCPConn(conn)
+	b := newBot(c)
+	var hello BotMessage
+	select {
+	case hello = <-b.incoming:
+	case <-b.gone:
+		return
+	case <-time.After(helloTimeout):
+		b.send(ServerMessage{Type: TypeError, Reason: "no hello received"})
+		c.Close()
+		return
+	}
+	if hello.Type != TypeHello || a.Authenticate == nil {
+		b.send(ServerMessage{Type: TypeError, Reason: "expected hello with api token"})
+		c.Close()
+		return
+	}
+	name, err := a.Authenticate(hello.Token)
+	if err != nil {
+		log.Warn(fmt.Sprintf("bot authentication from %s failed: %s", conn.RemoteAddr(), err))
+		b.send(ServerMessage{Type: TypeError, Reason: "authentication failed"})
+		c.Close()
+		return
+	}
+	b.name = name
+	a.serve(b)
+}
+
+// ServeWebSocket upgrades the request of the already authenticated playername
+// and lets the bot play until it disconnects.
+func (a *Arena) ServeWebSocket(w http.ResponseWriter, r *http.Request, playername string) {
+	upgrader := ws.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warn("bot arena upgrade: ", err)
+		return
+	}
+	b := newBot(&wsConn{conn: conn})
+	b.name = playername
+	a.serve(b)
+}
+
+func newBot(c lineConn) *bot {
+	b := &bot{
+		conn:      c,
+		incoming:  make(chan BotMessage),
+		gone:      make(chan struct{}),
+		matchDone: make(chan struct{}, 1),
+	}
+	go b.read()
+	return b
+}
+
+// read decodes incoming lines until the connection fails. Lines which are
+// no valid JSON are passed on as message without type, an illegal move.
+func (b *bot) read() {
+	defer close(b.gone)
+	for {
+		line, err := b.conn.ReadLine()
+		if err != nil {
+			return
+		}
+		var m BotMessage
+		if err := json.Unmarshal(line, &m); err != nil {
+			m = BotMessage{}
+		}
+		select {
+		case b.incoming <- m:
+		case <-time.After(time.Minute):
+			// nobody is asking, drop unsolicited messages
+		}
+	}
+}
+
+func (b *bot) send(m ServerMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.conn.WriteLine(encode(m)); err != nil {
+		log.Debug(fmt.Sprintf("failed to send %s to bot %s: %s", m.Type, b.name, err))
+	}
+}
+
+func (b *bot) disconnected() bool {
+	select {
+	case <-b.gone:
+		return true
+	default:
+		return false
+	}
+}
+
+// serve queues b for matches until it disconnects. Whoever completes a
+// pairing plays the game, the waiting bot is notified via matchDone.
+func (a *Arena) serve(b *bot) {
+	defer b.conn.Close()
+	if !a.register(b) {
+		b.send(ServerMessage{Type: TypeError, Reason: shutdownReason})
+		b.conn.Shutdown(shutdownReason)
+		return
+	}
+	defer a.deregister(b)
+	b.send(ServerMessage{Type: TypeWelcome, Player: b.name})
+	for !b.disconnected() {
+		opponent := a.pair(b)
+		if opponent == nil {
+			select {
+			case <-b.matchDone:
+			case <-b.gone:
+				a.unqueue(b)
+				return
+			}
+			continue
+		}
+		a.play(opponent, b)
+		opponent.matchDone <- struct{}{}
+	}
+}
+
+// register tracks b for Shutdown, it fails if the arena is shutting down.
+func (a *Arena) register(b *bot) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closing {
+		return false
+	}
+	if a.bots == nil {
+		a.bots = map[*bot]struct{}{}
+	}
+	a.bots[b] = struct{}{}
+	return true
+}
+
+func (a *Arena) deregister(b *bot) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.bots, b)
+}
+
+// pair returns the longest waiting bot of another player, or queues b if
+// there is none.
+func (a *Arena) pair(b *bot) *bot {
+	a.mu.Lock()
+	for i, opponent := range a.queue {
+		if opponent.name != b.name {
+			a.queue = append(a.queue[:i], a.queue[i+1:]...)
+			a.mu.Unlock()
+			return opponent
+		}
+	}
+	a.queue = append(a.queue, b)
+	a.mu.Unlock()
+	b.send(ServerMessage{Type: TypeWaiting})
+	return nil
+}
+
+func (a *Arena) unqueue(b *bot) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, queued := range a.queue {
+		if queued == b {
+			a.queue = append(a.queue[:i], a.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (a *Arena) play(bots ...*bot) {
+	names := []string{}
+	for _, b := range bots {
+		names = append(names, b.name)
+		b.strikes = 0
+	}
+	bp := a.BoardParameters
+	g, err := game.NewGame(bp.SizeX, bp.SizeY, bp.MaxShips, "Bot arena match", len(bots), names...)
+	if err == nil {
+		g.Mutex().Lock()
+		err = g.StartDeployment()
+		g.Mutex().Unlock()
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to start bot arena match between %v: %s", names, err))
+		return
+	}
+	log.Info(fmt.Sprintf("Bot arena match %s started between %v", g.ID, names))
+	for _, b := range bots {
+		opponents := []string{}
+		for _, name := range names {
+			if name != b.name {
+				opponents = append(opponents, name)
+			}
+		}
+		b.send(ServerMessage{Type: TypeGameStart, GameID: g.ID.String(), Player: b.name, Opponents: opponents, BoardParameters: &bp})
+	}
+	for state, _ := inspect(g); state == game.StateDeployingShips; state, _ = inspect(g) {
+		for _, b := range bots {
+			a.requestDeployment(g, b, bots)
+		}
+	}
+	if state, active := inspect(g); state == game.StateRunning {
+		broadcast(bots, ServerMessage{Type: TypeGameRunning, GameID: g.ID.String(), ActivePlayer: active})
+	}
+	for state, active := inspect(g); state == game.StateRunning; state, active = inspect(g) {
+		for _, b := range bots {
+			if b.name == active {
+				a.requestFire(g, b, bots)
+			}
+		}
+	}
+	g.Mutex().Lock()
+	winner := g.Winner
+	g.Mutex().Unlock()
+	broadcast(bots, ServerMessage{Type: TypeGameOver, GameID: g.ID.String(), Winner: winner})
+	log.Info(fmt.Sprintf("Bot arena match %s won by %s", g.ID, winner))
+}
+
+// inspect returns the state and the active player of g. Arena games are
+// locked like any other, the API handlers may act on them meanwhile.
+func inspect(g *game.Game) (game.GameState, string) {
+	g.Mutex().Lock()
+	defer g.Mutex().Unlock()
+	return g.State, g.ActivePlayer
+}
+
+func (a *Arena) requestDeployment(g *game.Game, b *bot, bots []*bot) {
+	g.Mutex().Lock()
+	deployed, err := g.ShipsDeployed(b.name)
+	maxShips, state := g.BoardParameters.MaxShips, g.State
+	g.Mutex().Unlock()
+	if err != nil || deployed >= maxShips || state != game.StateDeployingShips || b.strikes >= a.MaxIllegalMoves {
+		return
+	}
+	request := ServerMessage{Type: TypeDeployRequest, GameID: g.ID.String(), ShipsLeft: maxShips - deployed}
+	a.request(g, b, request, TypeDeploy, func(m BotMessage) error {
+		g.Mutex().Lock()
+		err := g.Deploy(b.name, m.Class, m.X, m.Y, m.Orientation)
+		g.Mutex().Unlock()
+		if err != nil {
+			return err
+		}
+		broadcast(bots, ServerMessage{Type: TypeShipDeployed, GameID: g.ID.String(), Player: b.name, ShipsLeft: request.ShipsLeft - 1})
+		return nil
+	})
+}
+
+func (a *Arena) requestFire(g *game.Game, b *bot, bots []*bot) {
+	a.request(g, b, ServerMessage{Type: TypeFireRequest, GameID: g.ID.String()}, TypeFire, func(m BotMessage) error {
+		g.Mutex().Lock()
+		results, err := g.Fire(b.name, m.Target, m.X, m.Y, m.Weapon)
+		active := g.ActivePlayer
+		g.Mutex().Unlock()
+		if err != nil {
+			return err
+		}
+		broadcast(bots, ServerMessage{Type: TypeShot, GameID: g.ID.String(), Shooter: b.name, Target: m.Target, Results: results, ActivePlayer: active})
+		return nil
+	})
+}
+
+// forfeit lets b forfeit g, which the bot left or got disqualified from.
+func forfeit(g *game.Game, b *bot) {
+	g.Mutex().Lock()
+	defer g.Mutex().Unlock()
+	g.Forfeit(b.name)
+}
+
+// request sends m to b and applies the answer of type answerType. Late,
+// malformed or rejected answers count as illegal moves. Answers to earlier
+// requests, which missed their deadline, are skipped.
+func (a *Arena) request(g *game.Game, b *bot, m ServerMessage, answerType string, apply func(BotMessage) error) {
+	b.seq += 1
+	m.Seq = b.seq
+	m.DeadlineMS = a.Deadline.Milliseconds()
+	b.send(m)
+	deadline := time.After(a.Deadline)
+	for {
+		select {
+		case answer := <-b.incoming:
+			if answer.Seq != 0 && answer.Seq < m.Seq {
+				continue
+			}
+			if answer.Type != answerType || answer.Seq != m.Seq {
+				a.strike(g, b, fmt.Sprintf("expected %s answer with seq %d", answerType, m.Seq))
+				return
+			}
+			if err := apply(answer); err != nil {
+				a.strike(g, b, err.Error())
+			}
+			return
+		case <-deadline:
+			a.strike(g, b, fmt.Sprintf("no answer within %s", a.Deadline))
+			return
+		case <-b.gone:
+			log.Info(fmt.Sprintf("Bot %s disconnected from match %s", b.name, g.ID))
+			forfeit(g, b)
+			b.strikes = a.MaxIllegalMoves
+			return
+		}
+	}
+}
+
+func (a *Arena) strike(g *game.Game, b *bot, reason string) {
+	b.strikes += 1
+	b.send(ServerMessage{Type: TypeIllegalMove, GameID: g.ID.String(), Strikes: b.strikes, Reason: reason})
+	if b.strikes < a.MaxIllegalMoves {
+		return
+	}
+	log.Info(fmt.Sprintf("Bot %s disqualified from match %s after %d illegal moves", b.name, g.ID, b.strikes))
+	b.send(ServerMessage{Type: TypeDisqualified, GameID: g.ID.String(), Reason: reason})
+	forfeit(g, b)
+	b.conn.Close()
+}
+
+func broadcast(bots []*bot, m ServerMessage) {
+	for _, b := range bots {
+		b.send(m)
+	}
+}
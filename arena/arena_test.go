@@ -0,0 +1,143 @@
+package arena
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedBot answers every request of type request with the message
+// returned by answer, or stays silent if answer returns nil. It returns
+// all messages received until the connection is closed or the game is over.
+func scriptedBot(conn net.Conn, token string, answer func(m ServerMessage) *BotMessage) []ServerMessage {
+	received := []ServerMessage{}
+	encoder := json.NewEncoder(conn)
+	encoder.Encode(BotMessage{Type: TypeHello, Token: token})
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var m ServerMessage
+		json.Unmarshal(scanner.Bytes(), &m)
+		received = append(received, m)
+		switch m.Type {
+		case TypeDeployRequest, TypeFireRequest:
+			if a := answer(m); a != nil {
+				a.Seq = m.Seq
+				encoder.Encode(a)
+			}
+		case TypeGameOver:
+			conn.Close()
+			return received
+		}
+	}
+	return received
+}
+
+func legalBot(m ServerMessage) *BotMessage {
+	if m.Type == TypeDeployRequest {
+		return &BotMessage{Type: TypeDeploy, Class: "Submarine", X: 0, Y: 2 * m.ShipsLeft, Orientation: "e"}
+	}
+	return &BotMessage{Type: TypeFire, Target: "Robo", X: 0, Y: 0}
+}
+
+func testArena() *Arena {
+	a := NewArena(100*time.Millisecond, 2)
+	a.Authenticate = func(token string) (string, error) {
+		if _, err := player.GetByName(token); err != nil {
+			return "", fmt.Errorf("unknown bot %s", token)
+		}
+		return token, nil
+	}
+	return a
+}
+
+func playMatch(a *Arena, first func(m ServerMessage) *BotMessage, second func(m ServerMessage) *BotMessage) ([]ServerMessage, []ServerMessage) {
+	firstServer, firstBot := net.Pipe()
+	secondServer, secondBot := net.Pipe()
+	go a.ServeConn(firstServer)
+	go a.ServeConn(secondServer)
+	done := make(chan []ServerMessage)
+	go func() { done <- scriptedBot(firstBot, "Robo", first) }()
+	secondMessages := scriptedBot(secondBot, "Cyborg", second)
+	return <-done, secondMessages
+}
+
+func lastOfType(messages []ServerMessage, messageType string) *ServerMessage {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Type == messageType {
+			return &messages[i]
+		}
+	}
+	return nil
+}
+
+func TestDisqualification(t *testing.T) {
+	player.NewPlayer("Robo", "")
+	player.NewPlayer("Cyborg", "")
+	illegalBot := func(m ServerMessage) *BotMessage {
+		return &BotMessage{Type: TypeDeploy, Class: "Submarine", X: 100, Y: 100, Orientation: "e"}
+	}
+	silentBot := func(m ServerMessage) *BotMessage {
+		return nil
+	}
+	for name, misbehaving := range map[string]func(m ServerMessage) *BotMessage{"illegal": illegalBot, "silent": silentBot} {
+		robo, cyborg := playMatch(testArena(), legalBot, misbehaving)
+		if over := lastOfType(robo, TypeGameOver); over == nil || over.Winner != "Robo" {
+			t.Errorf("%s bot: expected Robo to win, got %+v", name, over)
+		}
+		if lastOfType(cyborg, TypeDisqualified) == nil {
+			t.Errorf("%s bot: Cyborg was not disqualified", name)
+		}
+		if strikes := lastOfType(cyborg, TypeIllegalMove); strikes == nil || strikes.Strikes != 2 {
+			t.Errorf("%s bot: expected 2 strikes, got %+v", name, strikes)
+		}
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	server, client := net.Pipe()
+	go testArena().ServeConn(server)
+	messages := scriptedBot(client, "Nobody", legalBot)
+	if len(messages) != 1 || messages[0].Type != TypeError {
+		t.Errorf("expected authentication error, got %+v", messages)
+	}
+}
+
+// TestLockedMatch reads a match the way the API handlers do while the bots
+// play it, which the race detector checks.
+func TestLockedMatch(t *testing.T) {
+	player.NewPlayer("Robo", "")
+	player.NewPlayer("Cyborg", "")
+	watched := make(chan struct{})
+	var once sync.Once
+	watching := func(m ServerMessage) *BotMessage {
+		once.Do(func() {
+			g, err := game.GetByUUID(m.GameID)
+			if err != nil {
+				t.Errorf("match %s not found: %s", m.GameID, err)
+				close(watched)
+				return
+			}
+			go func() {
+				defer close(watched)
+				for over := false; !over; {
+					g.Mutex().Lock()
+					g.ShipsSunk("Robo")
+					over = g.State == game.StateFinished
+					g.Mutex().Unlock()
+				}
+			}()
+		})
+		return legalBot(m)
+	}
+	_, cyborg := playMatch(testArena(), watching, legalBot)
+	<-watched
+	if over := lastOfType(cyborg, TypeGameOver); over == nil || over.Winner != "Cyborg" {
+		t.Errorf("expected Cyborg to win, got %+v", over)
+	}
+}
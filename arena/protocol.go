@@ -0,0 +1,152 @@
+// Package arena lets bots play against each other. Bots speak a line-based
+// JSON protocol, either on a plain TCP listener, where the first line has to
+// be {"type": "hello", "token": "<api token>"}, or on the WebSocket at /api/v1/arena.
+// The arena answers with welcome and waiting, pairs two bots and sends
+// game_start. Every deploy_request has to be answered by a deploy message
+// with class, x, y and orientation, every fire_request by a fire message with
+// target, x, y and optionally weapon, both echoing the seq of the request.
+// Game events (ship_deployed, game_running, shot, game_over) are sent to all
+// bots of a game.
+package arena
+
+import (
+	"bufio"
+	"encoding/json"
+	"golang_battleship/board"
+	"net"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// Message types sent by the arena.
+const (
+	TypeWelcome       = "welcome"
+	TypeWaiting       = "waiting"
+	TypeGameStart     = "game_start"
+	TypeDeployRequest = "deploy_request"
+	TypeShipDeployed  = "ship_deployed"
+	TypeGameRunning   = "game_running"
+	TypeFireRequest   = "fire_request"
+	TypeShot          = "shot"
+	TypeIllegalMove   = "illegal_move"
+	TypeDisqualified  = "disqualified"
+	TypeGameOver      = "game_over"
+	TypeError         = "error"
+)
+
+// Message types sent by bots.
+const (
+	TypeHello  = "hello"
+	TypeDeploy = "deploy"
+	TypeFire   = "fire"
+)
+
+// ServerMessage is a single line sent from the arena to a bot. Requests
+// carry a sequence number, which has to be echoed in the answer.
+type ServerMessage struct {
+	Type            string                 `json:"type"`
+	Seq             int                    `json:"seq,omitempty"`
+	Player          string                 `json:"player,omitempty"`
+	GameID          string                 `json:"game_id,omitempty"`
+	Opponents       []string               `json:"opponents,omitempty"`
+	BoardParameters *board.BoardParameters `json:"board_parameters,omitempty"`
+	ShipsLeft       int                    `json:"ships_left,omitempty"`
+	DeadlineMS      int64                  `json:"deadline_ms,omitempty"`
+	Shooter         string                 `json:"shooter,omitempty"`
+	Target          string                 `json:"target,omitempty"`
+	Results         []board.ShotResult     `json:"results,omitempty"`
+	ActivePlayer    string                 `json:"active_player,omitempty"`
+	Winner          string                 `json:"winner,omitempty"`
+	Strikes         int                    `json:"strikes,omitempty"`
+	Reason          string                 `json:"reason,omitempty"`
+}
+
+// BotMessage is a single line sent from a bot to the arena.
+type BotMessage struct {
+	Type        string `json:"type"`
+	Seq         int    `json:"seq,omitempty"`
+	Token       string `json:"token,omitempty"`
+	Class       string `json:"class,omitempty"`
+	Orientation string `json:"orientation,omitempty"`
+	Target      string `json:"target,omitempty"`
+	Weapon      string `json:"weapon,omitempty"`
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+}
+
+// lineConn transports one JSON message per line, either as line of a plain
+// TCP stream or as a single WebSocket text message.
+type lineConn interface {
+	ReadLine() ([]byte, error)
+	WriteLine(line []byte) error
+	// Shutdown closes the connection, telling the peer why if the
+	// transport supports it.
+	Shutdown(reason string) error
+	Close() error
+}
+
+type tcpConn struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+type wsConn struct {
+	conn *ws.Conn
+}
+
+const maxLineSize = 64 * 1024
+
+func newTCPConn(conn net.Conn) *tcpConn {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+	return &tcpConn{conn: conn, scanner: scanner}
+}
+
+func (c *tcpConn) ReadLine() ([]byte, error) {
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, net.ErrClosed
+	}
+	return c.scanner.Bytes(), nil
+}
+
+func (c *tcpConn) WriteLine(line []byte) error {
+	_, err := c.conn.Write(append(line, '\n'))
+	return err
+}
+
+func (c *tcpConn) Shutdown(reason string) error {
+	return c.conn.Close()
+}
+
+func (c *tcpConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *wsConn) ReadLine() ([]byte, error) {
+	_, message, err := c.conn.ReadMessage()
+	return message, err
+}
+
+func (c *wsConn) WriteLine(line []byte) error {
+	return c.conn.WriteMessage(ws.TextMessage, line)
+}
+
+// Shutdown sends a going away close frame before closing the connection.
+func (c *wsConn) Shutdown(reason string) error {
+	message := ws.FormatCloseMessage(ws.CloseGoingAway, reason)
+	c.conn.WriteControl(ws.CloseMessage, message, time.Now().Add(time.Second))
+	return c.conn.Close()
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+func encode(m ServerMessage) []byte {
+	line, _ := json.Marshal(m)
+	return line
+}
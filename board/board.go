@@ -23,10 +23,19 @@ type coordinate struct {
 	x, y int
 }
 
+type ShotResult struct {
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+	Hit  bool   `json:"hit"`
+	Sunk string `json:"sunk,omitempty"`
+}
+
 type BoardParameters struct {
 	SizeX    int `json:"size_x"`
 	SizeY    int `json:"size_y"`
 	MaxShips int `json:"max_ships"`
+	// Fleet limits the ships deployable per class, any class is allowed if it's empty.
+	Fleet map[string]int `json:"fleet,omitempty"`
 }
 
 func NewBoard(bp BoardParameters) Board {
@@ -92,7 +101,103 @@ func (board Board) checkCollision(ship ship.Ship) *ship.Ship {
 	return nil
 }
 
+func (board Board) contains(x, y int) bool {
+	return x >= 0 && y >= 0 && x < board.BoardParameters.SizeX && y < board.BoardParameters.SizeY
+}
+
+func (board Board) ShipCount() int {
+	return len(board.ships)
+}
+
+// SunkCount returns how many of the deployed ships have been destroyed.
+func (board Board) SunkCount() int {
+	sunk := 0
+	for _, ship := range board.ships {
+		if ship.Destroyed() {
+			sunk++
+		}
+	}
+	return sunk
+}
+
+// Ships returns a copy of the deployed ships, with their positions. Only the
+// owner of the board may see them.
+func (board Board) Ships() []ship.Ship {
+	return append([]ship.Ship{}, board.ships...)
+}
+
+func (board Board) AllShipsDestroyed() bool {
+	for _, ship := range board.ships {
+		if !ship.Destroyed() {
+			return false
+		}
+	}
+	return len(board.ships) > 0
+}
+
+// ReceiveFire resolves a shot of weapon w aimed at x/y and records the impacts.
+// Cells which have been fired at before count as misses, so they can't be
+// hit twice.
+func (board *Board) ReceiveFire(x, y int, w weapon.Exploder) ([]ShotResult, error) {
+	if !board.contains(x, y) {
+		return nil, fmt.Errorf("target x:%d/y:%d is out of bounds", x, y)
+	}
+	results := []ShotResult{}
+	for _, c := range w.Explode(weapon.NewCoordinate(x, y)) {
+		if !board.contains(c.X(), c.Y()) {
+			continue
+		}
+		result := ShotResult{X: c.X(), Y: c.Y()}
+		if board.impacted(c.X(), c.Y()) {
+			results = append(results, result)
+			continue
+		}
+		board.impacts = append(board.impacts, impact{c.X(), c.Y(), w})
+		for i := range board.ships {
+			if board.ships[i].Destroyed() || !board.ships[i].Hit(c.X(), c.Y()) {
+				continue
+			}
+			result.Hit = true
+			if board.ships[i].Destroyed() {
+				result.Sunk = board.ships[i].ClassName()
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (board Board) impacted(x, y int) bool {
+	for _, i := range board.impacts {
+		if i.x == x && i.y == y {
+			return true
+		}
+	}
+	return false
+}
+
+func (board Board) classCount(className string) int {
+	n := 0
+	for _, s := range board.ships {
+		if s.ClassName() == className {
+			n++
+		}
+	}
+	return n
+}
+
 func (board *Board) DeployShip(ship ship.Ship) error {
+	if board.MaxShips > 0 && len(board.ships) >= board.MaxShips {
+		return fmt.Errorf("maximum ship capacity (%d) reached", board.MaxShips)
+	}
+	if len(board.Fleet) > 0 && board.classCount(ship.ClassName()) >= board.Fleet[ship.ClassName()] {
+		return fmt.Errorf("fleet allows only %d ships of class %s", board.Fleet[ship.ClassName()], ship.ClassName())
+	}
+	for _, c := range ship.Coordinates() {
+		if !board.contains(c.X(), c.Y()) {
+			return fmt.Errorf("ship %s exceeds the board at %s", ship, c)
+		}
+	}
 	if collidingShip := board.checkCollision(ship); collidingShip != nil {
 		return fmt.Errorf("collision with ship %s detected", collidingShip)
 	}
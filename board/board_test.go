@@ -3,12 +3,13 @@ package board
 import (
 	"fmt"
 	"golang_battleship/ship"
+	"golang_battleship/weapon"
 	"testing"
 )
 
 func TestDeployment(t *testing.T) {
 	someShips := []ship.Ship{*ship.NewShip("Destroyer", 3, 3, "n")}
-	aBoard := Board{BoardParameters{8, 8, 4}, someShips, []impact{}}
+	aBoard := Board{BoardParameters{SizeX: 8, SizeY: 8, MaxShips: 4}, someShips, []impact{}}
 	fmt.Println(aBoard)
 	fmt.Println(aBoard.ships)
 }
@@ -19,7 +20,7 @@ func TestDraw(t *testing.T) {
 		*ship.NewShip("Carrier", 1, 0, "e"),
 		*ship.NewShip("Frigate", 5, 6, "s"),
 	}
-	aBoard := Board{BoardParameters{8, 8, 4}, someShips, []impact{}}
+	aBoard := Board{BoardParameters{SizeX: 8, SizeY: 8, MaxShips: 4}, someShips, []impact{}}
 	drawThis := `# # # # # # # # 
 # # # # # # # # 
 # # # # # F # # 
@@ -34,3 +35,39 @@ D T T T T T T T
 		t.Fail()
 	}
 }
+
+func TestReceiveFire(t *testing.T) {
+	aBoard := NewBoard(BoardParameters{SizeX: 10, SizeY: 10, MaxShips: 2})
+	aBoard.DeployShip(*ship.NewShip("Submarine", 2, 2, "n"))
+	torpedo, _ := weapon.GetByName("Torpedo")
+	if _, err := aBoard.ReceiveFire(10, 3, torpedo); err == nil {
+		t.Errorf("shot out of bounds was accepted")
+	}
+	results, _ := aBoard.ReceiveFire(2, 2, torpedo)
+	if !results[0].Hit || len(results[0].Sunk) > 0 {
+		t.Errorf("expected hit without sinking, got %+v", results[0])
+	}
+	if results, _ = aBoard.ReceiveFire(2, 2, torpedo); results[0].Hit {
+		t.Errorf("cell which was hit before counted as another hit")
+	}
+	results, _ = aBoard.ReceiveFire(2, 3, torpedo)
+	if results[0].Sunk != "Submarine" || !aBoard.AllShipsDestroyed() {
+		t.Errorf("expected Submarine to be sunk, got %+v", results[0])
+	}
+}
+
+func TestDeployShipFleet(t *testing.T) {
+	aBoard := NewBoard(BoardParameters{SizeX: 10, SizeY: 10, MaxShips: 3, Fleet: map[string]int{"Submarine": 1, "Frigate": 2}})
+	if err := aBoard.DeployShip(*ship.NewShip("Submarine", 0, 0, "n")); err != nil {
+		t.Fatalf("deploying the first Submarine failed: %s", err)
+	}
+	if err := aBoard.DeployShip(*ship.NewShip("Submarine", 2, 0, "n")); err == nil {
+		t.Errorf("second Submarine exceeds the fleet and was deployed")
+	}
+	if err := aBoard.DeployShip(*ship.NewShip("Carrier", 4, 0, "n")); err == nil {
+		t.Errorf("Carrier isn't part of the fleet and was deployed")
+	}
+	if err := aBoard.DeployShip(*ship.NewShip("Frigate", 6, 0, "n")); err != nil {
+		t.Errorf("deploying a Frigate failed: %s", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Package chat holds the moderation tools of the game chat, a profanity
+// filter and a rate limiter.
+package chat
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Filter masks the words of its list, matching whole words case-insensitively.
+type Filter struct {
+	words map[string]bool
+}
+
+func NewFilter(words []string) *Filter {
+	f := &Filter{words: map[string]bool{}}
+	for _, w := range words {
+		if w = strings.TrimSpace(w); len(w) > 0 {
+			f.words[strings.ToLower(w)] = true
+		}
+	}
+	return f
+}
+
+// Clean replaces every letter of filtered words in text with *.
+func (f *Filter) Clean(text string) string {
+	if f == nil || len(f.words) == 0 {
+		return text
+	}
+	runes := []rune(text)
+	start := -1
+	for i := 0; i <= len(runes); i++ {
+		inWord := i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]))
+		if inWord && start < 0 {
+			start = i
+		}
+		if !inWord && start >= 0 {
+			if f.words[strings.ToLower(string(runes[start:i]))] {
+				for j := start; j < i; j++ {
+					runes[j] = '*'
+				}
+			}
+			start = -1
+		}
+	}
+	return string(runes)
+}
+
+// Limiter allows limit messages per key within a sliding window.
+type Limiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	sent      map[string][]time.Time
+	lastSweep time.Time
+}
+
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{limit: limit, window: window, sent: map[string][]time.Time{}}
+}
+
+// Allow records a message of key if it's within the limit.
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.sweep(now)
+	recent := []time.Time{}
+	for _, t := range l.sent[key] {
+		if now.Sub(t) < l.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.sent[key] = recent
+		return false
+	}
+	l.sent[key] = append(recent, now)
+	return true
+}
+
+// sweep drops the keys without messages within the window at most once per
+// window. l.mu has to be held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for key, sent := range l.sent {
+		if len(sent) == 0 || now.Sub(sent[len(sent)-1]) >= l.window {
+			delete(l.sent, key)
+		}
+	}
+}
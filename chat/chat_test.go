@@ -0,0 +1,45 @@
+package chat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	f := NewFilter([]string{"darn", " Heck "})
+	tests := map[string]string{
+		"darn it":             "**** it",
+		"what the HECK!":      "what the ****!",
+		"darning is fine":     "darning is fine",
+		"heck,darn;heck":      "****,****;****",
+		"nothing to see here": "nothing to see here",
+	}
+	for in, want := range tests {
+		if got := f.Clean(in); got != want {
+			t.Errorf("Clean(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := NewFilter(nil).Clean("darn"); got != "darn" {
+		t.Errorf("empty filter changed the text to %q", got)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(2, 50*time.Millisecond)
+	if !l.Allow("Polnareff") || !l.Allow("Polnareff") {
+		t.Fatal("messages within the limit were rejected")
+	}
+	if l.Allow("Polnareff") {
+		t.Errorf("message over the limit was allowed")
+	}
+	if !l.Allow("Avdol") {
+		t.Errorf("limit isn't per key")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !l.Allow("Polnareff") {
+		t.Errorf("message after the window was rejected")
+	}
+	if _, ok := l.sent["Avdol"]; ok || len(l.sent) != 1 {
+		t.Errorf("expected the expired key to be swept, got %d keys", len(l.sent))
+	}
+}
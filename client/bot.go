@@ -0,0 +1,199 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"golang_battleship/arena"
+	"golang_battleship/board"
+	"golang_battleship/ship"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+)
+
+type target struct {
+	x, y int
+}
+
+// Bot is the reference bot for the bot arena. It deploys its fleet at random
+// and hunts on a checkerboard pattern, closing in on the neighbours of hits.
+type Bot struct {
+	name      string
+	bp        board.BoardParameters
+	opponents []string
+	fleet     []ship.Ship
+	fired     map[string]map[target]bool
+	hunt      map[string][]target
+}
+
+// fleetClasses are deployed in this order, longest first.
+var fleetClasses = []string{"Carrier", "Cruiser", "Destroyer", "Frigate", "Submarine"}
+
+// RunBot connects the reference bot to the plain TCP listener of the bot
+// arena and plays until the connection fails.
+func RunBot(addr string, port int, token string) error {
+	conn, err := net.Dial("tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return PlayBot(conn, token, 0)
+}
+
+// PlayBot speaks the line-based arena protocol on conn and returns after
+// the given amount of games, or never if games is 0.
+func PlayBot(conn io.ReadWriter, token string, games int) error {
+	b := &Bot{}
+	encoder := json.NewEncoder(conn)
+	if err := encoder.Encode(arena.BotMessage{Type: arena.TypeHello, Token: token}); err != nil {
+		return err
+	}
+	played := 0
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var m arena.ServerMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return fmt.Errorf("failed to decode arena message: %s", err)
+		}
+		switch m.Type {
+		case arena.TypeWelcome:
+			b.name = m.Player
+			log.Printf("connected to bot arena as %s", b.name)
+		case arena.TypeGameStart:
+			b.start(*m.BoardParameters, m.Opponents)
+			log.Printf("game %s against %v started", m.GameID, m.Opponents)
+		case arena.TypeDeployRequest:
+			answer := b.deploy()
+			answer.Seq = m.Seq
+			if err := encoder.Encode(answer); err != nil {
+				return err
+			}
+		case arena.TypeFireRequest:
+			answer := b.fire()
+			answer.Seq = m.Seq
+			if err := encoder.Encode(answer); err != nil {
+				return err
+			}
+		case arena.TypeShot:
+			if m.Shooter == b.name {
+				b.record(m.Target, m.Results)
+			}
+		case arena.TypeIllegalMove:
+			log.Printf("illegal move (%d): %s", m.Strikes, m.Reason)
+		case arena.TypeDisqualified:
+			return fmt.Errorf("disqualified from game %s: %s", m.GameID, m.Reason)
+		case arena.TypeError:
+			return fmt.Errorf("bot arena error: %s", m.Reason)
+		case arena.TypeGameOver:
+			log.Printf("game %s won by %s", m.GameID, m.Winner)
+			played += 1
+			if games > 0 && played >= games {
+				return nil
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func (b *Bot) start(bp board.BoardParameters, opponents []string) {
+	b.bp = bp
+	b.opponents = opponents
+	b.fleet = []ship.Ship{}
+	b.fired = make(map[string]map[target]bool)
+	b.hunt = make(map[string][]target)
+	for _, o := range opponents {
+		b.fired[o] = make(map[target]bool)
+	}
+}
+
+func (b *Bot) fits(s ship.Ship) bool {
+	for _, c := range s.Coordinates() {
+		if c.X() < 0 || c.Y() < 0 || c.X() >= b.bp.SizeX || c.Y() >= b.bp.SizeY {
+			return false
+		}
+	}
+	for _, other := range b.fleet {
+		if s.Collides(other) {
+			return false
+		}
+	}
+	return true
+}
+
+// deploy places the next class of the fleet at a random free position.
+func (b *Bot) deploy() arena.BotMessage {
+	for i := range fleetClasses {
+		class := fleetClasses[(len(b.fleet)+i)%len(fleetClasses)]
+		for _, n := range rand.Perm(b.bp.SizeX * b.bp.SizeY * 2) {
+			orientation := []string{"e", "n"}[n%2]
+			x, y := (n/2)%b.bp.SizeX, (n/2)/b.bp.SizeX
+			s := ship.NewShip(class, x, y, orientation)
+			if b.fits(*s) {
+				b.fleet = append(b.fleet, *s)
+				return arena.BotMessage{Type: arena.TypeDeploy, Class: class, X: x, Y: y, Orientation: orientation}
+			}
+		}
+	}
+	return arena.BotMessage{Type: arena.TypeDeploy, Class: fleetClasses[len(fleetClasses)-1]}
+}
+
+// fire aims at the neighbours of earlier hits first, otherwise at a random
+// unfired position of the checkerboard pattern.
+func (b *Bot) fire() arena.BotMessage {
+	for _, o := range b.opponents {
+		for len(b.hunt[o]) > 0 {
+			t := b.hunt[o][0]
+			b.hunt[o] = b.hunt[o][1:]
+			if b.unfired(o, t) {
+				return b.shoot(o, t)
+			}
+		}
+		candidates := []target{}
+		fallback := []target{}
+		for x := 0; x < b.bp.SizeX; x++ {
+			for y := 0; y < b.bp.SizeY; y++ {
+				t := target{x, y}
+				if !b.unfired(o, t) {
+					continue
+				}
+				if (x+y)%2 == 0 {
+					candidates = append(candidates, t)
+				} else {
+					fallback = append(fallback, t)
+				}
+			}
+		}
+		if len(candidates) == 0 {
+			candidates = fallback
+		}
+		if len(candidates) > 0 {
+			return b.shoot(o, candidates[rand.Intn(len(candidates))])
+		}
+	}
+	return arena.BotMessage{Type: arena.TypeFire}
+}
+
+func (b *Bot) unfired(opponent string, t target) bool {
+	inside := t.x >= 0 && t.y >= 0 && t.x < b.bp.SizeX && t.y < b.bp.SizeY
+	return inside && !b.fired[opponent][t]
+}
+
+func (b *Bot) shoot(opponent string, t target) arena.BotMessage {
+	b.fired[opponent][t] = true
+	return arena.BotMessage{Type: arena.TypeFire, Target: opponent, X: t.x, Y: t.y}
+}
+
+func (b *Bot) record(opponent string, results []board.ShotResult) {
+	if _, ok := b.fired[opponent]; !ok {
+		return
+	}
+	for _, r := range results {
+		b.fired[opponent][target{r.X, r.Y}] = true
+		if r.Hit && len(r.Sunk) == 0 {
+			b.hunt[opponent] = append(b.hunt[opponent], target{r.X + 1, r.Y}, target{r.X - 1, r.Y}, target{r.X, r.Y + 1}, target{r.X, r.Y - 1})
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"golang_battleship/arena"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPlayBot(t *testing.T) {
+	player.NewPlayer("Hal", "")
+	player.NewPlayer("Marvin", "")
+	a := arena.NewArena(time.Second, 3)
+	a.Authenticate = func(token string) (string, error) {
+		return token, nil
+	}
+	errs := make(chan error)
+	for _, name := range []string{"Hal", "Marvin"} {
+		server, bot := net.Pipe()
+		go a.ServeConn(server)
+		go func(name string) {
+			errs <- PlayBot(bot, name, 1)
+			bot.Close()
+		}(name)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("reference bot failed: %s", err)
+		}
+	}
+	g := game.AllGames[len(game.AllGames)-1]
+	if g.State != game.StateFinished || (g.Winner != "Hal" && g.Winner != "Marvin") {
+		t.Errorf("expected finished bot arena game, got state %d with winner %q", g.State, g.Winner)
+	}
+}
@@ -1,24 +1,35 @@
 package client
 
 import (
+	"crypto/tls"
 	"log"
+	"net"
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"time"
 
 	ws "github.com/gorilla/websocket"
 )
 
-func Connect(addr string, port int) {
+// Connect opens a WebSocket to the server, via wss:// if useTLS is set.
+// insecure skips the certificate verification, for self-signed development
+// certificates.
+func Connect(addr string, port int, useTLS bool, insecure bool) {
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
-	u := url.URL{Scheme: "ws", Host: addr, Path: "/echo"}
+	u := url.URL{Scheme: "ws", Host: net.JoinHostPort(addr, strconv.Itoa(port)), Path: "/echo"}
+	dialer := *ws.DefaultDialer
+	if useTLS {
+		u.Scheme = "wss"
+		dialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecure}
+	}
 	log.Printf("connecting to %s", u.String())
 
-	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	c, _, err := dialer.Dial(u.String(), nil)
 	if err != nil {
 		log.Fatal("dial:", err)
 	}
@@ -0,0 +1,236 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"golang_battleship/api"
+	"golang_battleship/board"
+	"golang_battleship/game"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+)
+
+// Client talks to the REST API of a battleship server. It keeps the jwt and
+// CSRF cookies in its cookie jar and sends the CSRF token along with every
+// unsafe request. Setting Token authenticates by api token instead.
+type Client struct {
+	BaseURL    *url.URL
+	HTTPClient *http.Client
+	Token      string
+	csrfToken  string
+}
+
+// APIError is returned for every response with an error status, the other
+// fields hold the error envelope if there was one.
+type APIError struct {
+	StatusCode  int
+	Code        api.ErrorCode
+	Message     string
+	RequestID   string
+	FieldErrors []api.FieldError
+}
+
+var (
+	ErrBadRequest      = &APIError{StatusCode: http.StatusBadRequest}
+	ErrUnauthorized    = &APIError{StatusCode: http.StatusUnauthorized}
+	ErrForbidden       = &APIError{StatusCode: http.StatusForbidden}
+	ErrNotFound        = &APIError{StatusCode: http.StatusNotFound}
+	ErrTooManyRequests = &APIError{StatusCode: http.StatusTooManyRequests}
+)
+
+const csrfHeader = "X-CSRF-Token"
+
+func (e *APIError) Error() string {
+	if len(e.Message) == 0 {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%d %s: %s (%s)", e.StatusCode, http.StatusText(e.StatusCode), e.Message, e.Code)
+}
+
+// Is matches errors by status code, so errors.Is(err, ErrNotFound) works
+// regardless of the message. Targets with a Code match by code instead,
+// e.g. errors.Is(err, &APIError{Code: api.ErrCSRFInvalid}).
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	if !ok {
+		return false
+	}
+	if len(t.Code) > 0 {
+		return t.Code == e.Code
+	}
+	return t.StatusCode == e.StatusCode
+}
+
+func NewClient(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		BaseURL: u,
+		HTTPClient: &http.Client{
+			Jar: jar,
+			// login answers with a redirect to the dashboard, which is of no interest
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}, nil
+}
+
+// do sends an authenticated request, fetching a CSRF token first if an
+// unsafe request is about to be sent without one.
+func (c *Client) do(method string, path string, query url.Values, body interface{}, result interface{}) error {
+	if method != http.MethodGet && len(c.Token) == 0 && len(c.csrfToken) == 0 {
+		if err := c.send(http.MethodGet, "/players/me", nil, nil, nil); err != nil {
+			return err
+		}
+	}
+	return c.send(method, path, query, body, result)
+}
+
+func (c *Client) send(method string, path string, query url.Values, body interface{}, result interface{}) error {
+	u := c.BaseURL.ResolveReference(&url.URL{Path: api.API_PREFIX + path, RawQuery: query.Encode()})
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(c.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if method != http.MethodGet {
+		req.Header.Set(csrfHeader, c.csrfToken)
+		req.Header.Set("Referer", c.BaseURL.String())
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if t := res.Header.Get(csrfHeader); len(t) > 0 {
+		c.csrfToken = t
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		e := &APIError{StatusCode: res.StatusCode}
+		var b api.ErrorResponseBody
+		if err := json.NewDecoder(res.Body).Decode(&b); err == nil {
+			e.Code, e.Message, e.RequestID, e.FieldErrors = b.Code, b.Message, b.RequestID, b.FieldErrors
+		}
+		return e
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// Login stores the jwt cookie of playername and fetches a CSRF token.
+func (c *Client) Login(playername string, password string) error {
+	if err := c.send(http.MethodPost, "/login", nil, api.LoginBody{Playername: playername, Password: password}, nil); err != nil {
+		return err
+	}
+	c.csrfToken = ""
+	return c.send(http.MethodGet, "/players/me", nil, nil, nil)
+}
+
+func (c *Client) Logout() error {
+	c.csrfToken = ""
+	return c.do(http.MethodGet, "/logout", nil, nil, nil)
+}
+
+func (c *Client) Register(playername string, password string) (string, error) {
+	var res api.RegisterPlayerResponseBody
+	err := c.do(http.MethodPost, "/players", nil, api.RegisterPlayerBody{Playername: playername, Password: password}, &res)
+	return res.ID, err
+}
+
+// ListGames returns all games, newest first, filtered by state unless it is empty.
+func (c *Client) ListGames(state string) ([]api.GameSummary, error) {
+	query := url.Values{}
+	if len(state) > 0 {
+		query.Set("state", state)
+	}
+	games := []api.GameSummary{}
+	for {
+		page, err := c.ListGamesPage(query)
+		if err != nil {
+			return games, err
+		}
+		games = append(games, page.Games...)
+		if len(page.NextCursor) == 0 {
+			return games, nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+// ListGamesPage returns a single page of games, query takes the filter, sort
+// and paging parameters of the games endpoint.
+func (c *Client) ListGamesPage(query url.Values) (api.ListGamesResponseBody, error) {
+	var res api.ListGamesResponseBody
+	err := c.do(http.MethodGet, "/games", query, nil, &res)
+	return res, err
+}
+
+func (c *Client) GetGame(id string) (api.GetGameResponseBody, error) {
+	var res api.GetGameResponseBody
+	err := c.do(http.MethodGet, "/games/"+id, nil, nil, &res)
+	return res, err
+}
+
+// CreateGame creates a game, zero board parameters are replaced by the defaults.
+func (c *Client) CreateGame(b api.CreateGameBody) (string, error) {
+	if bp := b.BoardParameters; bp.SizeX == 0 && bp.SizeY == 0 && bp.MaxShips == 0 {
+		b.BoardParameters = board.BoardParameters{SizeX: game.DefaultBoardsizeX, SizeY: game.DefaultBoardsizeY, MaxShips: game.DefaultMaxships}
+	}
+	var res api.CreateGameResponseBody
+	err := c.do(http.MethodPost, "/games", nil, b, &res)
+	return res.ID, err
+}
+
+func (c *Client) Join(id string, b api.JoinGameBody) error {
+	return c.do(http.MethodPost, "/games/"+id+"/join", nil, b, nil)
+}
+
+func (c *Client) Leave(id string) error {
+	return c.do(http.MethodPost, "/games/"+id+"/leave", nil, nil, nil)
+}
+
+func (c *Client) Deploy(id string, b api.DeployShipBody) error {
+	return c.do(http.MethodPost, "/games/"+id+"/deploy", nil, b, nil)
+}
+
+func (c *Client) Fire(id string, b api.FireBody) (api.FireResponseBody, error) {
+	var res api.FireResponseBody
+	err := c.do(http.MethodPost, "/games/"+id+"/fire", nil, b, &res)
+	return res, err
+}
+
+// Scoreboard returns the best ranking players, or all of them if ranking is 0.
+func (c *Client) Scoreboard(ranking int) (api.ScoreboardResponseBody, error) {
+	query := url.Values{}
+	if ranking > 0 {
+		query.Set("ranking", strconv.Itoa(ranking))
+	}
+	scoreboard := api.ScoreboardResponseBody{}
+	err := c.do(http.MethodGet, "/players", query, nil, &scoreboard)
+	return scoreboard, err
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"errors"
+	"golang_battleship/api"
+	"golang_battleship/player"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestClient(t *testing.T, srv *httptest.Server) *Client {
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.HTTPClient.Transport = srv.Client().Transport
+	return c
+}
+
+func TestClient(t *testing.T) {
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.MinCost)
+	player.NewPlayer("Donald", string(passwordHash))
+	srv := httptest.NewTLSServer(api.NewRouter([]byte("abcdefg"), []byte("01234567890123456789012345678901")))
+	defer srv.Close()
+
+	donald := newTestClient(t, srv)
+	if err := donald.Login("Donald", "wrongpassword"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected unauthorized login with wrong password, got %v", err)
+	}
+	if err := donald.Login("Donald", "password1"); err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	if _, err := donald.Register("Daisy", "password2"); err != nil {
+		t.Errorf("registration failed: %s", err)
+	}
+	if _, err := donald.Register("Daisy", "password2"); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("expected bad request registering a taken name, got %v", err)
+	}
+
+	id, err := donald.CreateGame(api.CreateGameBody{Description: "SDK Game"})
+	if err != nil {
+		t.Fatalf("failed to create game: %s", err)
+	}
+	daisy := newTestClient(t, srv)
+	if err := daisy.Login("Daisy", "password2"); err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	if err := daisy.Join(id, api.JoinGameBody{}); err != nil {
+		t.Errorf("failed to join game: %s", err)
+	}
+	games, err := daisy.ListGames("open")
+	if err != nil {
+		t.Fatalf("failed to list games: %s", err)
+	}
+	if len(games) != 1 || games[0].ID != id || len(games[0].Participants) != 2 || games[0].Participants[1] != "Daisy" {
+		t.Errorf("expected Daisy to participate in game %s, got %+v", id, games)
+	}
+	if err := daisy.Leave(id); err != nil {
+		t.Errorf("failed to leave game: %s", err)
+	}
+
+	err = donald.Join(uuid.New().String(), api.JoinGameBody{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 || apiErr.Code != api.ErrNotFound || len(apiErr.Message) == 0 || len(apiErr.RequestID) == 0 {
+		t.Errorf("expected not found error with message and request id, got %v", err)
+	}
+
+	scoreboard, err := donald.Scoreboard(1)
+	if err != nil || len(scoreboard) != 1 {
+		t.Errorf("expected scoreboard with a single entry, got %v, %v", scoreboard, err)
+	}
+}
@@ -4,19 +4,83 @@ import (
 	"crypto/rand"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type cmdFlags struct {
-	Host          string
-	Port          int
-	Loglevel      int
-	Server        bool
-	JwtSigningKey []byte
-	CSRFAuthKey   []byte
+	Command         string              `yaml:"-"`
+	Host            string              `yaml:"host"`
+	Port            int                 `yaml:"port"`
+	MetricsPort     int                 `yaml:"metrics_port"`
+	Loglevel        int                 `yaml:"loglevel"`
+	LogFormat       string              `yaml:"log_format"`
+	JwtSigningKey   Secret              `yaml:"jwt_signing_key"`
+	CSRFAuthKey     Secret              `yaml:"csrf_auth_key"`
+	KeyFile         string              `yaml:"key_file"`
+	KeyGracePeriod  time.Duration       `yaml:"key_grace_period"`
+	JWTLifetime     time.Duration       `yaml:"jwt_lifetime"`
+	InviteLifetime  time.Duration       `yaml:"invite_lifetime"`
+	StateFile       string              `yaml:"state_file"`
+	ShutdownTimeout time.Duration       `yaml:"shutdown_timeout"`
+	Game            gameFlags           `yaml:"game"`
+	Chat            chatFlags           `yaml:"chat"`
+	PasswordPolicy  passwordPolicyFlags `yaml:"password_policy"`
+	LoginLockout    loginLockoutFlags   `yaml:"login_lockout"`
+	BotArena        botArenaFlags       `yaml:"bot_arena"`
+	TLS             tlsFlags            `yaml:"tls"`
+	BotToken        Secret              `yaml:"bot_token"`
+}
+
+type gameFlags struct {
+	BoardSizeX      int            `yaml:"board_size_x"`
+	BoardSizeY      int            `yaml:"board_size_y"`
+	MaxShips        int            `yaml:"max_ships"`
+	MaxParticipants int            `yaml:"max_participants"`
+	Fleet           map[string]int `yaml:"fleet"`
+	// TurnTimeout of zero disables the turn clock.
+	TurnTimeout           time.Duration `yaml:"turn_timeout"`
+	DisconnectGracePeriod time.Duration `yaml:"disconnect_grace_period"`
+}
+
+type chatFlags struct {
+	History        int           `yaml:"history"`
+	RateLimit      int           `yaml:"rate_limit"`
+	RateWindow     time.Duration `yaml:"rate_window"`
+	ProfanityWords []string      `yaml:"profanity_words"`
+}
+
+type passwordPolicyFlags struct {
+	MinLength     int  `yaml:"min_length"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+}
+
+type loginLockoutFlags struct {
+	Threshold int           `yaml:"threshold"`
+	Duration  time.Duration `yaml:"duration"`
+}
+
+type tlsFlags struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	SelfSigned   bool   `yaml:"self_signed"`
+	RedirectPort int    `yaml:"redirect_port"`
+	Client       bool   `yaml:"client"`
+	Insecure     bool   `yaml:"insecure"`
+}
+
+type botArenaFlags struct {
+	Port            int           `yaml:"port"`
+	Deadline        time.Duration `yaml:"deadline"`
+	MaxIllegalMoves int           `yaml:"max_illegal_moves"`
 }
 
 func validateLoglevel(loglevel int) error {
@@ -26,13 +90,36 @@ func validateLoglevel(loglevel int) error {
 	return nil
 }
 
+func validateLogFormat(format string) error {
+	if format != "json" && format != "text" {
+		return fmt.Errorf("bad log format: %s", format)
+	}
+	return nil
+}
+
 func validatePort(port int) error {
-	if !(port > 0 && port < 65354) {
+	if !(port > 0 && port <= 65535) {
 		return fmt.Errorf("bad port: %d", port)
 	}
 	return nil
 }
 
+func validateTLSFlags(f tlsFlags) error {
+	if (len(f.CertFile) > 0) != (len(f.KeyFile) > 0) {
+		return fmt.Errorf("tls-cert and tls-key have to be given together")
+	}
+	if f.SelfSigned && len(f.CertFile) > 0 {
+		return fmt.Errorf("tls-self-signed can't be combined with tls-cert")
+	}
+	if f.RedirectPort != 0 {
+		if !f.SelfSigned && len(f.CertFile) == 0 {
+			return fmt.Errorf("tls-redirect-port requires TLS")
+		}
+		return validatePort(f.RedirectPort)
+	}
+	return nil
+}
+
 func validateHost(host string) error {
 	if ok := net.ParseIP(host); ok == nil {
 		return fmt.Errorf("bad host: %s", host)
@@ -40,8 +127,12 @@ func validateHost(host string) error {
 	return nil
 }
 
-func setLogger(loglevel int) {
-	log.SetFormatter(&log.JSONFormatter{})
+func setLogger(loglevel int, format string) {
+	if format == "text" {
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	} else {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.Level(loglevel + 2)) //skip panic and fatal level, start at error
 }
@@ -63,39 +154,148 @@ func GenerateRandomKey(keysize int) ([]byte, error) {
 	return b, nil
 }
 
-func ParseCmdFlags() cmdFlags {
-	var host string
-	var port int
-	var loglevel int
-	var server bool
-	var jwtSigningKey []byte
-	var csrfAuthKey []byte
+// newFlagSet binds the flags to the fields of c, their defaults are the
+// current values of c.
+func newFlagSet(c *cmdFlags, configFile *string, printConfig *bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.Command, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags]%s\n\nFlags:\n", programName(), c.Command, commandArgs[c.Command])
+		fs.PrintDefaults()
+	}
+	fs.StringVar(configFile, "config", "", "YAML config file, flags take precedence over BATTLESHIP_* env vars, which take precedence over the file")
+	fs.BoolVar(printConfig, "print-config", false, "Print the effective configuration with secrets redacted and exit")
+	fs.StringVar(&c.Host, "host", c.Host, "Server address (or interface to listen on for serve)")
+	fs.IntVar(&c.Port, "port", c.Port, "Port to connect to (or to listen on for serve)")
+	fs.IntVar(&c.MetricsPort, "metrics-port", c.MetricsPort, "Port of a separate listener for /metrics (0 serves them on port)")
+	fs.IntVar(&c.Loglevel, "loglevel", c.Loglevel, "Log verbosity (0 (error) - 3 (debug)")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "Log format, json or text, access logs are written at loglevel 2 (info)")
+	fs.StringVar(&c.KeyFile, "key-file", c.KeyFile, "JSON file with the JWT and CSRF keys, reloaded on SIGHUP, replaces BATTLESHIP_JWTSIGNINGKEY and BATTLESHIP_CSRFAUTHKEY")
+	fs.DurationVar(&c.KeyGracePeriod, "key-grace-period", c.KeyGracePeriod, "Time the previous keys stay valid after a key rotation")
+	fs.DurationVar(&c.JWTLifetime, "jwt-lifetime", c.JWTLifetime, "Time until jwts issued at login expire")
+	fs.DurationVar(&c.InviteLifetime, "invite-lifetime", c.InviteLifetime, "Time until invite codes for private games expire")
+	fs.StringVar(&c.StateFile, "state-file", c.StateFile, "JSON snapshot the players and games are restored from and saved to on shutdown (empty disables it)")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "Time in-flight requests get to finish on shutdown")
+	fs.IntVar(&c.Game.BoardSizeX, "board-size-x", c.Game.BoardSizeX, "Default board width of new games")
+	fs.IntVar(&c.Game.BoardSizeY, "board-size-y", c.Game.BoardSizeY, "Default board height of new games")
+	fs.IntVar(&c.Game.MaxShips, "max-ships", c.Game.MaxShips, "Default number of ships per player in new games")
+	fs.IntVar(&c.Game.MaxParticipants, "max-participants", c.Game.MaxParticipants, "Default number of participants of new games")
+	fs.Var(fleetValue{&c.Game.Fleet}, "fleet", "Ships per class allowed in new games, e.g. Carrier=1,Submarine=2 (empty allows any class)")
+	fs.DurationVar(&c.Game.TurnTimeout, "turn-timeout", c.Game.TurnTimeout, "Time of a turn until it passes on (0 disables the turn clock)")
+	fs.DurationVar(&c.Game.DisconnectGracePeriod, "disconnect-grace-period", c.Game.DisconnectGracePeriod, "Time a participant whose game socket dropped has to reconnect before forfeiting, the turn clock is paused meanwhile")
+	fs.IntVar(&c.Chat.History, "chat-history", c.Chat.History, "Chat messages kept per game")
+	fs.IntVar(&c.Chat.RateLimit, "chat-rate-limit", c.Chat.RateLimit, "Chat messages a player may send per chat-rate-window")
+	fs.DurationVar(&c.Chat.RateWindow, "chat-rate-window", c.Chat.RateWindow, "Window of the chat rate limit")
+	fs.Var(listValue{&c.Chat.ProfanityWords}, "profanity-words", "Comma separated words masked in chat messages")
+	fs.IntVar(&c.PasswordPolicy.MinLength, "password-min-length", c.PasswordPolicy.MinLength, "Minimum length of player passwords")
+	fs.BoolVar(&c.PasswordPolicy.RequireUpper, "password-require-upper", c.PasswordPolicy.RequireUpper, "Require an uppercase letter in player passwords")
+	fs.BoolVar(&c.PasswordPolicy.RequireLower, "password-require-lower", c.PasswordPolicy.RequireLower, "Require a lowercase letter in player passwords")
+	fs.BoolVar(&c.PasswordPolicy.RequireDigit, "password-require-digit", c.PasswordPolicy.RequireDigit, "Require a digit in player passwords")
+	fs.BoolVar(&c.PasswordPolicy.RequireSymbol, "password-require-symbol", c.PasswordPolicy.RequireSymbol, "Require a symbol in player passwords")
+	fs.IntVar(&c.LoginLockout.Threshold, "login-lockout-threshold", c.LoginLockout.Threshold, "Failed logins per account until it gets locked out temporarily (0 disables it)")
+	fs.DurationVar(&c.LoginLockout.Duration, "login-lockout-duration", c.LoginLockout.Duration, "Duration of a login lockout")
+	fs.StringVar(&c.TLS.CertFile, "tls-cert", c.TLS.CertFile, "PEM certificate file, serves HTTPS together with tls-key")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "PEM private key file of tls-cert")
+	fs.BoolVar(&c.TLS.SelfSigned, "tls-self-signed", c.TLS.SelfSigned, "Serve HTTPS with a self-signed certificate generated at startup, for development only")
+	fs.IntVar(&c.TLS.RedirectPort, "tls-redirect-port", c.TLS.RedirectPort, "Plain HTTP port redirecting to HTTPS (0 disables it)")
+	fs.BoolVar(&c.TLS.Client, "tls", c.TLS.Client, "Connect to the server via wss:// (play)")
+	fs.BoolVar(&c.TLS.Insecure, "tls-insecure", c.TLS.Insecure, "Skip the verification of the server certificate, e.g. a self-signed one (play)")
+	fs.IntVar(&c.BotArena.Port, "bot-port", c.BotArena.Port, "Port of the plain TCP listener for the bot arena (0 disables it), simulate connects to it")
+	fs.DurationVar(&c.BotArena.Deadline, "bot-deadline", c.BotArena.Deadline, "Time bots have to answer deployment and fire requests")
+	fs.IntVar(&c.BotArena.MaxIllegalMoves, "bot-max-illegal-moves", c.BotArena.MaxIllegalMoves, "Illegal or late moves per game until a bot gets disqualified")
+	return fs
+}
+
+// Commands are the subcommands in the order of the usage.
+var Commands = []struct {
+	Name     string
+	Synopsis string
+}{
+	{"serve", "Run the server"},
+	{"play", "Run the interactive client"},
+	{"simulate", "Run the reference bot against the bot arena on host and bot-port, its api token is read from BATTLESHIP_BOT_TOKEN"},
+	{"admin", "Manage players and games in the state file while the server is stopped"},
+	{"keygen", "Generate BATTLESHIP_JWTSIGNINGKEY and BATTLESHIP_CSRFAUTHKEY values"},
+	{"version", "Print the version"},
+}
+
+// commandArgs are the positional arguments of the subcommands taking any.
+var commandArgs = map[string]string{
+	"admin": " players|games <action> [args]",
+}
 
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", programName())
+	for _, c := range Commands {
+		fmt.Fprintf(w, "  %-9s %s\n", c.Name, c.Synopsis)
+	}
+	fmt.Fprintf(w, "\nRun %s <command> -h for the flags of a command.\n", programName())
+}
 
-	
-	flag.StringVar(&host, "host", "0.0.0.0", "Server address (or interface for server mode)")
-	flag.IntVar(&port, "port", 80, "Port to connect to (or to listen on for server mode)")
-	flag.IntVar(&loglevel, "loglevel", 0, "Log verbosity (0 (error) - 3 (debug)")
-	flag.BoolVar(&server, "server", false, "Run as server")
-	flag.Parse()
-	setLogger(loglevel)
-	jwtSigningKey, err := GetKeyFromEnv("BATTLESHIP_JWTSIGNINGKEY")
+// ParseCmdFlags returns the configuration of the subcommand in os.Args along
+// with its positional arguments, keygen and version take no configuration.
+func ParseCmdFlags() (cmdFlags, []string) {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	switch command {
+	case "keygen", "version":
+		return cmdFlags{Command: command}, os.Args[2:]
+	case "help", "-h", "-help", "--help":
+		usage(os.Stdout)
+		os.Exit(0)
+	}
+	known := false
+	for _, c := range Commands {
+		known = known || c.Name == command
+	}
+	if !known {
+		fmt.Fprintf(os.Stderr, "unknown command %s\n\n", command)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	c, args, printConfig, err := loadConfig(command, os.Args[2:], os.LookupEnv)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
 	if err != nil {
-		log.Warn(err)
-		jwtSigningKey, err = GenerateRandomKey(32)
+		log.Fatal(err)
+	}
+	setLogger(c.Loglevel, c.LogFormat)
+	if printConfig {
+		out, err := c.YAML()
 		if err != nil {
-			panic(fmt.Errorf("failed to generate JWT signing key: %s", err))
+			log.Fatal(err)
 		}
-		log.Warn("generated JWT signing key: ", jwtSigningKey)
+		fmt.Print(out)
+		os.Exit(0)
 	}
-	csrfAuthKey, err = GetKeyFromEnv("BATTLESHIP_CSRFAUTHKEY")
-	if err != nil {
-		log.Warn(err)
-		csrfAuthKey, err = GenerateRandomKey(32)
-		if err != nil {
-			panic(fmt.Errorf("failed to generate CSRF auth key: %s", err))
+	if command == "serve" && len(c.KeyFile) == 0 {
+		// without configured keys sessions and CSRF tokens don't survive restarts
+		if len(c.JwtSigningKey) == 0 {
+			log.Warn("no JWT signing key configured, using an ephemeral one, generate one with keygen and set BATTLESHIP_JWTSIGNINGKEY or use a key file")
+			c.JwtSigningKey = mustGenerateKey("JWT signing key")
 		}
-		log.Warn("generated CSRF auth key: ", csrfAuthKey)
+		if len(c.CSRFAuthKey) == 0 {
+			log.Warn("no CSRF auth key configured, using an ephemeral one, generate one with keygen and set BATTLESHIP_CSRFAUTHKEY or use a key file")
+			c.CSRFAuthKey = mustGenerateKey("CSRF auth key")
+		}
+	}
+	if command == "simulate" && len(c.BotToken) == 0 {
+		log.Fatal("the bot needs an api token, set BATTLESHIP_BOT_TOKEN")
+	}
+	return c, args
+}
+
+func mustGenerateKey(name string) []byte {
+	key, err := GenerateRandomKey(32)
+	if err != nil {
+		panic(fmt.Errorf("failed to generate %s: %s", name, err))
 	}
-	return cmdFlags{host, port, loglevel, server, jwtSigningKey, csrfAuthKey}
+	return key
 }
@@ -21,6 +21,19 @@ func TestValidateLoglevel(t *testing.T) {
 	}
 }
 
+func TestValidateLogFormat(t *testing.T) {
+	for _, format := range []string{"json", "text"} {
+		if err := validateLogFormat(format); err != nil {
+			t.Errorf("Testing of valid log format %s failed", format)
+		}
+	}
+	for _, format := range []string{"", "JSON", "logfmt"} {
+		if err := validateLogFormat(format); err == nil {
+			t.Errorf("Testing of invalid log format %s failed", format)
+		}
+	}
+}
+
 func TestValidatePort(t *testing.T) {
 	goodPorts := []int{1, 22, 65353, 89}
 	badPorts := []int{-1, 0, 70000}
@@ -54,3 +67,29 @@ func TestValidateHost(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateTLSFlags(t *testing.T) {
+	good := []tlsFlags{
+		{},
+		{CertFile: "cert.pem", KeyFile: "key.pem"},
+		{SelfSigned: true, RedirectPort: 80},
+		{Client: true, Insecure: true},
+	}
+	bad := []tlsFlags{
+		{CertFile: "cert.pem"},
+		{KeyFile: "key.pem"},
+		{SelfSigned: true, CertFile: "cert.pem", KeyFile: "key.pem"},
+		{RedirectPort: 80},
+		{SelfSigned: true, RedirectPort: 70000},
+	}
+	for _, f := range good {
+		if err := validateTLSFlags(f); err != nil {
+			t.Errorf("Testing of valid tls flags %+v failed: %s", f, err)
+		}
+	}
+	for _, f := range bad {
+		if err := validateTLSFlags(f); err == nil {
+			t.Errorf("Testing of invalid tls flags %+v failed", f)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"golang_battleship/board"
+	"golang_battleship/game"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "BATTLESHIP_"
+
+// secretEnvVars map the env vars holding secrets to their field, secrets
+// have no flags so they don't show up in the process list.
+var secretEnvVars = map[string]func(c *cmdFlags) *Secret{
+	"BATTLESHIP_JWTSIGNINGKEY": func(c *cmdFlags) *Secret { return &c.JwtSigningKey },
+	"BATTLESHIP_CSRFAUTHKEY":   func(c *cmdFlags) *Secret { return &c.CSRFAuthKey },
+	"BATTLESHIP_BOT_TOKEN":     func(c *cmdFlags) *Secret { return &c.BotToken },
+}
+
+// Secret is a key or token, it's redacted when the configuration is printed.
+type Secret []byte
+
+func (s Secret) MarshalYAML() (interface{}, error) {
+	if len(s) == 0 {
+		return "", nil
+	}
+	return "<redacted>", nil
+}
+
+func (s *Secret) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: secret has to be a string", value.Line)
+	}
+	*s = Secret(value.Value)
+	return nil
+}
+
+// fleetValue is a flag of comma separated class=count pairs.
+type fleetValue struct {
+	fleet *map[string]int
+}
+
+func (f fleetValue) String() string {
+	if f.fleet == nil {
+		return ""
+	}
+	entries := []string{}
+	for class, count := range *f.fleet {
+		entries = append(entries, fmt.Sprintf("%s=%d", class, count))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+func (f fleetValue) Set(s string) error {
+	fleet := map[string]int{}
+	for _, entry := range strings.Split(s, ",") {
+		if len(strings.TrimSpace(entry)) == 0 {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("fleet entry %s isn't of the form class=count", entry)
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return fmt.Errorf("bad count in fleet entry %s", entry)
+		}
+		fleet[strings.TrimSpace(parts[0])] = count
+	}
+	*f.fleet = fleet
+	return nil
+}
+
+// listValue is a flag of comma separated strings.
+type listValue struct {
+	list *[]string
+}
+
+func (l listValue) String() string {
+	if l.list == nil {
+		return ""
+	}
+	return strings.Join(*l.list, ",")
+}
+
+func (l listValue) Set(s string) error {
+	list := []string{}
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); len(entry) > 0 {
+			list = append(list, entry)
+		}
+	}
+	*l.list = list
+	return nil
+}
+
+func defaultConfig(command string) cmdFlags {
+	return cmdFlags{
+		Command:         command,
+		Host:            "0.0.0.0",
+		Port:            80,
+		LogFormat:       "json",
+		JWTLifetime:     time.Hour,
+		InviteLifetime:  24 * time.Hour,
+		ShutdownTimeout: 15 * time.Second,
+		KeyGracePeriod:  12 * time.Hour,
+		Game: gameFlags{
+			BoardSizeX:            12,
+			BoardSizeY:            12,
+			MaxShips:              5,
+			MaxParticipants:       2,
+			Fleet:                 map[string]int{},
+			DisconnectGracePeriod: time.Minute,
+		},
+		Chat:           chatFlags{History: 100, RateLimit: 5, RateWindow: 10 * time.Second, ProfanityWords: []string{}},
+		PasswordPolicy: passwordPolicyFlags{MinLength: 8},
+		LoginLockout:   loginLockoutFlags{Threshold: 10, Duration: 15 * time.Minute},
+		BotArena:       botArenaFlags{Deadline: 5 * time.Second, MaxIllegalMoves: 3},
+	}
+}
+
+// envName is the env var overriding the flag with name.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfig layers the defaults, the config file, the env vars and the flags
+// in args, each overriding the former, and validates the result. The
+// arguments following the flags are returned for admin.
+func loadConfig(command string, args []string, lookupEnv func(string) (string, bool)) (cmdFlags, []string, bool, error) {
+	c := defaultConfig(command)
+	var configFile string
+	var printConfig bool
+	fs := newFlagSet(&c, &configFile, &printConfig)
+	// the first pass only looks for the config file
+	if err := fs.Parse(args); err != nil {
+		return c, nil, false, err
+	}
+	if len(configFile) == 0 {
+		configFile, _ = lookupEnv(envName("config"))
+	}
+
+	c = defaultConfig(command)
+	if len(configFile) > 0 {
+		if err := c.loadFile(configFile); err != nil {
+			return c, nil, false, err
+		}
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		switch f.Name {
+		case "config", "print-config":
+			return
+		}
+		if v, ok := lookupEnv(envName(f.Name)); ok && err == nil {
+			if e := f.Value.Set(v); e != nil {
+				err = fmt.Errorf("bad value %q of %s: %s", v, envName(f.Name), e)
+			}
+		}
+	})
+	if err != nil {
+		return c, nil, false, err
+	}
+	for name, field := range secretEnvVars {
+		if v, ok := lookupEnv(name); ok && len(v) > 0 {
+			*field(&c) = Secret(v)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return c, nil, false, err
+	}
+	if fs.NArg() > 0 && len(commandArgs[command]) == 0 {
+		return c, nil, false, fmt.Errorf("%s takes no arguments, got %v", command, fs.Args())
+	}
+	return c, fs.Args(), printConfig, c.validate()
+}
+
+// loadFile overrides c with the settings in the YAML file at path, unknown
+// keys are rejected to catch typos.
+func (c *cmdFlags) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %s", err)
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse config file %s: %s", path, err)
+	}
+	return nil
+}
+
+func (c cmdFlags) validate() error {
+	if err := validateLoglevel(c.Loglevel); err != nil {
+		return err
+	}
+	if err := validateLogFormat(c.LogFormat); err != nil {
+		return err
+	}
+	// clients may connect to host names, the server binds to an address
+	if c.Command == "serve" {
+		if err := validateHost(c.Host); err != nil {
+			return err
+		}
+	}
+	if err := validatePort(c.Port); err != nil {
+		return err
+	}
+	if c.MetricsPort != 0 {
+		if err := validatePort(c.MetricsPort); err != nil {
+			return fmt.Errorf("metrics-port: %s", err)
+		}
+	}
+	if c.BotArena.Port != 0 {
+		if err := validatePort(c.BotArena.Port); err != nil {
+			return fmt.Errorf("bot-port: %s", err)
+		}
+	}
+	if err := validateTLSFlags(c.TLS); err != nil {
+		return err
+	}
+	durations := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"jwt-lifetime", c.JWTLifetime},
+		{"invite-lifetime", c.InviteLifetime},
+		{"shutdown-timeout", c.ShutdownTimeout},
+		{"login-lockout-duration", c.LoginLockout.Duration},
+		{"bot-deadline", c.BotArena.Deadline},
+		{"chat-rate-window", c.Chat.RateWindow},
+		{"disconnect-grace-period", c.Game.DisconnectGracePeriod},
+	}
+	for _, d := range durations {
+		if d.d <= 0 {
+			return fmt.Errorf("%s has to be positive, got %s", d.name, d.d)
+		}
+	}
+	if c.Game.TurnTimeout < 0 {
+		return fmt.Errorf("turn-timeout can't be negative, got %s", c.Game.TurnTimeout)
+	}
+	if c.KeyGracePeriod < 0 {
+		return fmt.Errorf("key-grace-period can't be negative, got %s", c.KeyGracePeriod)
+	}
+	if len(c.KeyFile) > 0 {
+		if _, err := os.Stat(c.KeyFile); err != nil {
+			return fmt.Errorf("bad key-file: %s", err)
+		}
+	}
+	if c.Chat.History < 0 {
+		return fmt.Errorf("bad chat-history: %d", c.Chat.History)
+	}
+	if c.Chat.RateLimit < 1 {
+		return fmt.Errorf("bad chat-rate-limit: %d", c.Chat.RateLimit)
+	}
+	if c.PasswordPolicy.MinLength < 1 {
+		return fmt.Errorf("bad password-min-length: %d", c.PasswordPolicy.MinLength)
+	}
+	if c.LoginLockout.Threshold < 0 {
+		return fmt.Errorf("bad login-lockout-threshold: %d", c.LoginLockout.Threshold)
+	}
+	if c.BotArena.MaxIllegalMoves < 1 {
+		return fmt.Errorf("bad bot-max-illegal-moves: %d", c.BotArena.MaxIllegalMoves)
+	}
+	if c.Game.MaxParticipants < 2 {
+		return fmt.Errorf("bad max-participants: %d", c.Game.MaxParticipants)
+	}
+	bp := board.BoardParameters{SizeX: c.Game.BoardSizeX, SizeY: c.Game.BoardSizeY, MaxShips: c.Game.MaxShips, Fleet: c.Game.Fleet}
+	if err := game.ValidateBoardParameters(bp); err != nil {
+		return err
+	}
+	if len(c.CSRFAuthKey) > 0 && len(c.CSRFAuthKey) != 32 {
+		return fmt.Errorf("the CSRF auth key has to be 32 bytes long, got %d", len(c.CSRFAuthKey))
+	}
+	return nil
+}
+
+// YAML renders c in the config file format with the secrets redacted.
+func (c cmdFlags) YAML() (string, error) {
+	out, err := yaml.Marshal(c)
+	return string(out), err
+}
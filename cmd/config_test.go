@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "battleship.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+port: 8080
+loglevel: 2
+jwt_lifetime: 2h
+state_file: /var/lib/battleship/state.json
+game:
+  board_size_x: 16
+  turn_timeout: 90s
+  fleet:
+    Carrier: 1
+    Submarine: 4
+bot_arena:
+  deadline: 3s
+chat:
+  profanity_words: [darn, heck]
+`)
+	c, _, _, err := loadConfig("serve", []string{"-config", path, "-loglevel", "3"}, env(map[string]string{
+		"BATTLESHIP_LOGLEVEL":        "1",
+		"BATTLESHIP_JWT_LIFETIME":    "30m",
+		"BATTLESHIP_BOT_DEADLINE":    "4s",
+		"BATTLESHIP_CHAT_RATE_LIMIT": "3",
+		"BATTLESHIP_JWTSIGNINGKEY":   "abcdefg",
+	}))
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	if c.Port != 8080 || c.Game.BoardSizeX != 16 || c.Game.Fleet["Submarine"] != 4 || c.Game.TurnTimeout != 90*time.Second || c.StateFile != "/var/lib/battleship/state.json" {
+		t.Errorf("file settings not applied, got %+v", c)
+	}
+	if c.JWTLifetime != 30*time.Minute || c.BotArena.Deadline != 4*time.Second {
+		t.Errorf("env doesn't override the file, got %s and %s", c.JWTLifetime, c.BotArena.Deadline)
+	}
+	if len(c.Chat.ProfanityWords) != 2 || c.Chat.RateLimit != 3 {
+		t.Errorf("chat settings not applied, got %+v", c.Chat)
+	}
+	if c.Loglevel != 3 {
+		t.Errorf("flag doesn't override env and file, got loglevel %d", c.Loglevel)
+	}
+	if c.Game.BoardSizeY != 12 || c.Game.DisconnectGracePeriod != time.Minute || c.ShutdownTimeout != 15*time.Second {
+		t.Errorf("defaults not kept, got %+v", c)
+	}
+	if string(c.JwtSigningKey) != "abcdefg" {
+		t.Errorf("jwt signing key not read from env")
+	}
+
+	c, _, _, err = loadConfig("serve", []string{"-fleet", "Carrier=2,Frigate=3", "-profanity-words", "gosh, "}, env(map[string]string{"BATTLESHIP_CONFIG": path}))
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	if c.Port != 8080 || len(c.Game.Fleet) != 2 || c.Game.Fleet["Frigate"] != 3 {
+		t.Errorf("expected file from BATTLESHIP_CONFIG and fleet from flag, got %+v", c)
+	}
+	if len(c.Chat.ProfanityWords) != 1 || c.Chat.ProfanityWords[0] != "gosh" {
+		t.Errorf("expected profanity words from flag, got %v", c.Chat.ProfanityWords)
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	bad := []struct {
+		command string
+		args    []string
+		file    string
+		env     map[string]string
+	}{
+		{command: "serve", args: []string{"-host", "localhost"}},
+		{command: "play", args: []string{"unexpected"}},
+		{args: []string{"-port", "0"}},
+		{args: []string{"-port", "65536"}},
+		{args: []string{"-log-format", "xml"}},
+		{args: []string{"-fleet", "Battleship=1"}},
+		{args: []string{"-fleet", "Carrier=1", "-max-ships", "2"}},
+		{args: []string{"-board-size-x", "5"}},
+		{args: []string{"-jwt-lifetime", "0s"}},
+		{args: []string{"-key-grace-period", "-1h"}},
+		{args: []string{"-key-file", "/nonexistent/keys.json"}},
+		{args: []string{"-chat-rate-limit", "0"}},
+		{args: []string{"-chat-history", "-1"}},
+		{args: []string{"-turn-timeout", "-1s"}},
+		{args: []string{"-disconnect-grace-period", "0s"}},
+		{env: map[string]string{"BATTLESHIP_PORT": "eighty"}},
+		{env: map[string]string{"BATTLESHIP_CSRFAUTHKEY": "tooshort"}},
+		{file: "prot: 80\n"},
+		{file: "tls:\n  cert_file: cert.pem\n"},
+	}
+	for _, b := range bad {
+		args := b.args
+		if len(b.file) > 0 {
+			args = append(args, "-config", writeConfig(t, b.file))
+		}
+		command := b.command
+		if len(command) == 0 {
+			command = "serve"
+		}
+		if _, _, _, err := loadConfig(command, args, env(b.env)); err == nil {
+			t.Errorf("invalid config %+v was accepted", b)
+		}
+	}
+	if _, _, _, err := loadConfig("serve", []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, env(nil)); err == nil {
+		t.Errorf("missing config file was accepted")
+	}
+	if _, _, _, err := loadConfig("serve", []string{"-config", writeConfig(t, "")}, env(nil)); err != nil {
+		t.Errorf("empty config file was rejected: %s", err)
+	}
+	if _, _, _, err := loadConfig("serve", []string{"-port", "65535", "-metrics-port", "65400"}, env(nil)); err != nil {
+		t.Errorf("valid ports were rejected: %s", err)
+	}
+	if _, _, _, err := loadConfig("play", []string{"-host", "battleship.example.com"}, env(nil)); err != nil {
+		t.Errorf("host name was rejected for play: %s", err)
+	}
+	_, args, _, err := loadConfig("admin", []string{"-state-file", "state.json", "players", "list"}, env(nil))
+	if err != nil || len(args) != 2 || args[0] != "players" {
+		t.Errorf("expected admin arguments, got %v, %v", args, err)
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	c, _, printConfig, err := loadConfig("serve", []string{"-print-config", "-fleet", "Submarine=5"}, env(map[string]string{
+		"BATTLESHIP_JWTSIGNINGKEY": "verysecretjwtkey",
+		"BATTLESHIP_CSRFAUTHKEY":   "01234567890123456789012345678901",
+	}))
+	if err != nil || !printConfig {
+		t.Fatalf("expected print-config, got %t, %v", printConfig, err)
+	}
+	out, err := c.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "verysecretjwtkey") || strings.Contains(out, "0123456789") {
+		t.Errorf("secrets not redacted:\n%s", out)
+	}
+	if !strings.Contains(out, "jwt_signing_key: <redacted>") || !strings.Contains(out, "Submarine: 5") || !strings.Contains(out, "jwt_lifetime: 1h0m0s") {
+		t.Errorf("unexpected config output:\n%s", out)
+	}
+
+	// the printed config can be loaded again
+	reloaded, _, _, err := loadConfig("serve", []string{"-config", writeConfig(t, strings.ReplaceAll(out, "<redacted>", ""))}, env(nil))
+	if err != nil || reloaded.Game.Fleet["Submarine"] != 5 || reloaded.JWTLifetime != time.Hour {
+		t.Errorf("printed config doesn't load, got %+v, %v", reloaded, err)
+	}
+}
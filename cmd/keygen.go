@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// Keygen writes fresh BATTLESHIP_JWTSIGNINGKEY and BATTLESHIP_CSRFAUTHKEY
+// values to w in env file format. The keys are base64 encoded random bytes,
+// the CSRF key has the 32 characters gorilla/csrf requires.
+func Keygen(w io.Writer) error {
+	keys := []struct {
+		env  string
+		size int
+	}{
+		{"BATTLESHIP_JWTSIGNINGKEY", 48},
+		{"BATTLESHIP_CSRFAUTHKEY", 24},
+	}
+	for _, k := range keys {
+		b, err := GenerateRandomKey(k.size)
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %s", k.env, err)
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", k.env, base64.RawURLEncoding.EncodeToString(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestKeygen(t *testing.T) {
+	var out bytes.Buffer
+	if err := Keygen(&out); err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		keys[parts[0]] = parts[1]
+	}
+	if len(keys["BATTLESHIP_CSRFAUTHKEY"]) != 32 {
+		t.Errorf("CSRF auth key has to be 32 bytes, got %q", keys["BATTLESHIP_CSRFAUTHKEY"])
+	}
+	if jwtKey, err := base64.RawURLEncoding.DecodeString(keys["BATTLESHIP_JWTSIGNINGKEY"]); err != nil || len(jwtKey) != 48 {
+		t.Errorf("bad JWT signing key %q", keys["BATTLESHIP_JWTSIGNINGKEY"])
+	}
+}
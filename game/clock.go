@@ -0,0 +1,242 @@
+package game
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TurnTimeout limits the time of a turn, the turn passes on once it runs
+// out. Zero disables the turn clock.
+var TurnTimeout time.Duration
+
+// DisconnectGracePeriod is the time a participant whose connection dropped
+// has to reconnect before they forfeit. The turn clock is paused meanwhile.
+var DisconnectGracePeriod = time.Minute
+
+// halt keeps the clocks of all games stopped once StopClocks was called,
+// so no timer acts on a game after the server shut down.
+var halt struct {
+	sync.Mutex
+	stopped bool
+}
+
+// clock runs the turn clock and the grace periods of disconnected
+// participants. It is referenced by pointer, so copies of a game share it.
+type clock struct {
+	mu        sync.Mutex
+	turn      *time.Timer
+	deadline  time.Time
+	remaining time.Duration
+	// generation invalidates turn timers which fired while being stopped
+	generation int
+	graces     map[string]grace
+	graceSeq   int
+}
+
+type grace struct {
+	timer *time.Timer
+	id    int
+}
+
+// StopClocks stops the turn clocks and grace periods of all games and keeps
+// them from starting again until ResumeClocks is called.
+func StopClocks() {
+	halt.Lock()
+	halt.stopped = true
+	halt.Unlock()
+	for _, g := range All() {
+		g.Mutex().Lock()
+		c := g.clock()
+		c.mu.Lock()
+		c.pauseTurn()
+		for name, grace := range c.graces {
+			grace.timer.Stop()
+			delete(c.graces, name)
+		}
+		c.mu.Unlock()
+		g.Mutex().Unlock()
+	}
+}
+
+// ResumeClocks lets the clocks start again after StopClocks. The turns
+// paused meanwhile stay paused until the next turn starts.
+func ResumeClocks() {
+	halt.Lock()
+	defer halt.Unlock()
+	halt.stopped = false
+}
+
+func clocksStopped() bool {
+	halt.Lock()
+	defer halt.Unlock()
+	return halt.stopped
+}
+
+func (g *Game) clock() *clock {
+	lazyInit.Lock()
+	defer lazyInit.Unlock()
+	if g.turnClock == nil {
+		g.turnClock = &clock{graces: map[string]grace{}}
+	}
+	return g.turnClock
+}
+
+// startTurnClock starts the turn of the active player, the deadline is
+// returned unless the clock is disabled or paused.
+func (g *Game) startTurnClock() *time.Time {
+	if TurnTimeout <= 0 {
+		return nil
+	}
+	c := g.clock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopTurn()
+	c.remaining = TurnTimeout
+	return g.resumeTurn(c)
+}
+
+// resumeTurn runs the turn clock for the remaining time of the turn, unless
+// a participant is disconnected. c.mu has to be held.
+func (g *Game) resumeTurn(c *clock) *time.Time {
+	if g.State != StateRunning || TurnTimeout <= 0 || c.turn != nil || c.remaining <= 0 || len(c.graces) > 0 || clocksStopped() {
+		return nil
+	}
+	generation, active := c.generation, g.ActivePlayer
+	c.deadline = time.Now().Add(c.remaining)
+	c.turn = time.AfterFunc(c.remaining, func() { g.turnTimedOut(generation, active) })
+	deadline := c.deadline
+	return &deadline
+}
+
+// pauseTurn stops the turn clock, keeping the remaining time of the turn.
+// c.mu has to be held.
+func (c *clock) pauseTurn() {
+	if c.turn == nil {
+		return
+	}
+	c.remaining = time.Until(c.deadline)
+	c.stopTurn()
+}
+
+func (c *clock) stopTurn() {
+	if c.turn != nil {
+		c.turn.Stop()
+		c.turn = nil
+	}
+	c.generation += 1
+}
+
+// stopClock stops the turn clock and all grace periods of a game which is over.
+func (g *Game) stopClock() {
+	c := g.clock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopTurn()
+	c.remaining = 0
+	for name, grace := range c.graces {
+		grace.timer.Stop()
+		delete(c.graces, name)
+	}
+}
+
+// turnTimedOut passes the turn of active on, unless the turn has passed
+// meanwhile. It runs under the game lock like the handlers acting on g.
+func (g *Game) turnTimedOut(generation int, active string) {
+	g.Mutex().Lock()
+	defer g.Mutex().Unlock()
+	c := g.clock()
+	c.mu.Lock()
+	if generation != c.generation {
+		c.mu.Unlock()
+		return
+	}
+	c.turn = nil
+	c.remaining = 0
+	c.mu.Unlock()
+	if g.State != StateRunning || g.ActivePlayer != active {
+		return
+	}
+	g.record(Event{Type: EventTurnTimeout, Player: active})
+	g.passTurn(active)
+}
+
+// Disconnect starts the grace period of participant playername, whose
+// connection dropped. The turn clock is paused until they reconnect, if
+// they don't within DisconnectGracePeriod they forfeit.
+func (g *Game) Disconnect(playername string) error {
+	if g.State != StateDeployingShips && g.State != StateRunning {
+		return fmt.Errorf("game with id %s is neither in deployment nor running", g.ID)
+	}
+	p, err := g.participant(playername)
+	if err != nil {
+		return err
+	}
+	if p.forfeited || clocksStopped() {
+		return nil
+	}
+	c := g.clock()
+	c.mu.Lock()
+	if _, ok := c.graces[playername]; ok {
+		c.mu.Unlock()
+		return nil
+	}
+	c.graceSeq += 1
+	id := c.graceSeq
+	c.graces[playername] = grace{time.AfterFunc(DisconnectGracePeriod, func() { g.graceExpired(playername, id) }), id}
+	c.pauseTurn()
+	c.mu.Unlock()
+	deadline := time.Now().Add(DisconnectGracePeriod)
+	g.record(Event{Type: EventDisconnected, Player: playername, Deadline: &deadline})
+	return nil
+}
+
+// Reconnect ends the grace period of playername, the turn clock continues
+// once no participant is disconnected anymore.
+func (g *Game) Reconnect(playername string) {
+	c := g.clock()
+	c.mu.Lock()
+	grace, ok := c.graces[playername]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	grace.timer.Stop()
+	delete(c.graces, playername)
+	deadline := g.resumeTurn(c)
+	c.mu.Unlock()
+	g.record(Event{Type: EventReconnected, Player: playername, Deadline: deadline})
+}
+
+// IsDisconnected reports whether playername is within their grace period.
+func (g *Game) IsDisconnected(playername string) bool {
+	c := g.clock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.graces[playername]
+	return ok
+}
+
+// graceExpired lets playername forfeit, unless they reconnected meanwhile.
+// It runs under the game lock like the handlers acting on g.
+func (g *Game) graceExpired(playername string, id int) {
+	g.Mutex().Lock()
+	defer g.Mutex().Unlock()
+	c := g.clock()
+	c.mu.Lock()
+	if grace, ok := c.graces[playername]; !ok || grace.id != id {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.graces, playername)
+	c.mu.Unlock()
+	if err := g.Forfeit(playername); err != nil {
+		return
+	}
+	c.mu.Lock()
+	deadline := g.resumeTurn(c)
+	c.mu.Unlock()
+	if deadline != nil {
+		g.record(Event{Type: EventTurn, ActivePlayer: g.ActivePlayer, Deadline: deadline})
+	}
+}
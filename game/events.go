@@ -0,0 +1,236 @@
+package game
+
+import (
+	"fmt"
+	"golang_battleship/board"
+	"golang_battleship/chat"
+	"golang_battleship/player"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Event types recorded in the event log of a game.
+const (
+	EventJoined            = "joined"
+	EventLeft              = "left"
+	EventKicked            = "kicked"
+	EventDeploymentStarted = "deployment_started"
+	EventShipDeployed      = "ship_deployed"
+	EventGameRunning       = "game_running"
+	EventShot              = "shot"
+	EventTurn              = "turn"
+	EventTurnTimeout       = "turn_timeout"
+	EventDisconnected      = "disconnected"
+	EventReconnected       = "reconnected"
+	EventForfeited         = "forfeited"
+	EventGameOver          = "game_over"
+	EventChat              = "chat"
+	EventMuted             = "muted"
+	EventUnmuted           = "unmuted"
+)
+
+// Event is an entry of the event log of a game, numbered by Seq in the order
+// of recording. Events never carry ship positions, deployments only name
+// the player.
+type Event struct {
+	Seq          int                `json:"seq"`
+	Type         string             `json:"type"`
+	Time         time.Time          `json:"time"`
+	Player       string             `json:"player,omitempty"`
+	Target       string             `json:"target,omitempty"`
+	Text         string             `json:"text,omitempty"`
+	Results      []board.ShotResult `json:"results,omitempty"`
+	ActivePlayer string             `json:"active_player,omitempty"`
+	Winner       string             `json:"winner,omitempty"`
+	// Deadline is the end of the turn or of the grace period of a
+	// disconnected participant.
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+// ChatHistorySize is the number of chat messages kept per game, older ones
+// are dropped from the event log.
+var ChatHistorySize = 100
+
+// MaxChatLength is the maximum length of a chat message in characters.
+const MaxChatLength = 280
+
+// ChatLimiter limits the chat messages per player across all games.
+var ChatLimiter = chat.NewLimiter(5, 10*time.Second)
+
+// ChatFilter masks profanity in chat messages.
+var ChatFilter = chat.NewFilter(nil)
+
+var eventHooks []func(g *Game, e Event)
+
+// lazyInit guards the lazy creation of event logs, clocks and game locks.
+var lazyInit sync.Mutex
+
+// eventLog is referenced by pointer, so copies of a game share it.
+type eventLog struct {
+	mu     sync.Mutex
+	seq    int
+	events []Event
+	muted  map[string]bool
+}
+
+func (g *Game) eventLog() *eventLog {
+	lazyInit.Lock()
+	defer lazyInit.Unlock()
+	if g.events == nil {
+		g.events = &eventLog{muted: map[string]bool{}}
+	}
+	return g.events
+}
+
+// record appends e to the event log and passes it to the event hooks.
+func (g *Game) record(e Event) Event {
+	l := g.eventLog()
+	l.mu.Lock()
+	l.seq += 1
+	e.Seq = l.seq
+	e.Time = time.Now()
+	l.events = append(l.events, e)
+	if e.Type == EventChat {
+		l.trimChat()
+	}
+	l.mu.Unlock()
+	for _, hook := range eventHooks {
+		hook(g, e)
+	}
+	return e
+}
+
+// trimChat drops the oldest chat messages beyond ChatHistorySize.
+func (l *eventLog) trimChat() {
+	chats := 0
+	for _, e := range l.events {
+		if e.Type == EventChat {
+			chats += 1
+		}
+	}
+	kept := l.events[:0]
+	for _, e := range l.events {
+		if e.Type == EventChat && chats > ChatHistorySize {
+			chats -= 1
+			continue
+		}
+		kept = append(kept, e)
+	}
+	l.events = kept
+}
+
+// Events returns the events recorded after the one with sequence number since.
+func (g *Game) Events(since int) []Event {
+	l := g.eventLog()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := []Event{}
+	for _, e := range l.events {
+		if e.Seq > since {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// RestoreEvents replaces the event log, for games restored from a snapshot.
+func (g *Game) RestoreEvents(events []Event) {
+	l := g.eventLog()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append([]Event{}, events...)
+	l.seq = 0
+	for _, e := range events {
+		if e.Seq > l.seq {
+			l.seq = e.Seq
+		}
+	}
+}
+
+// OnEvent registers a hook which gets called with every event recorded.
+func OnEvent(hook func(g *Game, e Event)) {
+	eventHooks = append(eventHooks, hook)
+}
+
+// CanModerate reports whether p may mute players in the chat of the game,
+// which the host and moderators may.
+func (g Game) CanModerate(p player.Player) bool {
+	return p.Moderator || g.IsHost(p.Name)
+}
+
+// IsMuted reports whether playername has been muted in the chat of the game.
+func (g *Game) IsMuted(playername string) bool {
+	l := g.eventLog()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.muted[playername]
+}
+
+// Say posts text of p to the chat of the game. Participants and moderators
+// may chat until the game is over, unless they have been muted or exceed
+// the rate limit. Profanity is masked.
+func (g *Game) Say(p player.Player, text string) (Event, error) {
+	if g.State == StateFinished || g.State == StateAborted {
+		return Event{}, fmt.Errorf("game with id %s is over", g.ID)
+	}
+	if !g.IsParticipant(p.Name) && !p.Moderator {
+		return Event{}, fmt.Errorf("player %s is no participant of game with id %s", p.Name, g.ID)
+	}
+	if g.IsMuted(p.Name) {
+		return Event{}, fmt.Errorf("player %s has been muted in game with id %s", p.Name, g.ID)
+	}
+	text = strings.TrimSpace(text)
+	if len(text) == 0 {
+		return Event{}, fmt.Errorf("empty chat message")
+	}
+	if len([]rune(text)) > MaxChatLength {
+		return Event{}, fmt.Errorf("chat message exceeds %d characters", MaxChatLength)
+	}
+	for _, r := range text {
+		if !unicode.IsPrint(r) {
+			return Event{}, fmt.Errorf("chat message contains unprintable characters")
+		}
+	}
+	if !ChatLimiter.Allow(p.Name) {
+		return Event{}, fmt.Errorf("too many chat messages from %s, slow down", p.Name)
+	}
+	return g.record(Event{Type: EventChat, Player: p.Name, Text: ChatFilter.Clean(text)}), nil
+}
+
+// Mute keeps playername from chatting in the game, only moderators may mute.
+func (g *Game) Mute(moderator player.Player, playername string) error {
+	return g.setMuted(moderator, playername, true)
+}
+
+// Unmute lets a muted playername chat again.
+func (g *Game) Unmute(moderator player.Player, playername string) error {
+	return g.setMuted(moderator, playername, false)
+}
+
+func (g *Game) setMuted(moderator player.Player, playername string, muted bool) error {
+	if !g.CanModerate(moderator) {
+		return fmt.Errorf("player %s may not moderate the chat of game with id %s", moderator.Name, g.ID)
+	}
+	if moderator.Name == playername {
+		return fmt.Errorf("player %s cannot mute themselves", playername)
+	}
+	if !g.IsParticipant(playername) {
+		return fmt.Errorf("no participant with name %s found for game with id %s", playername, g.ID)
+	}
+	l := g.eventLog()
+	l.mu.Lock()
+	if l.muted[playername] == muted {
+		l.mu.Unlock()
+		return nil
+	}
+	l.muted[playername] = muted
+	l.mu.Unlock()
+	eventType := EventMuted
+	if !muted {
+		eventType = EventUnmuted
+	}
+	g.record(Event{Type: eventType, Player: playername})
+	return nil
+}
@@ -1,10 +1,15 @@
 package game
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"golang_battleship/board"
 	"golang_battleship/player"
+	"golang_battleship/ship"
+	"golang_battleship/weapon"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,11 +26,27 @@ type Game struct {
 	CreationDate    time.Time             `json:"creation_date"`
 	MaxParticipants int                   `json:"max_participants"`
 	BoardParameters board.BoardParameters `json:"board_parameters"`
+	Creator         string                `json:"creator"`
+	Host            string                `json:"host"`
+	Locked          bool                  `json:"locked"`
+	Private         bool                  `json:"private"`
+	PasswordHash    string                `json:"-"`
+	Winner          string                `json:"winner,omitempty"`
+	SeriesID        *uuid.UUID            `json:"series_id,omitempty"`
+	RematchID       *uuid.UUID            `json:"rematch_id,omitempty"`
+	ActivePlayer    string                `json:"active_player,omitempty"`
+	Turn            int                   `json:"turn"`
+	invites         map[string]time.Time
+	events          *eventLog
+	turnClock       *clock
+	mu              *sync.Mutex
 }
 
 type Participant struct {
-	Player player.Player `json:"player"`
-	board  board.Board   `json:"-"`
+	Player    player.Player `json:"player"`
+	board     board.Board   `json:"-"`
+	turns     int
+	forfeited bool
 }
 
 const (
@@ -36,18 +57,41 @@ const (
 	StateAborted
 )
 
-const (
+// The defaults for new games, the server overrides them from its configuration.
+var (
 	DefaultBoardsizeX      = 12
 	DefaultBoardsizeY      = 12
 	DefaultMaxships        = 5
 	DefaultMaxParticipants = 2
-	DefaultDescription     = "Join Me"
+	// DefaultFleet limits the ships per class, empty allows any class.
+	DefaultFleet = map[string]int{}
 )
 
+const DefaultDescription = "Join Me"
+
+const inviteCodeSize = 8
+
 const ValidGameIDRegex = "[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}"
 
 var AllGames []*Game
 
+// registry guards the creation and deletion of games against the lookups
+// from other goroutines, such as the metrics scrapes.
+var registry sync.RWMutex
+
+var finishHooks []func(g *Game)
+
+var abortHooks []func(g *Game)
+
+var shotHooks []func(g *Game, shooter string, results []board.ShotResult)
+
+// RuleVariants are the variants of the rules supported: classic games of two
+// players, free for all games of more participants and best of n series.
+var RuleVariants = []string{"classic", "free_for_all", "best_of_series"}
+
+// InviteCodeLifetime is how long an invite code created by NewInviteCode stays valid.
+var InviteCodeLifetime = 24 * time.Hour
+
 var GameStateMap = map[string]GameState{
 	"open":            0,
 	"deploying ships": 1,
@@ -56,15 +100,39 @@ var GameStateMap = map[string]GameState{
 	"aborted":         4,
 }
 
+// Mutex serializes the changes to g, the API handlers, the bot arena and
+// the turn clock hold it while acting on the game. The methods of Game
+// don't lock by themselves. It is referenced by pointer, so copies of a
+// game share it.
+func (g *Game) Mutex() *sync.Mutex {
+	lazyInit.Lock()
+	defer lazyInit.Unlock()
+	if g.mu == nil {
+		g.mu = &sync.Mutex{}
+	}
+	return g.mu
+}
+
 func (p Participant) String() string {
 	return p.Player.Name
 }
 
+// defeated reports whether the participant forfeited or lost all deployed ships.
+func (p Participant) defeated() bool {
+	return p.forfeited || p.board.AllShipsDestroyed()
+}
+
 func (p Participant) MarshalJSON() ([]byte, error) {
 	return json.Marshal(p.String())
 }
 
+func (p *Participant) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &p.Player.Name)
+}
+
 func GetByUUID(uuid string) (*Game, error) {
+	registry.RLock()
+	defer registry.RUnlock()
 	for _, g := range AllGames {
 		if g.ID.String() == uuid {
 			return g, nil
@@ -73,7 +141,10 @@ func GetByUUID(uuid string) (*Game, error) {
 	return nil, fmt.Errorf("no game found for uuid %s", uuid)
 }
 
+// DeleteByUUID removes the game from the registry. A game deleted before it
+// was over is aborted, the caller has to hold the lock of the game.
 func DeleteByUUID(uuid string) error {
+	registry.Lock()
 	index := -1
 	for i, g := range AllGames {
 		if g.ID.String() == uuid {
@@ -81,12 +152,29 @@ func DeleteByUUID(uuid string) error {
 		}
 	}
 	if index == -1 {
+		registry.Unlock()
 		return fmt.Errorf("no game found for uuid %s", uuid)
 	}
+	g := AllGames[index]
 	AllGames = append(AllGames[:index], AllGames[index+1:]...)
+	registry.Unlock()
+	g.Abort()
 	return nil
 }
 
+// Abort ends a game which is not over yet without a winner.
+func (g *Game) Abort() {
+	if g.State == StateFinished || g.State == StateAborted {
+		return
+	}
+	g.State = StateAborted
+	g.ActivePlayer = ""
+	g.stopClock()
+	for _, hook := range abortHooks {
+		hook(g)
+	}
+}
+
 func (g Game) String() string {
 	json_map := map[string]interface{}{
 		"id":               g.ID.String(),
@@ -96,6 +184,11 @@ func (g Game) String() string {
 		"description":      g.Description,
 		"creation_date":    g.CreationDate,
 		"board_parameters": g.BoardParameters,
+		"creator":          g.Creator,
+		"host":             g.Host,
+		"locked":           g.Locked,
+		"winner":           g.Winner,
+		"series_id":        g.SeriesID,
 	}
 	s, _ := json.Marshal(json_map)
 	return string(s[:])
@@ -109,7 +202,55 @@ func (g Game) ListParticipants() []string {
 	return retval
 }
 
+func (g Game) IsParticipant(playername string) bool {
+	for _, p := range g.Participants {
+		if p.Player.Name == playername {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsAuthorization reports whether joining requires an invite code or password.
+func (g Game) NeedsAuthorization() bool {
+	return g.Private || len(g.PasswordHash) > 0
+}
+
+func (g *Game) NewInviteCode() (string, time.Time, error) {
+	b := make([]byte, inviteCodeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate invite code for game with id %s: %s", g.ID, err)
+	}
+	if g.invites == nil {
+		g.invites = make(map[string]time.Time)
+	}
+	code := hex.EncodeToString(b)
+	expiry := time.Now().Add(InviteCodeLifetime)
+	g.invites[code] = expiry
+	return code, expiry, nil
+}
+
+// ValidInviteCode checks code against the unexpired invite codes of the game,
+// dropping the expired ones along the way.
+func (g *Game) ValidInviteCode(code string) bool {
+	now := time.Now()
+	for c, expiry := range g.invites {
+		if expiry.Before(now) {
+			delete(g.invites, c)
+		}
+	}
+	_, ok := g.invites[code]
+	return ok
+}
+
+func (g Game) IsHost(playername string) bool {
+	return len(g.Host) > 0 && g.Host == playername
+}
+
 func (g *Game) AddParticipant(player player.Player) error {
+	if g.Locked {
+		return fmt.Errorf("game with id %s is locked by its host", g.ID)
+	}
 	if g.MaxParticipants <= len(g.Participants) {
 		return fmt.Errorf("game with id %s has reached max participants (%d/%d)", g.ID, len(g.Participants), g.MaxParticipants)
 	}
@@ -119,9 +260,10 @@ func (g *Game) AddParticipant(player player.Player) error {
 		}
 	}
 	g.Participants = append(g.Participants, Participant{
-		player,
-		board.NewBoard(g.BoardParameters),
+		Player: player,
+		board:  board.NewBoard(g.BoardParameters),
 	})
+	g.record(Event{Type: EventJoined, Player: player.Name})
 	return nil
 }
 
@@ -129,18 +271,495 @@ func (g *Game) RemoveParticipant(player player.Player) error {
 	for i, p := range g.Participants {
 		if p.Player.Name == player.Name {
 			g.Participants = append(g.Participants[:i], g.Participants[i+1:]...)
+			if g.IsHost(player.Name) {
+				g.passHosting()
+			}
+			g.record(Event{Type: EventLeft, Player: player.Name})
 			return nil
 		}
 	}
 	return fmt.Errorf("no participant with name %s found for game with id %s", player.Name, g.ID)
 }
 
-func NewGame(boardsizeX, boardsizeY, maxships int, description string, maxparticipants int, playernames ...string) (*Game, error) {
-	if boardsizeX < 10 || boardsizeY < 10 {
-		return &Game{}, fmt.Errorf("boardsize (%d * %d) too small", boardsizeX, boardsizeY)
+// passHosting hands the host role to the longest standing participant,
+// or leaves the game without host if nobody is left.
+func (g *Game) passHosting() {
+	if len(g.Participants) == 0 {
+		g.Host = ""
+		return
+	}
+	g.Host = g.Participants[0].Player.Name
+	log.Info(fmt.Sprintf("Passed hosting of game %s to %s", g.ID, g.Host))
+}
+
+func (g *Game) Kick(playername string) error {
+	if g.State != StateOpen {
+		return fmt.Errorf("participants of game with id %s cannot be kicked after the game has started", g.ID)
+	}
+	if g.IsHost(playername) {
+		return fmt.Errorf("host %s cannot kick themselves from game with id %s", playername, g.ID)
+	}
+	for i, p := range g.Participants {
+		if p.Player.Name == playername {
+			g.Participants = append(g.Participants[:i], g.Participants[i+1:]...)
+			g.record(Event{Type: EventKicked, Player: playername})
+			return nil
+		}
+	}
+	return fmt.Errorf("no participant with name %s found for game with id %s", playername, g.ID)
+}
+
+func (g *Game) SetBoardParameters(bp board.BoardParameters) error {
+	if g.State != StateOpen {
+		return fmt.Errorf("board parameters of game with id %s cannot be changed after the game has started", g.ID)
+	}
+	if err := ValidateBoardParameters(bp); err != nil {
+		return err
+	}
+	g.BoardParameters = bp
+	for i := range g.Participants {
+		g.Participants[i].board = board.NewBoard(bp)
+	}
+	return nil
+}
+
+func (g *Game) StartDeployment() error {
+	if g.State != StateOpen {
+		return fmt.Errorf("game with id %s is not open", g.ID)
+	}
+	if len(g.Participants) < 2 {
+		return fmt.Errorf("game with id %s needs at least 2 participants to start (%d/%d)", g.ID, len(g.Participants), g.MaxParticipants)
+	}
+	g.State = StateDeployingShips
+	g.Locked = true
+	g.record(Event{Type: EventDeploymentStarted})
+	return nil
+}
+
+// Finish ends the game with the given winner and scores all participants,
+// unless the game belongs to a series which only credits its overall winner.
+func (g *Game) Finish(winner string) error {
+	if g.State == StateFinished || g.State == StateAborted {
+		return fmt.Errorf("game with id %s is already over", g.ID)
+	}
+	if !g.IsParticipant(winner) {
+		return fmt.Errorf("winner %s is no participant of game with id %s", winner, g.ID)
+	}
+	g.State = StateFinished
+	g.Winner = winner
+	g.ActivePlayer = ""
+	g.stopClock()
+	g.record(Event{Type: EventGameOver, Winner: winner})
+	for _, participant := range g.Participants {
+		p, ok := player.AllPlayersMap[participant.Player.Name]
+		if !ok {
+			continue
+		}
+		opponents := []string{}
+		for _, name := range g.ListParticipants() {
+			if name != participant.Player.Name {
+				opponents = append(opponents, name)
+			}
+		}
+		p.RecordMatch(player.MatchRecord{
+			GameID:    g.ID.String(),
+			Opponents: opponents,
+			Winner:    winner,
+			Won:       participant.Player.Name == winner,
+			Turns:     participant.turns,
+			Date:      time.Now(),
+		})
+	}
+	var s *Series
+	if g.SeriesID != nil {
+		s, _ = GetSeriesByUUID(g.SeriesID.String())
+	}
+	if s == nil || !s.CreditWinnerOnly {
+		for _, name := range g.ListParticipants() {
+			p, ok := player.AllPlayersMap[name]
+			if !ok {
+				continue
+			}
+			if name == winner {
+				p.ScoreWin()
+			} else {
+				p.ScoreLoss()
+			}
+		}
+	}
+	if s != nil {
+		s.recordWin(winner, g)
+	}
+	for _, hook := range finishHooks {
+		hook(g)
+	}
+	return nil
+}
+
+func (g *Game) participant(playername string) (*Participant, error) {
+	for i := range g.Participants {
+		if g.Participants[i].Player.Name == playername {
+			return &g.Participants[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no participant with name %s found for game with id %s", playername, g.ID)
+}
+
+// ShipsDeployed returns how many ships playername has deployed so far.
+func (g *Game) ShipsDeployed(playername string) (int, error) {
+	p, err := g.participant(playername)
+	if err != nil {
+		return 0, err
+	}
+	return p.board.ShipCount(), nil
+}
+
+// ShipsSunk returns how many ships of playername have been destroyed.
+func (g *Game) ShipsSunk(playername string) (int, error) {
+	p, err := g.participant(playername)
+	if err != nil {
+		return 0, err
+	}
+	return p.board.SunkCount(), nil
+}
+
+// HasForfeited reports whether playername gave up the game.
+func (g *Game) HasForfeited(playername string) bool {
+	p, err := g.participant(playername)
+	return err == nil && p.forfeited
+}
+
+// Fleet returns the ships of playername with their positions, which must
+// only ever be shown to playername themselves.
+func (g *Game) Fleet(playername string) ([]ship.Ship, error) {
+	p, err := g.participant(playername)
+	if err != nil {
+		return nil, err
+	}
+	return p.board.Ships(), nil
+}
+
+// Deploy places a ship on the board of the given participant. Once every
+// participant has deployed the maximum amount of ships, the game starts
+// with the first participant taking the first turn.
+func (g *Game) Deploy(playername string, className string, x, y int, orientation string) error {
+	if g.State != StateDeployingShips {
+		return fmt.Errorf("game with id %s is not in deployment", g.ID)
+	}
+	p, err := g.participant(playername)
+	if err != nil {
+		return err
+	}
+	if !ship.ValidClass(className) {
+		return fmt.Errorf("unknown ship class %s", className)
+	}
+	if _, err := ship.OrientationFromString(orientation); err != nil {
+		return err
+	}
+	if err := p.board.DeployShip(*ship.NewShip(className, x, y, orientation)); err != nil {
+		return err
+	}
+	g.record(Event{Type: EventShipDeployed, Player: playername})
+	g.startWhenDeployed()
+	return nil
+}
+
+func (g *Game) startWhenDeployed() {
+	active := ""
+	for _, p := range g.Participants {
+		if p.forfeited {
+			continue
+		}
+		if p.board.ShipCount() < g.BoardParameters.MaxShips {
+			return
+		}
+		if len(active) == 0 {
+			active = p.Player.Name
+		}
+	}
+	g.State = StateRunning
+	g.ActivePlayer = active
+	g.record(Event{Type: EventGameRunning, ActivePlayer: active, Deadline: g.startTurnClock()})
+	log.Info(fmt.Sprintf("All ships deployed, game %s is running", g.ID))
+}
+
+// Fire resolves a shot of shooter at the board of target and passes the
+// turn on to the next participant with ships left. The game finishes once
+// a single participant has ships left.
+func (g *Game) Fire(shooter string, target string, x, y int, weaponName string) ([]board.ShotResult, error) {
+	if g.State != StateRunning {
+		return nil, fmt.Errorf("game with id %s is not running", g.ID)
+	}
+	if shooter != g.ActivePlayer {
+		return nil, fmt.Errorf("it's not %s's turn in game with id %s", shooter, g.ID)
+	}
+	if shooter == target {
+		return nil, fmt.Errorf("player %s cannot fire at their own board", shooter)
+	}
+	s, err := g.participant(shooter)
+	if err != nil {
+		return nil, err
+	}
+	t, err := g.participant(target)
+	if err != nil {
+		return nil, err
+	}
+	if t.defeated() {
+		return nil, fmt.Errorf("%s has already been defeated", target)
+	}
+	if len(weaponName) == 0 {
+		weaponName = weapon.DefaultWeapon
+	}
+	w, err := weapon.GetByName(weaponName)
+	if err != nil {
+		return nil, err
+	}
+	results, err := t.board.ReceiveFire(x, y, w)
+	if err != nil {
+		return nil, err
+	}
+	s.turns += 1
+	g.Turn += 1
+	g.recordShot(shooter, target, w.Name(), results)
+	g.record(Event{Type: EventShot, Player: shooter, Target: target, Results: results})
+	for _, hook := range shotHooks {
+		hook(g, shooter, results)
+	}
+	return results, g.passTurn(shooter)
+}
+
+// passTurn hands the turn to the next undefeated participant after playername,
+// or finishes the game if there is only one of them left.
+func (g *Game) passTurn(playername string) error {
+	alive := []string{}
+	next := ""
+	for i := range g.Participants {
+		p := g.Participants[(g.indexOf(playername)+1+i)%len(g.Participants)]
+		if p.defeated() {
+			continue
+		}
+		if len(next) == 0 {
+			next = p.Player.Name
+		}
+		alive = append(alive, p.Player.Name)
+	}
+	if len(alive) == 1 {
+		return g.Finish(alive[0])
+	}
+	g.ActivePlayer = next
+	g.record(Event{Type: EventTurn, ActivePlayer: next, Deadline: g.startTurnClock()})
+	return nil
+}
+
+// Forfeit gives up the game for playername. Their fleet stays on the board,
+// but they don't get a turn anymore and count as defeated.
+func (g *Game) Forfeit(playername string) error {
+	if g.State != StateDeployingShips && g.State != StateRunning {
+		return fmt.Errorf("game with id %s is neither in deployment nor running", g.ID)
+	}
+	p, err := g.participant(playername)
+	if err != nil {
+		return err
+	}
+	if p.forfeited {
+		return fmt.Errorf("player %s has already forfeited game with id %s", playername, g.ID)
+	}
+	p.forfeited = true
+	g.record(Event{Type: EventForfeited, Player: playername})
+	log.Info(fmt.Sprintf("Player %s forfeited game %s", playername, g.ID))
+	if remaining := g.undefeated(); len(remaining) == 1 {
+		return g.Finish(remaining[0])
+	}
+	if g.State == StateDeployingShips {
+		g.startWhenDeployed()
+		return nil
+	}
+	if g.ActivePlayer == playername {
+		return g.passTurn(playername)
+	}
+	return nil
+}
+
+func (g Game) undefeated() []string {
+	remaining := []string{}
+	for _, p := range g.Participants {
+		if !p.defeated() {
+			remaining = append(remaining, p.Player.Name)
+		}
+	}
+	return remaining
+}
+
+// RemovePlayer withdraws playername from all games, forfeiting the ones already started.
+func RemovePlayer(playername string) {
+	for _, g := range All() {
+		g.Mutex().Lock()
+		if g.IsParticipant(playername) {
+			switch g.State {
+			case StateOpen:
+				g.RemoveParticipant(player.Player{Name: playername})
+			case StateDeployingShips, StateRunning:
+				g.Forfeit(playername)
+			}
+		}
+		g.Mutex().Unlock()
+	}
+}
+
+// All returns a copy of AllGames, which may be ranged over while games are
+// created or deleted.
+func All() []*Game {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]*Game{}, AllGames...)
+}
+
+// CountByState returns the number of games per state.
+func CountByState() map[GameState]int {
+	counts := map[GameState]int{}
+	for _, g := range All() {
+		mu := g.Mutex()
+		mu.Lock()
+		counts[g.State] += 1
+		mu.Unlock()
+	}
+	return counts
+}
+
+func (g Game) indexOf(playername string) int {
+	for i, p := range g.Participants {
+		if p.Player.Name == playername {
+			return i
+		}
 	}
-	if maxships < 1 {
-		return &Game{}, fmt.Errorf("maximum ship capacity (%d) too small", maxships)
+	return -1
+}
+
+func (g Game) recordShot(shooter string, target string, weaponName string, results []board.ShotResult) {
+	hit := false
+	for _, r := range results {
+		hit = hit || r.Hit
+		if p, ok := player.AllPlayersMap[target]; ok && len(r.Sunk) > 0 {
+			p.RecordShipLost(r.Sunk)
+		}
+	}
+	if p, ok := player.AllPlayersMap[shooter]; ok {
+		p.RecordShot(weaponName, hit)
+	}
+}
+
+// OnFinish registers a hook which gets called whenever a game is finished.
+func OnFinish(hook func(g *Game)) {
+	finishHooks = append(finishHooks, hook)
+}
+
+// OnAbort registers a hook which gets called whenever a game is aborted or
+// deleted before it was finished.
+func OnAbort(hook func(g *Game)) {
+	abortHooks = append(abortHooks, hook)
+}
+
+// OnShot registers a hook which gets called after every shot fired.
+func OnShot(hook func(g *Game, shooter string, results []board.ShotResult)) {
+	shotHooks = append(shotHooks, hook)
+}
+
+// Rematch creates a new game with the same settings and players as the
+// finished game g. Further calls return the rematch created first.
+func (g *Game) Rematch(requester string) (*Game, error) {
+	if g.State != StateFinished {
+		return nil, fmt.Errorf("game with id %s is not finished", g.ID)
+	}
+	if !g.IsParticipant(requester) {
+		return nil, fmt.Errorf("player %s is no participant of game with id %s", requester, g.ID)
+	}
+	if g.RematchID != nil {
+		return GetByUUID(g.RematchID.String())
+	}
+	var s *Series
+	if g.SeriesID != nil {
+		s, _ = GetSeriesByUUID(g.SeriesID.String())
+		if s != nil && s.Decided() {
+			return nil, fmt.Errorf("series %s has already been won by %s", s.ID, s.Winner)
+		}
+	}
+	playernames := []string{requester}
+	for _, name := range g.ListParticipants() {
+		if name != requester {
+			playernames = append(playernames, name)
+		}
+	}
+	bp := g.BoardParameters
+	r, err := NewGame(bp.SizeX, bp.SizeY, bp.MaxShips, g.Description, g.MaxParticipants, playernames...)
+	if err != nil {
+		return nil, err
+	}
+	r.Private = g.Private
+	r.PasswordHash = g.PasswordHash
+	if s != nil {
+		s.link(r)
+	}
+	g.RematchID = &r.ID
+	return r, nil
+}
+
+// ValidateFleet checks whether fleet can be deployed on a board with parameters bp.
+func ValidateFleet(bp board.BoardParameters, fleet []player.FleetEntry) error {
+	b := board.NewBoard(bp)
+	for _, f := range fleet {
+		if !ship.ValidClass(f.Class) {
+			return fmt.Errorf("unknown ship class %s", f.Class)
+		}
+		if _, err := ship.OrientationFromString(f.Orientation); err != nil {
+			return err
+		}
+		if err := b.DeployShip(*ship.NewShip(f.Class, f.X, f.Y, f.Orientation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateBoardParameters checks bp against the minimum board size and fleet capacity.
+func ValidateBoardParameters(bp board.BoardParameters) error {
+	if bp.SizeX < 10 || bp.SizeY < 10 {
+		return fmt.Errorf("boardsize (%d * %d) too small", bp.SizeX, bp.SizeY)
+	}
+	if bp.MaxShips < 1 {
+		return fmt.Errorf("maximum ship capacity (%d) too small", bp.MaxShips)
+	}
+	return ValidateFleetComposition(bp.Fleet, bp.MaxShips)
+}
+
+// ValidateFleetComposition checks that fleet only holds known ship classes
+// and allows at least maxships ships, so games with it can be started.
+func ValidateFleetComposition(fleet map[string]int, maxships int) error {
+	if len(fleet) == 0 {
+		return nil
+	}
+	total := 0
+	for class, count := range fleet {
+		if !ship.ValidClass(class) {
+			return fmt.Errorf("unknown ship class %s in fleet", class)
+		}
+		if count < 0 {
+			return fmt.Errorf("negative count (%d) of ship class %s in fleet", count, class)
+		}
+		total += count
+	}
+	if total < maxships {
+		return fmt.Errorf("fleet of %d ships can't fill the maximum ship capacity (%d)", total, maxships)
+	}
+	return nil
+}
+
+// NewGame creates a game hosted by the first of playernames, who is
+// recorded as its creator. It fails unless all of playernames are players
+// who can be added as participants.
+func NewGame(boardsizeX, boardsizeY, maxships int, description string, maxparticipants int, playernames ...string) (*Game, error) {
+	bp := board.BoardParameters{SizeX: boardsizeX, SizeY: boardsizeY, MaxShips: maxships, Fleet: DefaultFleet}
+	if err := ValidateBoardParameters(bp); err != nil {
+		return &Game{}, err
 	}
 	if len(description) == 0 {
 		description = DefaultDescription
@@ -149,16 +768,33 @@ func NewGame(boardsizeX, boardsizeY, maxships int, description string, maxpartic
 		maxparticipants = DefaultMaxParticipants
 	}
 	gameuuid := uuid.New()
-	g := Game{[]Participant{}, gameuuid, StateOpen, description, time.Now(), maxparticipants, board.BoardParameters{
-		SizeX: boardsizeX, SizeY: boardsizeY, MaxShips: maxships},
+	g := Game{
+		Participants:    []Participant{},
+		ID:              gameuuid,
+		State:           StateOpen,
+		Description:     description,
+		CreationDate:    time.Now(),
+		MaxParticipants: maxparticipants,
+		BoardParameters: bp,
 	}
 
 	for _, playername := range playernames {
-		p, _ := player.GetByName(playername)
-		g.AddParticipant(p)
+		p, err := player.GetByName(playername)
+		if err != nil {
+			return &Game{}, err
+		}
+		if err := g.AddParticipant(p); err != nil {
+			return &Game{}, err
+		}
+	}
+	if len(playernames) > 0 {
+		g.Creator = playernames[0]
+		g.Host = playernames[0]
 	}
 
+	registry.Lock()
 	AllGames = append(AllGames, &g)
+	registry.Unlock()
 	log.Info(fmt.Sprintf("Created new game %s with max. participants %d", gameuuid, maxparticipants))
 	return &g, nil
 }
@@ -1,8 +1,13 @@
 package game
 
 import (
+	"golang_battleship/board"
+	"golang_battleship/chat"
 	"golang_battleship/player"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewGame(t *testing.T) {
@@ -14,3 +19,360 @@ func TestNewGame(t *testing.T) {
 	g, _ := NewGame(x, y, maxships, "New Game", 2, p1.Name, p2.Name)
 	t.Error(g.String())
 }
+
+func TestHostHandover(t *testing.T) {
+	p1, _ := player.NewPlayer("Tick", "")
+	p2, _ := player.NewPlayer("Trick", "")
+	p3, _ := player.NewPlayer("Track", "")
+	g, _ := NewGame(12, 12, 5, "Handover", 3, p1.Name, p2.Name, p3.Name)
+	if g.Creator != p1.Name || !g.IsHost(p1.Name) {
+		t.Errorf("expected %s to be creator and host, got creator %s and host %s", p1.Name, g.Creator, g.Host)
+	}
+	if err := g.Kick(p1.Name); err == nil {
+		t.Errorf("host %s was able to kick themselves", p1.Name)
+	}
+	g.RemoveParticipant(*p1)
+	if !g.IsHost(p2.Name) {
+		t.Errorf("expected hosting to pass to %s, got %s", p2.Name, g.Host)
+	}
+	if g.Creator != p1.Name {
+		t.Errorf("creator changed from %s to %s after host left", p1.Name, g.Creator)
+	}
+	if err := g.Kick(p3.Name); err != nil {
+		t.Errorf("failed to kick %s: %s", p3.Name, err)
+	}
+	g.Locked = true
+	if err := g.AddParticipant(*p3); err == nil {
+		t.Errorf("player %s joined locked game", p3.Name)
+	}
+	if err := g.SetBoardParameters(board.BoardParameters{SizeX: 5, SizeY: 5, MaxShips: 1}); err == nil {
+		t.Errorf("board parameters below minimum size were accepted")
+	}
+	g.RemoveParticipant(*p2)
+	if len(g.Host) > 0 {
+		t.Errorf("expected empty game to have no host, got %s", g.Host)
+	}
+
+	if _, err := NewGame(12, 12, 5, "Ghost", 2, "Nobody", p1.Name); err == nil {
+		t.Errorf("game was created for a player who doesn't exist")
+	}
+	if _, err := NewGame(12, 12, 5, "Crowded", 2, p1.Name, p2.Name, p3.Name); err == nil {
+		t.Errorf("game was created with more participants than allowed")
+	}
+	g, _ = NewGame(12, 12, 5, "Started", 2, p1.Name, p2.Name)
+	g.StartDeployment()
+	if err := g.Kick(p2.Name); err == nil {
+		t.Errorf("%s was kicked after the game started", p2.Name)
+	}
+}
+
+func TestInviteCodeExpiry(t *testing.T) {
+	g, _ := NewGame(12, 12, 5, "Invites", 2)
+	defer func(lifetime time.Duration) { InviteCodeLifetime = lifetime }(InviteCodeLifetime)
+	InviteCodeLifetime = -time.Second
+	expired, _, _ := g.NewInviteCode()
+	InviteCodeLifetime = time.Hour
+	valid, _, _ := g.NewInviteCode()
+	if g.ValidInviteCode(expired) {
+		t.Errorf("expired invite code %s was accepted", expired)
+	}
+	if !g.ValidInviteCode(valid) {
+		t.Errorf("valid invite code %s was rejected", valid)
+	}
+	if g.ValidInviteCode("") {
+		t.Errorf("empty invite code was accepted")
+	}
+}
+
+func TestRematchSeries(t *testing.T) {
+	p1, _ := player.NewPlayer("Huey", "")
+	p2, _ := player.NewPlayer("Dewey", "")
+	g, _ := NewGame(12, 12, 5, "Best of three", 2, p1.Name, p2.Name)
+	s, err := NewSeries(g, 3, true)
+	if err != nil {
+		t.Fatalf("failed to create series: %s", err)
+	}
+	if _, err := g.Rematch(p1.Name); err == nil {
+		t.Errorf("rematch was created for unfinished game with id %s", g.ID)
+	}
+	g.Finish(p1.Name)
+	if p1.Wins != 0 {
+		t.Errorf("single game of series credited %s with %d wins", p1.Name, p1.Wins)
+	}
+	r, err := g.Rematch(p2.Name)
+	if err != nil {
+		t.Fatalf("failed to create rematch: %s", err)
+	}
+	if again, _ := g.Rematch(p1.Name); again != r {
+		t.Errorf("second rematch request created another game")
+	}
+	if !reflect.DeepEqual(r.BoardParameters, g.BoardParameters) || r.SeriesID == nil || *r.SeriesID != s.ID {
+		t.Errorf("rematch %s doesn't carry over board parameters and series", r)
+	}
+	r.Finish(p1.Name)
+	if s.Winner != p1.Name || p1.Wins != 1 || p2.Losses != 1 {
+		t.Errorf("expected %s to win series %s, got winner %s with score %v", p1.Name, s.ID, s.Winner, s.Score)
+	}
+	if _, err := r.Rematch(p2.Name); err == nil {
+		t.Errorf("rematch was created for decided series %s", s.ID)
+	}
+}
+
+func TestPlayGame(t *testing.T) {
+	p1, _ := player.NewPlayer("Gladstone", "")
+	p2, _ := player.NewPlayer("Gyro", "")
+	g, _ := NewGame(10, 10, 1, "Duel", 2, p1.Name, p2.Name)
+	if err := g.Deploy(p1.Name, "Submarine", 0, 0, "e"); err == nil {
+		t.Errorf("ship was deployed before deployment started")
+	}
+	g.StartDeployment()
+	if err := g.Deploy(p1.Name, "Submarine", 9, 9, "e"); err == nil {
+		t.Errorf("ship was deployed beyond the board")
+	}
+	g.Deploy(p1.Name, "Submarine", 0, 0, "e")
+	g.Deploy(p2.Name, "Submarine", 5, 5, "n")
+	if g.State != StateRunning || g.ActivePlayer != p1.Name {
+		t.Fatalf("expected running game with %s to fire first, got state %d and %s", p1.Name, g.State, g.ActivePlayer)
+	}
+	if _, err := g.Fire(p2.Name, p1.Name, 0, 0, ""); err == nil {
+		t.Errorf("%s fired out of turn", p2.Name)
+	}
+	shots := []struct {
+		shooter, target string
+		x, y            int
+	}{
+		{p1.Name, p2.Name, 5, 5},
+		{p2.Name, p1.Name, 3, 3},
+		{p1.Name, p2.Name, 1, 1},
+		{p2.Name, p1.Name, 4, 4},
+		{p1.Name, p2.Name, 5, 6},
+	}
+	for _, s := range shots {
+		if _, err := g.Fire(s.shooter, s.target, s.x, s.y, "Torpedo"); err != nil {
+			t.Fatalf("failed to fire: %s", err)
+		}
+	}
+	if g.State != StateFinished || g.Winner != p1.Name {
+		t.Fatalf("expected %s to win, got state %d and winner %s", p1.Name, g.State, g.Winner)
+	}
+	if p1.Stats.ShotsFired != 3 || p1.Stats.Hits != 2 || p1.Stats.AverageTurnsToWin() != 3 || p1.Stats.FavouriteWeapon() != "Torpedo" {
+		t.Errorf("unexpected statistics for %s: %+v", p1.Name, p1.Stats)
+	}
+	if p2.Stats.ShipsLost["Submarine"] != 1 || p2.Stats.LongestWinStreak != 0 {
+		t.Errorf("unexpected statistics for %s: %+v", p2.Name, p2.Stats)
+	}
+	if history, total := p2.MatchHistory(1, 10); total != 1 || history[0].Won || history[0].Opponents[0] != p1.Name {
+		t.Errorf("unexpected match history for %s: %+v", p2.Name, history)
+	}
+	types := []string{}
+	for _, e := range g.Events(0) {
+		types = append(types, e.Type)
+	}
+	expected := []string{EventJoined, EventJoined, EventDeploymentStarted, EventShipDeployed, EventShipDeployed, EventGameRunning,
+		EventShot, EventTurn, EventShot, EventTurn, EventShot, EventTurn, EventShot, EventTurn, EventShot, EventGameOver}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("unexpected events %v", types)
+	}
+}
+
+func TestChat(t *testing.T) {
+	p1, _ := player.NewPlayer("Scrooge", "")
+	p2, _ := player.NewPlayer("Magica", "")
+	outsider, _ := player.NewPlayer("Flintheart", "")
+	g, _ := NewGame(12, 12, 5, "Chat", 2, p1.Name, p2.Name)
+	ChatFilter = chat.NewFilter([]string{"curses"})
+	ChatLimiter = chat.NewLimiter(3, time.Minute)
+	ChatHistorySize = 2
+	defer func() {
+		ChatFilter = chat.NewFilter(nil)
+		ChatLimiter = chat.NewLimiter(5, 10*time.Second)
+		ChatHistorySize = 100
+	}()
+
+	e, err := g.Say(*p2, "curses, foiled again")
+	if err != nil || e.Text != "******, foiled again" || e.Player != p2.Name {
+		t.Errorf("expected masked chat message, got %+v, %v", e, err)
+	}
+	if _, err := g.Say(*outsider, "hello"); err == nil {
+		t.Errorf("non participant %s was able to chat", outsider.Name)
+	}
+	for _, text := range []string{"", "   ", strings.Repeat("a", MaxChatLength+1), "bell\a"} {
+		if _, err := g.Say(*p1, text); err == nil {
+			t.Errorf("invalid chat message %q was accepted", text)
+		}
+	}
+	if err := g.Mute(*p2, p1.Name); err == nil {
+		t.Errorf("%s muted the host without being moderator", p2.Name)
+	}
+	if err := g.Mute(*p1, p2.Name); err != nil {
+		t.Fatalf("host failed to mute %s: %s", p2.Name, err)
+	}
+	if _, err := g.Say(*p2, "let me talk"); err == nil {
+		t.Errorf("muted %s was able to chat", p2.Name)
+	}
+	outsider.Moderator = true
+	if err := g.Unmute(*outsider, p2.Name); err != nil {
+		t.Errorf("moderator failed to unmute %s: %s", p2.Name, err)
+	}
+	g.Say(*p2, "thanks")
+	g.Say(*p2, "really")
+	if _, err := g.Say(*p2, "one more"); err == nil {
+		t.Errorf("chat message beyond the rate limit was accepted")
+	}
+
+	chats := []string{}
+	for _, e := range g.Events(0) {
+		if e.Type == EventChat {
+			chats = append(chats, e.Text)
+		}
+	}
+	if !reflect.DeepEqual(chats, []string{"thanks", "really"}) {
+		t.Errorf("expected the last %d chat messages, got %v", ChatHistorySize, chats)
+	}
+	events := g.Events(0)
+	if since := g.Events(events[1].Seq); len(since) != len(events)-2 || since[0].Seq != events[2].Seq {
+		t.Errorf("expected the events after seq %d, got %+v", events[1].Seq, since)
+	}
+
+	g.Finish(p1.Name)
+	if _, err := g.Say(*p1, "gg"); err == nil {
+		t.Errorf("chat message was accepted after the game was over")
+	}
+}
+
+func TestTurnClock(t *testing.T) {
+	p1, _ := player.NewPlayer("Launchpad", "")
+	p2, _ := player.NewPlayer("Fenton", "")
+	outsider, _ := player.NewPlayer("Gizmo", "")
+	TurnTimeout = 50 * time.Millisecond
+	DisconnectGracePeriod = time.Second
+	defer func() {
+		TurnTimeout = 0
+		DisconnectGracePeriod = time.Minute
+	}()
+	g, _ := NewGame(10, 10, 1, "Clock", 2, p1.Name, p2.Name)
+	// count polls the event log, whose mutex orders the changes of the
+	// clock before the reads of the test
+	count := func(eventType string) int {
+		n := 0
+		for _, e := range g.Events(0) {
+			if e.Type == eventType {
+				n += 1
+			}
+		}
+		return n
+	}
+	waitFor := func(eventType string, n int) {
+		for i := 0; i < 200 && count(eventType) < n; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if count(eventType) < n {
+			t.Fatalf("expected %d %s events, got %d", n, eventType, count(eventType))
+		}
+	}
+
+	if err := g.Disconnect(p1.Name); err == nil {
+		t.Errorf("disconnected from an open game")
+	}
+	g.StartDeployment()
+	g.Deploy(p1.Name, "Submarine", 0, 0, "e")
+	g.Deploy(p2.Name, "Submarine", 5, 5, "n")
+	events := g.Events(0)
+	if running := events[len(events)-1]; running.Type != EventGameRunning || running.Deadline == nil {
+		t.Fatalf("expected game running with a deadline, got %+v", running)
+	}
+	waitFor(EventTurnTimeout, 1)
+	if g.ActivePlayer != p2.Name {
+		t.Fatalf("expected the turn to pass on to %s, got %s", p2.Name, g.ActivePlayer)
+	}
+
+	if err := g.Disconnect(outsider.Name); err == nil {
+		t.Errorf("non participant %s was disconnected", outsider.Name)
+	}
+	if err := g.Disconnect(p2.Name); err != nil || !g.IsDisconnected(p2.Name) {
+		t.Fatalf("failed to disconnect %s: %v", p2.Name, err)
+	}
+	time.Sleep(3 * TurnTimeout)
+	if count(EventTurnTimeout) != 1 || g.ActivePlayer != p2.Name {
+		t.Errorf("turn clock kept running while %s was disconnected", p2.Name)
+	}
+	g.Reconnect(p2.Name)
+	events = g.Events(0)
+	if reconnected := events[len(events)-1]; reconnected.Type != EventReconnected || reconnected.Deadline == nil || g.IsDisconnected(p2.Name) {
+		t.Errorf("expected the turn clock to resume on reconnect, got %+v", reconnected)
+	}
+
+	DisconnectGracePeriod = 50 * time.Millisecond
+	g.Disconnect(p1.Name)
+	waitFor(EventGameOver, 1)
+	// the forfeit holds the game lock until the scores are in
+	g.Mutex().Lock()
+	defer g.Mutex().Unlock()
+	if g.State != StateFinished || g.Winner != p2.Name || count(EventForfeited) != 1 {
+		t.Errorf("expected %s to forfeit after the grace period, got state %d and winner %s", p1.Name, g.State, g.Winner)
+	}
+	if err := g.Disconnect(p2.Name); err == nil {
+		t.Errorf("disconnected from a finished game")
+	}
+}
+
+func TestTurnClockWaitsForLock(t *testing.T) {
+	p1, _ := player.NewPlayer("Ludwig", "")
+	p2, _ := player.NewPlayer("Bentina", "")
+	TurnTimeout = 20 * time.Millisecond
+	defer func() {
+		TurnTimeout = 0
+	}()
+	g, _ := NewGame(10, 10, 1, "Locked Clock", 2, p1.Name, p2.Name)
+	g.StartDeployment()
+	g.Deploy(p1.Name, "Submarine", 0, 0, "e")
+	g.Deploy(p2.Name, "Submarine", 5, 5, "n")
+
+	// the turn runs out while a handler holds the lock and fires
+	g.Mutex().Lock()
+	time.Sleep(3 * TurnTimeout)
+	if g.ActivePlayer != p1.Name {
+		t.Fatalf("turn passed on while the game was locked")
+	}
+	TurnTimeout = time.Hour
+	if _, err := g.Fire(p1.Name, p2.Name, 9, 9, ""); err != nil {
+		t.Fatalf("failed to fire: %s", err)
+	}
+	g.Mutex().Unlock()
+	time.Sleep(50 * time.Millisecond)
+	g.Mutex().Lock()
+	defer g.Mutex().Unlock()
+	for _, e := range g.Events(0) {
+		if e.Type == EventTurnTimeout {
+			t.Errorf("turn of %s timed out after they fired", e.Player)
+		}
+	}
+	if g.ActivePlayer != p2.Name {
+		t.Errorf("expected %s to be active, got %s", p2.Name, g.ActivePlayer)
+	}
+}
+
+func TestStopClocks(t *testing.T) {
+	p1, _ := player.NewPlayer("Gladys", "")
+	p2, _ := player.NewPlayer("Fethry", "")
+	TurnTimeout = 20 * time.Millisecond
+	defer func() {
+		TurnTimeout = 0
+		ResumeClocks()
+	}()
+	g, _ := NewGame(10, 10, 1, "Stopped Clock", 2, p1.Name, p2.Name)
+	g.StartDeployment()
+	g.Deploy(p1.Name, "Submarine", 0, 0, "e")
+	g.Deploy(p2.Name, "Submarine", 5, 5, "n")
+
+	StopClocks()
+	g.Mutex().Lock()
+	g.Disconnect(p2.Name)
+	g.Mutex().Unlock()
+	time.Sleep(3 * TurnTimeout)
+	g.Mutex().Lock()
+	defer g.Mutex().Unlock()
+	if g.ActivePlayer != p1.Name || g.IsDisconnected(p2.Name) {
+		t.Errorf("expected the stopped clock to keep %s active without a grace period for %s, got %s active", p1.Name, p2.Name, g.ActivePlayer)
+	}
+}
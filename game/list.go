@@ -0,0 +1,144 @@
+package game
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type SortKey int
+
+// Filter selects games, zero values don't filter. Private games are only
+// listed if Viewer participates in them.
+type Filter struct {
+	State         *GameState
+	Participant   string
+	MinFreeSlots  int
+	SizeX         int
+	SizeY         int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Viewer        string
+}
+
+// cursor marks the last game of a page by its sort value and id.
+type cursor struct {
+	Sort       SortKey `json:"s"`
+	Descending bool    `json:"d"`
+	Value      int64   `json:"v"`
+	ID         string  `json:"id"`
+}
+
+const (
+	SortByCreationDate SortKey = iota
+	SortByFreeSlots
+)
+
+var SortKeyMap = map[string]SortKey{
+	"creation_date": SortByCreationDate,
+	"free_slots":    SortByFreeSlots,
+}
+
+func (g Game) FreeSlots() int {
+	if g.Locked || g.State != StateOpen {
+		return 0
+	}
+	return g.MaxParticipants - len(g.Participants)
+}
+
+func (f Filter) matches(g *Game) bool {
+	switch {
+	case g.Private && !g.IsParticipant(f.Viewer):
+		return false
+	case f.State != nil && g.State != *f.State:
+		return false
+	case len(f.Participant) > 0 && !g.IsParticipant(f.Participant):
+		return false
+	case f.MinFreeSlots > 0 && g.FreeSlots() < f.MinFreeSlots:
+		return false
+	case f.SizeX > 0 && g.BoardParameters.SizeX != f.SizeX:
+		return false
+	case f.SizeY > 0 && g.BoardParameters.SizeY != f.SizeY:
+		return false
+	case !f.CreatedAfter.IsZero() && !g.CreationDate.After(f.CreatedAfter):
+		return false
+	case !f.CreatedBefore.IsZero() && !g.CreationDate.Before(f.CreatedBefore):
+		return false
+	}
+	return true
+}
+
+func (s SortKey) value(g *Game) int64 {
+	if s == SortByFreeSlots {
+		return int64(g.FreeSlots())
+	}
+	return g.CreationDate.UnixNano()
+}
+
+// less orders by the sort value and breaks ties by id, so every game has a
+// stable position a cursor can refer to.
+func (c cursor) less(value int64, id string) bool {
+	if value != c.Value {
+		return (value < c.Value) != c.Descending
+	}
+	return id < c.ID
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor %s", s)
+	}
+	return c, nil
+}
+
+// List returns up to limit games matching filter, ordered by sortKey and
+// starting after the game the cursor after points to. It also returns the
+// total amount of matching games and the cursor of the next page, which is
+// empty on the last page.
+func List(filter Filter, sortKey SortKey, descending bool, after string, limit int) ([]*Game, int, string, error) {
+	games := []*Game{}
+	for _, g := range All() {
+		if filter.matches(g) {
+			games = append(games, g)
+		}
+	}
+	order := cursor{Sort: sortKey, Descending: descending}
+	sort.SliceStable(games, func(i, j int) bool {
+		c := order
+		c.Value, c.ID = sortKey.value(games[j]), games[j].ID.String()
+		return c.less(sortKey.value(games[i]), games[i].ID.String())
+	})
+	total := len(games)
+	start := 0
+	if len(after) > 0 {
+		c, err := decodeCursor(after)
+		if err != nil {
+			return nil, total, "", err
+		}
+		if c.Sort != sortKey || c.Descending != descending {
+			return nil, total, "", fmt.Errorf("cursor doesn't match the requested sort order")
+		}
+		start = sort.Search(len(games), func(i int) bool {
+			return !c.less(sortKey.value(games[i]), games[i].ID.String()) && !(c.Value == sortKey.value(games[i]) && c.ID == games[i].ID.String())
+		})
+	}
+	end := start + limit
+	if end >= len(games) {
+		return games[start:], total, "", nil
+	}
+	last := games[end-1]
+	next := cursor{Sort: sortKey, Descending: descending, Value: sortKey.value(last), ID: last.ID.String()}
+	return games[start:end], total, next.encode(), nil
+}
@@ -0,0 +1,84 @@
+package game
+
+import (
+	"fmt"
+	"golang_battleship/player"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Series links the games of a best-of-N match. With CreditWinnerOnly set,
+// the single games are not scored and only the series winner is credited.
+type Series struct {
+	ID               uuid.UUID      `json:"id"`
+	BestOf           int            `json:"best_of"`
+	Games            []uuid.UUID    `json:"games"`
+	Score            map[string]int `json:"score"`
+	Winner           string         `json:"winner,omitempty"`
+	CreditWinnerOnly bool           `json:"credit_winner_only"`
+}
+
+var AllSeries []*Series
+
+func GetSeriesByUUID(uuid string) (*Series, error) {
+	for _, s := range AllSeries {
+		if s.ID.String() == uuid {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("no series found for uuid %s", uuid)
+}
+
+// NewSeries starts a best-of-N series with g as its first game.
+func NewSeries(g *Game, bestOf int, creditWinnerOnly bool) (*Series, error) {
+	if bestOf < 1 || bestOf%2 == 0 {
+		return nil, fmt.Errorf("series length (best of %d) must be a positive odd number", bestOf)
+	}
+	if g.SeriesID != nil {
+		return nil, fmt.Errorf("game with id %s already belongs to series %s", g.ID, g.SeriesID)
+	}
+	s := Series{
+		ID:               uuid.New(),
+		BestOf:           bestOf,
+		Games:            []uuid.UUID{},
+		Score:            make(map[string]int),
+		CreditWinnerOnly: creditWinnerOnly,
+	}
+	s.link(g)
+	AllSeries = append(AllSeries, &s)
+	log.Info(fmt.Sprintf("Created new series %s (best of %d) starting with game %s", s.ID, bestOf, g.ID))
+	return &s, nil
+}
+
+func (s Series) Decided() bool {
+	return len(s.Winner) > 0
+}
+
+func (s *Series) link(g *Game) {
+	s.Games = append(s.Games, g.ID)
+	g.SeriesID = &s.ID
+}
+
+func (s *Series) recordWin(winner string, g *Game) {
+	s.Score[winner] += 1
+	if s.Score[winner] <= s.BestOf/2 {
+		return
+	}
+	s.Winner = winner
+	log.Info(fmt.Sprintf("Player %s won series %s", winner, s.ID))
+	if !s.CreditWinnerOnly {
+		return
+	}
+	for _, name := range g.ListParticipants() {
+		p, ok := player.AllPlayersMap[name]
+		if !ok {
+			continue
+		}
+		if name == winner {
+			p.ScoreWin()
+		} else {
+			p.ScoreLoss()
+		}
+	}
+}
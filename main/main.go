@@ -1,16 +1,164 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"golang_battleship/admin"
 	"golang_battleship/api"
+	"golang_battleship/arena"
+	"golang_battleship/chat"
 	"golang_battleship/client"
 	"golang_battleship/cmd"
+	"golang_battleship/game"
+	"golang_battleship/store"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 func main() {
-	configFlags := cmd.ParseCmdFlags()
-	if configFlags.Server {
-		api.Serve(configFlags.Host, configFlags.Port, configFlags.JwtSigningKey, configFlags.CSRFAuthKey)
-	} else {
-		client.Connect(configFlags.Host, configFlags.Port)
+	configFlags, args := cmd.ParseCmdFlags()
+	switch configFlags.Command {
+	case "version":
+		fmt.Printf("golang_battleship %s (api %s, %s)\n", api.VERSION, api.API_VERSION, runtime.Version())
+		return
+	case "keygen":
+		if err := cmd.Keygen(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	game.InviteCodeLifetime = configFlags.InviteLifetime
+	game.DefaultBoardsizeX = configFlags.Game.BoardSizeX
+	game.DefaultBoardsizeY = configFlags.Game.BoardSizeY
+	game.DefaultMaxships = configFlags.Game.MaxShips
+	game.DefaultMaxParticipants = configFlags.Game.MaxParticipants
+	game.DefaultFleet = configFlags.Game.Fleet
+	game.TurnTimeout = configFlags.Game.TurnTimeout
+	game.DisconnectGracePeriod = configFlags.Game.DisconnectGracePeriod
+	game.ChatHistorySize = configFlags.Chat.History
+	game.ChatLimiter = chat.NewLimiter(configFlags.Chat.RateLimit, configFlags.Chat.RateWindow)
+	game.ChatFilter = chat.NewFilter(configFlags.Chat.ProfanityWords)
+	api.JWTLifetime = configFlags.JWTLifetime
+	api.PasswordRequirements = api.PasswordPolicy{
+		MinLength:     configFlags.PasswordPolicy.MinLength,
+		RequireUpper:  configFlags.PasswordPolicy.RequireUpper,
+		RequireLower:  configFlags.PasswordPolicy.RequireLower,
+		RequireDigit:  configFlags.PasswordPolicy.RequireDigit,
+		RequireSymbol: configFlags.PasswordPolicy.RequireSymbol,
+	}
+	api.LoginThrottler.Account.LockoutThreshold = configFlags.LoginLockout.Threshold
+	api.LoginThrottler.Account.LockoutDuration = configFlags.LoginLockout.Duration
+	api.LoginThrottler.IP.LockoutDuration = configFlags.LoginLockout.Duration
+	arena.BotArena.Deadline = configFlags.BotArena.Deadline
+	arena.BotArena.MaxIllegalMoves = configFlags.BotArena.MaxIllegalMoves
+	arena.BotArena.Authenticate = api.AuthenticateBot
+	api.ShutdownTimeout = configFlags.ShutdownTimeout
+	switch configFlags.Command {
+	case "serve":
+		tlsOptions := api.TLSOptions{
+			CertFile:     configFlags.TLS.CertFile,
+			KeyFile:      configFlags.TLS.KeyFile,
+			SelfSigned:   configFlags.TLS.SelfSigned,
+			RedirectPort: configFlags.TLS.RedirectPort,
+		}
+		jwtKeys, csrfKeys := keyRings(configFlags.KeyFile, configFlags.KeyGracePeriod, configFlags.JwtSigningKey, configFlags.CSRFAuthKey)
+		serve(configFlags.Host, configFlags.Port, configFlags.MetricsPort, configFlags.BotArena.Port, tlsOptions, configFlags.StateFile, configFlags.KeyFile, jwtKeys, csrfKeys)
+	case "simulate":
+		log.Fatal(client.RunBot(configFlags.Host, configFlags.BotArena.Port, string(configFlags.BotToken)))
+	case "admin":
+		if err := admin.Run(configFlags.StateFile, args, os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case "play":
+		client.Connect(configFlags.Host, configFlags.Port, configFlags.TLS.Client, configFlags.TLS.Insecure)
+	}
+}
+
+// keyRings holds the keys from keyFile, or the keys from the env if there's
+// no key file.
+func keyRings(keyFile string, grace time.Duration, jwtSigningKey []byte, csrfAuthKey []byte) (*api.KeyRing, *api.KeyRing) {
+	if len(keyFile) == 0 {
+		return api.StaticKeyRing(jwtSigningKey), api.StaticKeyRing(csrfAuthKey)
+	}
+	keys, err := api.LoadKeyFile(keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	jwtKeys, err := api.NewKeyRing(grace, keys.JWT...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	csrfKeys, err := api.NewKeyRing(grace, keys.CSRF...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return jwtKeys, csrfKeys
+}
+
+// reloadKeys rotates the keys to the ones in keyFile on every SIGHUP, a
+// broken key file keeps the current keys.
+func reloadKeys(ctx context.Context, keyFile string, jwtKeys *api.KeyRing, csrfKeys *api.KeyRing) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		keys, err := api.LoadKeyFile(keyFile)
+		if err != nil {
+			log.Error("failed to reload keys, keeping the current ones, ", err)
+			continue
+		}
+		if err := jwtKeys.Rotate(keys.JWT...); err != nil {
+			log.Error("failed to rotate jwt keys, ", err)
+			continue
+		}
+		if err := csrfKeys.Rotate(keys.CSRF...); err != nil {
+			log.Error("failed to rotate csrf keys, ", err)
+			continue
+		}
+		log.Info("reloaded keys from ", keyFile)
+	}
+}
+
+// serve runs the server until SIGINT or SIGTERM, restoring the state from
+// stateFile before and saving it after. The keys are reloaded from keyFile
+// on SIGHUP.
+func serve(host string, port int, metricsPort int, botPort int, tlsOptions api.TLSOptions, stateFile string, keyFile string, jwtKeys *api.KeyRing, csrfKeys *api.KeyRing) {
+	if len(stateFile) > 0 {
+		if err := store.Load(stateFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if len(keyFile) > 0 {
+		go reloadKeys(ctx, keyFile, jwtKeys, csrfKeys)
+	}
+	if botPort > 0 {
+		go func() {
+			if err := arena.BotArena.ListenTCP(host, botPort); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+	err := api.Serve(ctx, host, port, metricsPort, tlsOptions, jwtKeys, csrfKeys)
+	if len(stateFile) > 0 {
+		if err := store.Save(stateFile); err != nil {
+			log.Error("failed to save state, ", err)
+		} else {
+			log.Info("saved state to ", stateFile)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
 	}
 }
@@ -1,9 +1,30 @@
 package main
 
 import (
+	"golang_battleship/cmd"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
-func TestMainFunc(t *testing.T) {
-	main()
+func TestParseCommands(t *testing.T) {
+	defer func(args []string) {
+		os.Args = args
+	}(os.Args)
+
+	os.Args = []string{"battleship", "version"}
+	if c, _ := cmd.ParseCmdFlags(); c.Command != "version" {
+		t.Errorf("expected the version command, got %q", c.Command)
+	}
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	os.Args = []string{"battleship", "admin", "-state-file", stateFile, "players", "list"}
+	c, args := cmd.ParseCmdFlags()
+	if c.Command != "admin" || c.StateFile != stateFile {
+		t.Errorf("expected the admin command on %s, got %q on %s", stateFile, c.Command, c.StateFile)
+	}
+	if !reflect.DeepEqual(args, []string{"players", "list"}) {
+		t.Errorf("expected the admin arguments to be passed on, got %v", args)
+	}
 }
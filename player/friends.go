@@ -0,0 +1,163 @@
+package player
+
+import (
+	"fmt"
+	"time"
+)
+
+// GameInvite invites a friend to a game, the code authorizes joining
+// private games.
+type GameInvite struct {
+	GameID  string    `json:"game_id"`
+	From    string    `json:"from"`
+	Code    string    `json:"code,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+func (p *Player) IsFriend(name string) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	return contains(p.Friends, name)
+}
+
+// Friendships returns copies of the friends of p and of the names of the
+// players asking p for friendship.
+func (p *Player) Friendships() ([]string, []string) {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]string{}, p.Friends...), append([]string{}, p.FriendRequests...)
+}
+
+// RequestFriendship sends a friend request from p to the player with name,
+// which accepts a pending request of theirs. It reports whether p and the
+// other player are friends now.
+func (p *Player) RequestFriendship(name string) (bool, error) {
+	registry.Lock()
+	defer registry.Unlock()
+	other, ok := AllPlayersMap[name]
+	if !ok {
+		return false, fmt.Errorf("no player with name \"%s\" found", name)
+	}
+	if other.Name == p.Name {
+		return false, fmt.Errorf("player %s cannot befriend themselves", p.Name)
+	}
+	if contains(p.Friends, name) {
+		return false, fmt.Errorf("%s and %s are already friends", p.Name, name)
+	}
+	if contains(p.FriendRequests, name) {
+		return true, p.acceptFriendship(name)
+	}
+	if contains(other.FriendRequests, p.Name) {
+		return false, fmt.Errorf("%s has already sent a friend request to %s", p.Name, name)
+	}
+	other.FriendRequests = append(other.FriendRequests, p.Name)
+	return false, nil
+}
+
+// AcceptFriendship accepts the pending friend request of the player with name.
+func (p *Player) AcceptFriendship(name string) error {
+	registry.Lock()
+	defer registry.Unlock()
+	return p.acceptFriendship(name)
+}
+
+func (p *Player) acceptFriendship(name string) error {
+	if !contains(p.FriendRequests, name) {
+		return fmt.Errorf("no friend request from %s to %s", name, p.Name)
+	}
+	other, ok := AllPlayersMap[name]
+	if !ok {
+		p.FriendRequests = remove(p.FriendRequests, name)
+		return fmt.Errorf("no player with name \"%s\" found", name)
+	}
+	p.FriendRequests = remove(p.FriendRequests, name)
+	other.FriendRequests = remove(other.FriendRequests, p.Name)
+	p.Friends = append(p.Friends, name)
+	other.Friends = append(other.Friends, p.Name)
+	return nil
+}
+
+// RemoveFriendship ends the friendship with the player with name, or
+// declines or withdraws a friend request between them.
+func (p *Player) RemoveFriendship(name string) error {
+	registry.Lock()
+	defer registry.Unlock()
+	other, ok := AllPlayersMap[name]
+	if !ok || !(contains(p.Friends, name) || contains(p.FriendRequests, name) || contains(other.FriendRequests, p.Name)) {
+		return fmt.Errorf("%s is neither friend of %s nor has a friend request pending", name, p.Name)
+	}
+	p.Friends = remove(p.Friends, name)
+	p.FriendRequests = remove(p.FriendRequests, name)
+	other.Friends = remove(other.Friends, p.Name)
+	other.FriendRequests = remove(other.FriendRequests, p.Name)
+	return nil
+}
+
+// SentFriendRequests returns the names of the players p sent a pending friend request to.
+func (p *Player) SentFriendRequests() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	sent := []string{}
+	for _, other := range AllPlayersList {
+		if contains(other.FriendRequests, p.Name) {
+			sent = append(sent, other.Name)
+		}
+	}
+	return sent
+}
+
+// Invite adds invite to the invites of p, replacing an earlier one to the same game.
+func (p *Player) Invite(invite GameInvite) {
+	registry.Lock()
+	defer registry.Unlock()
+	invites := []GameInvite{}
+	for _, i := range p.Invites {
+		if i.GameID != invite.GameID {
+			invites = append(invites, i)
+		}
+	}
+	p.Invites = append(invites, invite)
+}
+
+// PendingInvites returns the invites of p which haven't expired, dropping
+// the expired ones along the way.
+func (p *Player) PendingInvites() []GameInvite {
+	registry.Lock()
+	defer registry.Unlock()
+	now := time.Now()
+	pending := []GameInvite{}
+	for _, i := range p.Invites {
+		if i.Expires.After(now) {
+			pending = append(pending, i)
+		}
+	}
+	p.Invites = pending
+	return append([]GameInvite{}, pending...)
+}
+
+// forget drops all friendships and friend requests of the deleted player name.
+func forget(name string) {
+	for _, p := range AllPlayersList {
+		p.Friends = remove(p.Friends, name)
+		p.FriendRequests = remove(p.FriendRequests, name)
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(names []string, name string) []string {
+	kept := []string{}
+	for _, n := range names {
+		if n != name {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,12 +15,21 @@ type PlayerMap map[string]*Player
 type PlayerList []*Player
 
 type Player struct {
-	Name             string    `json:"name"`
-	PasswordHash     string    `json:"-"`
-	ID               uuid.UUID `json:"id"`
-	RegistrationDate time.Time `json:"-"`
-	Wins             int       `json:"wins"`
-	Losses           int       `json:"losses"`
+	Name             string        `json:"name"`
+	PasswordHash     string        `json:"-"`
+	ID               uuid.UUID     `json:"id"`
+	RegistrationDate time.Time     `json:"-"`
+	Wins             int           `json:"wins"`
+	Losses           int           `json:"losses"`
+	Profile          Profile       `json:"-"`
+	Stats            Statistics    `json:"-"`
+	History          []MatchRecord `json:"-"`
+	// Moderator may mute players in the chat of any game.
+	Moderator bool     `json:"-"`
+	Friends   []string `json:"-"`
+	// FriendRequests are the names of the players asking p for friendship.
+	FriendRequests []string     `json:"-"`
+	Invites        []GameInvite `json:"-"`
 }
 
 func (l PlayerList) Len() int {
@@ -52,25 +62,37 @@ func (l PlayerList) BestOf(ranking int) ([]*Player, error) {
 	return retval, nil
 }
 
+const ValidPlayernameRegex = `[a-zA-Z][a-zA-Z0-9\-_]{0,31}`
+
 var AllPlayersMap = make(PlayerMap)
 
 var AllPlayersList PlayerList
 
+// registry guards the registration and deletion of players against the
+// lookups from other goroutines, such as the metrics scrapes.
+var registry sync.RWMutex
+
 func (p Player) String() string {
 	return p.Name
 }
 
 func (p *Player) ScoreWin() {
+	registry.Lock()
+	defer registry.Unlock()
 	p.Wins += 1
 	sort.Sort(AllPlayersList)
 }
 
 func (p *Player) ScoreLoss() {
+	registry.Lock()
+	defer registry.Unlock()
 	p.Losses += 1
 	sort.Sort(AllPlayersList)
 }
 
 func GetByName(playername string) (Player, error) {
+	registry.RLock()
+	defer registry.RUnlock()
 	for _, existingPlayer := range AllPlayersMap {
 		if playername == existingPlayer.Name {
 			return *existingPlayer, nil
@@ -80,11 +102,13 @@ func GetByName(playername string) (Player, error) {
 }
 
 func NewPlayer(name string, passwordHash string) (*Player, error) {
-	r := regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9\-_]{0,31}$`)
+	r := regexp.MustCompile("^" + ValidPlayernameRegex + "$")
 	if !r.MatchString(name) {
 		return &Player{}, fmt.Errorf("player name %s doesn't meet requirements (starts with a letter, "+
 			"only letters or numbers allowed, max size 32 characters)", name)
 	}
+	registry.Lock()
+	defer registry.Unlock()
 	for _, existingPlayer := range AllPlayersMap {
 		if name == existingPlayer.Name {
 			return &Player{}, fmt.Errorf("player name %s is already taken", name)
@@ -92,7 +116,7 @@ func NewPlayer(name string, passwordHash string) (*Player, error) {
 	}
 	id := uuid.New()
 	now := time.Now().UTC()
-	p := Player{name, passwordHash, id, now, 0, 0}
+	p := Player{Name: name, PasswordHash: passwordHash, ID: id, RegistrationDate: now, Profile: Profile{Avatar: DefaultAvatar}}
 	AllPlayersMap[name] = &p
 	AllPlayersList = append(AllPlayersList, &p)
 	sort.Sort(AllPlayersList)
@@ -100,6 +124,8 @@ func NewPlayer(name string, passwordHash string) (*Player, error) {
 }
 
 func DeletePlayer(name string) (Player, error) {
+	registry.Lock()
+	defer registry.Unlock()
 	p, ok := AllPlayersMap[name]
 	if !ok {
 		return Player{}, fmt.Errorf("no player with name \"%s\" found", name)
@@ -111,5 +137,38 @@ func DeletePlayer(name string) (Player, error) {
 			sort.Sort(AllPlayersList)
 		}
 	}
+	forget(name)
+	return *p, nil
+}
+
+// Lookup returns the registered player with name. Changes to the player
+// have to go through Update or the locking methods of Player.
+func Lookup(name string) (*Player, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	p, ok := AllPlayersMap[name]
+	return p, ok
+}
+
+// Update applies change to the registered player with name while holding
+// the registry and returns a copy of the result. change must not call the
+// locking methods of Player.
+func Update(name string, change func(p *Player) error) (Player, error) {
+	registry.Lock()
+	defer registry.Unlock()
+	p, ok := AllPlayersMap[name]
+	if !ok {
+		return Player{}, fmt.Errorf("player name %s doesnt exist", name)
+	}
+	if err := change(p); err != nil {
+		return Player{}, err
+	}
 	return *p, nil
 }
+
+// Count returns the number of registered players.
+func Count() int {
+	registry.RLock()
+	defer registry.RUnlock()
+	return len(AllPlayersMap)
+}
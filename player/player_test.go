@@ -2,7 +2,9 @@ package player
 
 import (
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewPlayer(t *testing.T) {
@@ -29,3 +31,76 @@ func TestNewPlayer(t *testing.T) {
 		}
 	}
 }
+
+func TestFriendship(t *testing.T) {
+	a, _ := NewPlayer("Jolyne", "")
+	b, _ := NewPlayer("Ermes", "")
+	c, _ := NewPlayer("Foo_Fighters", "")
+	if _, err := a.RequestFriendship(a.Name); err == nil {
+		t.Errorf("%s befriended themselves", a.Name)
+	}
+	if _, err := a.RequestFriendship("Nobody"); err == nil {
+		t.Errorf("friend request to unknown player was sent")
+	}
+	if accepted, err := a.RequestFriendship(b.Name); accepted || err != nil {
+		t.Fatalf("failed to send friend request, got %t, %v", accepted, err)
+	}
+	if _, err := a.RequestFriendship(b.Name); err == nil {
+		t.Errorf("duplicate friend request was sent")
+	}
+	if sent := a.SentFriendRequests(); len(sent) != 1 || sent[0] != b.Name {
+		t.Errorf("expected sent request to %s, got %v", b.Name, sent)
+	}
+	if err := a.AcceptFriendship(b.Name); err == nil {
+		t.Errorf("%s accepted their own friend request", a.Name)
+	}
+	if err := b.AcceptFriendship(a.Name); err != nil || !a.IsFriend(b.Name) || !b.IsFriend(a.Name) || len(b.FriendRequests) != 0 {
+		t.Errorf("failed to accept friend request, got %v, %v, %v", err, a.Friends, b.Friends)
+	}
+	c.RequestFriendship(a.Name)
+	if accepted, err := a.RequestFriendship(c.Name); !accepted || err != nil || !c.IsFriend(a.Name) {
+		t.Errorf("mutual friend request wasn't accepted, got %t, %v", accepted, err)
+	}
+	if err := a.RemoveFriendship(c.Name); err != nil || a.IsFriend(c.Name) || c.IsFriend(a.Name) {
+		t.Errorf("failed to remove friendship, got %v", err)
+	}
+	if err := a.RemoveFriendship(c.Name); err == nil {
+		t.Errorf("removed friendship which didn't exist")
+	}
+	DeletePlayer(b.Name)
+	if a.IsFriend(b.Name) {
+		t.Errorf("deleted player %s is still friend of %s", b.Name, a.Name)
+	}
+
+	a.Invite(GameInvite{GameID: "1", From: c.Name, Expires: time.Now().Add(-time.Second)})
+	a.Invite(GameInvite{GameID: "2", From: c.Name, Expires: time.Now().Add(time.Hour)})
+	a.Invite(GameInvite{GameID: "2", From: c.Name, Code: "new", Expires: time.Now().Add(time.Hour)})
+	if pending := a.PendingInvites(); len(pending) != 1 || pending[0].Code != "new" {
+		t.Errorf("expected the latest unexpired invite, got %+v", pending)
+	}
+}
+
+func TestConcurrentFriendRequests(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		a, _ := NewPlayer(fmt.Sprintf("Anasui%d", i), "")
+		b, _ := NewPlayer(fmt.Sprintf("Weather%d", i), "")
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			a.RequestFriendship(b.Name)
+		}()
+		go func() {
+			defer wg.Done()
+			b.RequestFriendship(a.Name)
+		}()
+		go func() {
+			defer wg.Done()
+			NewPlayer(fmt.Sprintf("Pucci%d", i), "")
+		}()
+		wg.Wait()
+		if !a.IsFriend(b.Name) || !b.IsFriend(a.Name) {
+			t.Fatalf("expected %s and %s to be friends after requesting each other, got %v and %v", a.Name, b.Name, a.Friends, b.Friends)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package player
+
+import (
+	"fmt"
+	"golang_battleship/ship"
+	"unicode"
+)
+
+type BoardSize struct {
+	SizeX int `json:"size_x"`
+	SizeY int `json:"size_y"`
+}
+
+type FleetEntry struct {
+	Class       string `json:"class"`
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	Orientation string `json:"orientation"`
+}
+
+type Profile struct {
+	DisplayName        string       `json:"display_name"`
+	Avatar             string       `json:"avatar"`
+	PreferredBoardSize *BoardSize   `json:"preferred_board_size,omitempty"`
+	DefaultFleet       []FleetEntry `json:"default_fleet"`
+}
+
+const (
+	DefaultAvatar      = "captain"
+	MaxDisplayNameSize = 32
+)
+
+// Avatars maps the selectable avatars to their image under static/images.
+var Avatars = map[string]string{
+	"captain":        "captain_icon_256px.png",
+	"ship":           "ship_icon_256px.png",
+	"torpedo":        "torpedo_icon_256px.png",
+	"steering_wheel": "steering_wheel_icon_256px.png",
+}
+
+func (p Player) DisplayName() string {
+	if len(p.Profile.DisplayName) == 0 {
+		return p.Name
+	}
+	return p.Profile.DisplayName
+}
+
+// UpdateProfile validates and stores profile. Board size and fleet are only
+// checked for sanity here, the game rules are enforced by game.ValidateFleet.
+func (p *Player) UpdateProfile(profile Profile) error {
+	if len([]rune(profile.DisplayName)) > MaxDisplayNameSize {
+		return fmt.Errorf("display name exceeds max size of %d characters", MaxDisplayNameSize)
+	}
+	for _, r := range profile.DisplayName {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("display name contains non-printable characters")
+		}
+	}
+	if len(profile.Avatar) == 0 {
+		profile.Avatar = DefaultAvatar
+	}
+	if _, ok := Avatars[profile.Avatar]; !ok {
+		return fmt.Errorf("unknown avatar %s", profile.Avatar)
+	}
+	for _, f := range profile.DefaultFleet {
+		if !ship.ValidClass(f.Class) {
+			return fmt.Errorf("unknown ship class %s in default fleet", f.Class)
+		}
+		if _, err := ship.OrientationFromString(f.Orientation); err != nil {
+			return err
+		}
+	}
+	p.Profile = profile
+	return nil
+}
+
+func (p *Player) SetPasswordHash(passwordHash string) {
+	p.PasswordHash = passwordHash
+}
@@ -0,0 +1,105 @@
+package player
+
+import (
+	"sort"
+	"time"
+)
+
+type Statistics struct {
+	ShotsFired       int            `json:"shots_fired"`
+	Hits             int            `json:"hits"`
+	GamesWon         int            `json:"games_won"`
+	TurnsToWin       int            `json:"-"`
+	ShipsLost        map[string]int `json:"ships_lost"`
+	WeaponsUsed      map[string]int `json:"weapons_used"`
+	CurrentWinStreak int            `json:"current_win_streak"`
+	LongestWinStreak int            `json:"longest_win_streak"`
+}
+
+// MatchRecord summarizes a finished game from the perspective of one participant.
+type MatchRecord struct {
+	GameID    string    `json:"game_id"`
+	Opponents []string  `json:"opponents"`
+	Winner    string    `json:"winner"`
+	Won       bool      `json:"won"`
+	Turns     int       `json:"turns"`
+	Date      time.Time `json:"date"`
+}
+
+func (s Statistics) Accuracy() float64 {
+	if s.ShotsFired == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.ShotsFired)
+}
+
+func (s Statistics) AverageTurnsToWin() float64 {
+	if s.GamesWon == 0 {
+		return 0
+	}
+	return float64(s.TurnsToWin) / float64(s.GamesWon)
+}
+
+// FavouriteWeapon is the most used weapon, ties are broken alphabetically.
+func (s Statistics) FavouriteWeapon() string {
+	names := []string{}
+	for name := range s.WeaponsUsed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	favourite := ""
+	for _, name := range names {
+		if len(favourite) == 0 || s.WeaponsUsed[name] > s.WeaponsUsed[favourite] {
+			favourite = name
+		}
+	}
+	return favourite
+}
+
+func (p *Player) RecordShot(weaponName string, hit bool) {
+	if p.Stats.WeaponsUsed == nil {
+		p.Stats.WeaponsUsed = make(map[string]int)
+	}
+	p.Stats.ShotsFired += 1
+	p.Stats.WeaponsUsed[weaponName] += 1
+	if hit {
+		p.Stats.Hits += 1
+	}
+}
+
+func (p *Player) RecordShipLost(className string) {
+	if p.Stats.ShipsLost == nil {
+		p.Stats.ShipsLost = make(map[string]int)
+	}
+	p.Stats.ShipsLost[className] += 1
+}
+
+// RecordMatch adds a finished game to the match history and updates the win statistics.
+func (p *Player) RecordMatch(m MatchRecord) {
+	p.History = append(p.History, m)
+	if !m.Won {
+		p.Stats.CurrentWinStreak = 0
+		return
+	}
+	p.Stats.GamesWon += 1
+	p.Stats.TurnsToWin += m.Turns
+	p.Stats.CurrentWinStreak += 1
+	if p.Stats.CurrentWinStreak > p.Stats.LongestWinStreak {
+		p.Stats.LongestWinStreak = p.Stats.CurrentWinStreak
+	}
+}
+
+// MatchHistory returns up to pageSize match records of the given page, most recent first,
+// along with the total amount of records.
+func (p Player) MatchHistory(page int, pageSize int) ([]MatchRecord, int) {
+	total := len(p.History)
+	records := []MatchRecord{}
+	start := (page - 1) * pageSize
+	if page < 1 || pageSize < 1 || start >= total {
+		return records, total
+	}
+	for i := total - 1 - start; i >= 0 && len(records) < pageSize; i-- {
+		records = append(records, p.History[i])
+	}
+	return records, total
+}
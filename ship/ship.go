@@ -62,6 +62,11 @@ func NewShip(className string, x int, y int, orientation string) *Ship {
 	return s
 }
 
+func ValidClass(className string) bool {
+	_, ok := lengthMap[className]
+	return ok
+}
+
 func OrientationFromString(orientationString string) (orientation, error) {
 	if o, ok := orientationMap[orientationString]; ok {
 		return o, nil
@@ -101,6 +106,10 @@ func (ship Ship) String() string {
 	return fmt.Sprintf("%v (Stern: %v, Heading: %v, Length: %d, Hits: %d)", ship.class.name, ship.SternCoordinate().String(), ship.Orientation().String(), ship.Length(), ship.Hits())
 }
 
+func (ship Ship) ClassName() string {
+	return ship.class.name
+}
+
 func (ship Ship) Length() int {
 	return ship.class.length
 }
@@ -137,6 +146,16 @@ func (ship Ship) Orientation() orientation {
 	return orientation{int8(x), int8(y)}
 }
 
+// Heading returns the orientation of the ship as accepted by NewShip.
+func (ship Ship) Heading() string {
+	for heading, o := range orientationMap {
+		if o == ship.Orientation() {
+			return heading
+		}
+	}
+	return ""
+}
+
 func (ship Ship) Collides(otherShip Ship) bool {
 	for _, outerCoord := range ship.Coordinates() {
 		for _, innerCoord := range otherShip.Coordinates() {
@@ -161,3 +180,14 @@ func (ship Ship) Hits() int {
 func (ship Ship) Destroyed() bool {
 	return ship.Hits() == ship.class.length
 }
+
+// Hit damages the structure unit at x/y, returns false if the ship doesn't cover x/y.
+func (ship *Ship) Hit(x, y int) bool {
+	for i, s := range ship.structure {
+		if s.c.x == x && s.c.y == y {
+			ship.structure[i].healthy = false
+			return true
+		}
+	}
+	return false
+}
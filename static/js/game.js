@@ -43,7 +43,7 @@ export default {
         async fetchData() {
           this.error = false;
           this.loading = true;
-          let url = "/games/" + this.gameProperties.id;
+          let url = "/api/v1/games/" + this.gameProperties.id;
           try {
             const game_response = await fetch(url)
             this.error = false;
@@ -13,7 +13,9 @@ export default {
                    {text: "Running", state: "running"},
                    {text: "Finished", state: "finished"}],
         activeNavIndex: 0,
-        gamelist: new Object,
+        gamelist: [],
+        total: 0,
+        nextCursor: "",
         loading: false,
         error: false,
       }
@@ -28,10 +30,13 @@ export default {
             navItem.isActive = true;
           }
         },
-        async fetchData() {
+        async fetchData(cursor) {
           this.error = false;
-          this.loading = true;
-          let url = "/games" + "?state=" + this.navItems[this.activeNavIndex].state
+          this.loading = !cursor;
+          let url = "/api/v1/games" + "?state=" + this.navItems[this.activeNavIndex].state
+          if (cursor) {
+            url = url + "&cursor=" + encodeURIComponent(cursor);
+          }
           try {
             const gamelist_response = await fetch(url)
             this.error = false;
@@ -39,7 +44,10 @@ export default {
               this.error = true;
               this.loading = false;
             } else {
-              this.gamelist = await gamelist_response.json();
+              const page = await gamelist_response.json();
+              this.gamelist = cursor ? this.gamelist.concat(page.games) : page.games;
+              this.total = page.total;
+              this.nextCursor = page.next_cursor || "";
             }
           } catch (err) {
             console.log("Failed to fetch games " + err);
@@ -73,11 +81,15 @@ export default {
           Failed to fetch games.
         </div>
     </div>
-    <div class="alert alert-secondary" role="alert" v-else-if="Object.keys(gamelist).length == 0">
+    <div class="alert alert-secondary" role="alert" v-else-if="gamelist.length == 0">
       No games available at the moment.
     </div>
     <div class="card my-2" v-for="g in gamelist">
         <game :gameProperties=g></game>
     </div>
+    <div class="d-flex flex-row align-items-center my-2" v-if="!loading && !error && gamelist.length > 0">
+      <span class="text-muted">{{ gamelist.length }} of {{ total }} games</span>
+      <button class="btn btn-outline-secondary ms-auto" type="button" v-if="nextCursor" @click="fetchData(nextCursor)">Load more</button>
+    </div>
     `
 }
\ No newline at end of file
@@ -15,7 +15,7 @@ export default {
           }
           this.error = false;
           this.loading = true;
-          let url = `/login`;
+          let url = `/api/v1/login`;
           const requestOptions = {
             method: "POST",
             headers: { "Content-Type": "application/json" },
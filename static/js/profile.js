@@ -0,0 +1,139 @@
+export default {
+    created() {
+      this.fetchData()
+    },
+    data() {
+      return {
+        profile: null,
+        avatars: ["captain", "ship", "torpedo", "steering_wheel"],
+        currentPassword: "",
+        newPassword: "",
+        csrfToken: "",
+        message: "",
+        loading: false,
+        error: false,
+      }
+    },
+    methods: {
+        async fetchData() {
+          this.error = false;
+          this.loading = true;
+          try {
+            const profile_response = await fetch("/api/v1/players/me")
+            if (!profile_response.ok) {
+              this.error = true;
+            } else {
+              this.csrfToken = profile_response.headers.get("X-CSRF-Token");
+              this.profile = await profile_response.json();
+            }
+          } catch (err) {
+            console.log("Failed to fetch profile " + err);
+            this.error = true;
+          }
+          this.loading = false;
+        },
+        async request(method, url, body) {
+          this.message = "";
+          try {
+            const response = await fetch(url, {
+              method: method,
+              headers: {"Content-Type": "application/json", "X-CSRF-Token": this.csrfToken},
+              body: body ? JSON.stringify(body) : null,
+            })
+            if (!response.ok) {
+              const e = await response.json();
+              this.message = e.message;
+              return null;
+            }
+            return response;
+          } catch (err) {
+            console.log("Failed to " + method + " " + url + " " + err);
+            this.message = "Request failed.";
+            return null;
+          }
+        },
+        async save() {
+          const response = await this.request("PATCH", "/api/v1/players/me", {
+            display_name: this.profile.display_name,
+            avatar: this.profile.avatar,
+            preferred_board_size: this.profile.preferred_board_size,
+          });
+          if (response) {
+            this.profile = await response.json();
+            this.message = "Profile saved.";
+          }
+        },
+        async changePassword() {
+          const response = await this.request("POST", "/api/v1/players/me/password", {
+            current_password: this.currentPassword,
+            new_password: this.newPassword,
+          });
+          if (response) {
+            this.currentPassword = "";
+            this.newPassword = "";
+            this.message = "Password changed.";
+          }
+        },
+        async deleteAccount() {
+          if (!confirm("Delete your account? This cannot be undone.")) {
+            return;
+          }
+          if (await this.request("DELETE", "/api/v1/players/me")) {
+            window.location.href = "/login.html";
+          }
+        },
+    },
+    template: `
+    <div v-if="loading">
+      <strong>
+        Loading...
+      </strong>
+      <div class="spinner-border" aria-hidden="true"></div>
+    </div>
+    <div v-else-if="error">
+      <div class="alert alert-danger" role="alert">
+        Failed to fetch profile.
+      </div>
+    </div>
+    <div class="row my-3" v-else-if="profile">
+      <div class="col-6">
+        <h5>{{ profile.name }}</h5>
+        <div class="mb-3">
+          <label class="form-label">Display name</label>
+          <input type="text" class="form-control" v-model="profile.display_name" maxlength="32">
+        </div>
+        <div class="mb-3">
+          <label class="form-label">Avatar</label>
+          <div>
+            <img v-for="a in avatars" :src="'/' + a + '_icon_256px.png'" :title="a" width="64" class="me-2 rounded" v-bind:class="{ 'border border-primary': a == profile.avatar }" @click="profile.avatar = a">
+          </div>
+        </div>
+        <div class="mb-3" v-if="profile.preferred_board_size">
+          <label class="form-label">Preferred board size</label>
+          <div class="input-group">
+            <input type="number" class="form-control" v-model.number="profile.preferred_board_size.size_x" min="10">
+            <span class="input-group-text">x</span>
+            <input type="number" class="form-control" v-model.number="profile.preferred_board_size.size_y" min="10">
+          </div>
+        </div>
+        <button class="btn btn-link px-0 mb-3" v-else @click="profile.preferred_board_size = {size_x: 12, size_y: 12}">Set preferred board size</button>
+        <div>
+          <button class="btn btn-primary" @click="save()">Save</button>
+        </div>
+      </div>
+      <div class="col-6">
+        <h5>Change password</h5>
+        <div class="mb-3">
+          <input type="password" class="form-control mb-2" v-model="currentPassword" placeholder="Current password">
+          <input type="password" class="form-control" v-model="newPassword" placeholder="New password">
+        </div>
+        <button class="btn btn-secondary mb-5" @click="changePassword()">Change password</button>
+        <h5>Delete account</h5>
+        <button class="btn btn-danger" @click="deleteAccount()">Delete account</button>
+      </div>
+      <div class="alert alert-secondary my-3" role="alert" v-if="message">
+        {{ message }}
+      </div>
+    </div>
+    `
+}
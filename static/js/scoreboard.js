@@ -18,7 +18,7 @@ export default {
         async fetchData() {
           this.error = false;
           this.loading = true;
-          let url = `/players`;
+          let url = `/api/v1/players`;
           if (this.ranking) {
             url = url + "?ranking="+ this.ranking;
           }
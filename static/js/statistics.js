@@ -0,0 +1,131 @@
+export default {
+    created() {
+      this.fetchPlayers()
+    },
+    data() {
+      return {
+        players: [],
+        selected: null,
+        stats: null,
+        history: { total: 0, page: 1, page_size: 10, games: [] },
+        loading: false,
+        error: false,
+      }
+    },
+    computed: {
+      pages() {
+        return Math.max(1, Math.ceil(this.history.total / this.history.page_size));
+      }
+    },
+    methods: {
+        async fetchPlayers() {
+          this.error = false;
+          this.loading = true;
+          try {
+            const players_response = await fetch("/api/v1/players")
+            if (!players_response.ok) {
+              this.error = true;
+            } else {
+              this.players = await players_response.json();
+            }
+          } catch (err) {
+            console.log("Failed to fetch players " + err);
+            this.error = true;
+          }
+          this.loading = false;
+        },
+        async select(name) {
+          this.selected = name;
+          this.error = false;
+          try {
+            const stats_response = await fetch("/api/v1/players/" + name + "/stats")
+            if (!stats_response.ok) {
+              this.error = true;
+              return;
+            }
+            this.stats = await stats_response.json();
+          } catch (err) {
+            console.log("Failed to fetch statistics " + err);
+            this.error = true;
+          }
+          this.fetchHistory(1);
+        },
+        async fetchHistory(page) {
+          let url = "/api/v1/players/" + this.selected + "/games?page=" + page + "&page_size=" + this.history.page_size;
+          try {
+            const history_response = await fetch(url)
+            if (!history_response.ok) {
+              this.error = true;
+            } else {
+              this.history = await history_response.json();
+            }
+          } catch (err) {
+            console.log("Failed to fetch match history " + err);
+            this.error = true;
+          }
+        },
+    },
+    template: `
+    <div v-if="loading">
+      <strong>
+        Loading...
+      </strong>
+      <div class="spinner-border" aria-hidden="true"></div>
+    </div>
+    <div v-else-if="error">
+      <div class="alert alert-danger" role="alert">
+        Failed to fetch statistics.
+      </div>
+    </div>
+    <div class="row" v-else>
+      <div class="col-3">
+        <div class="list-group my-3">
+          <a href="javascript:void(0);" class="list-group-item list-group-item-action" v-for="p in players" @click="select(p.name)" v-bind:class="{ active: selected == p.name }">{{ p.name }}</a>
+        </div>
+      </div>
+      <div class="col" v-if="stats">
+        <h4 class="my-3">{{ stats.name }}</h4>
+        <table class="table mb-4">
+          <tbody>
+            <tr><th scope="row">Wins / Losses</th><td>{{ stats.wins }} / {{ stats.losses }}</td></tr>
+            <tr><th scope="row">Shots fired</th><td>{{ stats.shots_fired }}</td></tr>
+            <tr><th scope="row">Hit accuracy</th><td>{{ (stats.accuracy * 100).toFixed(1) }} %</td></tr>
+            <tr><th scope="row">Average turns to win</th><td>{{ stats.average_turns_to_win.toFixed(1) }}</td></tr>
+            <tr><th scope="row">Favourite weapon</th><td>{{ stats.favourite_weapon || "-" }}</td></tr>
+            <tr><th scope="row">Longest win streak</th><td>{{ stats.longest_win_streak }}</td></tr>
+            <tr><th scope="row">Ships lost</th><td><span class="me-3" v-for="(count, shipClass) in stats.ships_lost">{{ shipClass }}: {{ count }}</span></td></tr>
+          </tbody>
+        </table>
+        <h5>Match History</h5>
+        <div class="alert alert-secondary" role="alert" v-if="history.total == 0">
+          No games played yet.
+        </div>
+        <table class="table" v-else>
+          <thead>
+            <tr>
+              <th scope="col">Date</th>
+              <th scope="col">Opponents</th>
+              <th scope="col">Result</th>
+              <th scope="col">Turns</th>
+            </tr>
+          </thead>
+          <tbody>
+            <tr v-for="g in history.games">
+              <td>{{ new Date(g.date).toLocaleString() }}</td>
+              <td>{{ g.opponents.join(", ") }}</td>
+              <td>{{ g.won ? "Won" : "Lost" }}</td>
+              <td>{{ g.turns }}</td>
+            </tr>
+          </tbody>
+        </table>
+        <nav v-if="pages > 1">
+          <ul class="pagination">
+            <li class="page-item" v-for="page in pages" v-bind:class="{ active: page == history.page }">
+              <a class="page-link" href="javascript:void(0);" @click="fetchHistory(page)">{{ page }}</a>
+            </li>
+          </ul>
+        </nav>
+      </div>
+    </div>
+    `
+}
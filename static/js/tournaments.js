@@ -0,0 +1,106 @@
+export default {
+    created() {
+      this.fetchData()
+    },
+    data() {
+      return {
+        tournaments: new Object,
+        selected: null,
+        loading: false,
+        error: false,
+      }
+    },
+    methods: {
+        formatName(format) {
+          return ["Single Elimination", "Double Elimination", "Round Robin"][format];
+        },
+        async fetchData() {
+          this.error = false;
+          this.loading = true;
+          try {
+            const tournaments_response = await fetch("/api/v1/tournaments")
+            if (!tournaments_response.ok) {
+              this.error = true;
+            } else {
+              this.tournaments = await tournaments_response.json();
+            }
+          } catch (err) {
+            console.log("Failed to fetch tournaments " + err);
+            this.error = true;
+          }
+          this.loading = false;
+        },
+        async select(id) {
+          this.error = false;
+          try {
+            const tournament_response = await fetch("/api/v1/tournaments/" + id)
+            if (!tournament_response.ok) {
+              this.error = true;
+            } else {
+              this.selected = await tournament_response.json();
+            }
+          } catch (err) {
+            console.log("Failed to fetch tournament " + err);
+            this.error = true;
+          }
+        },
+    },
+    template: `
+    <div v-if="loading">
+      <strong>
+        Loading...
+      </strong>
+      <div class="spinner-border" aria-hidden="true"></div>
+    </div>
+    <div v-else-if="error">
+      <div class="alert alert-danger" role="alert">
+        Failed to fetch tournaments.
+      </div>
+    </div>
+    <div class="alert alert-secondary" role="alert" v-else-if="Object.keys(tournaments).length == 0">
+      No tournaments available at the moment.
+    </div>
+    <div class="row" v-else>
+      <div class="col-4">
+        <div class="list-group my-3">
+          <a href="javascript:void(0);" class="list-group-item list-group-item-action" v-for="t in tournaments" @click="select(t.id)" v-bind:class="{ active: selected && selected.id == t.id }">
+            <strong>{{ t.name }}</strong>
+            <small class="text-muted d-block">{{ formatName(t.format) }}, {{ t.participants.length }} / {{ t.max_participants }} players</small>
+          </a>
+        </div>
+      </div>
+      <div class="col" v-if="selected">
+        <h4 class="my-3">{{ selected.name }} <small class="text-muted" v-if="selected.winner">won by {{ selected.winner }}</small></h4>
+        <div class="d-flex flex-row overflow-auto">
+          <div class="card me-2" v-for="(round, index) in selected.rounds" :key="index">
+            <div class="card-body">
+              <h6 class="card-title">Round {{ index + 1 }}</h6>
+              <p class="card-text" v-for="match in round">
+                <span v-for="(p, i) in match.players"><span v-if="i > 0"> vs. </span><strong v-if="p == match.winner">{{ p }}</strong><span v-else>{{ p }}</span></span>
+                <small class="text-muted" v-if="match.players.length == 1"> (bye)</small>
+              </p>
+            </div>
+          </div>
+        </div>
+        <table class="table my-4">
+          <thead>
+            <tr>
+              <th scope="col">Seed</th>
+              <th scope="col">Name</th>
+              <th scope="col">Wins</th>
+              <th scope="col">Losses</th>
+            </tr>
+          </thead>
+          <tbody>
+            <tr v-for="s in selected.standings" v-bind:class="{ 'text-muted': s.eliminated }">
+              <td>{{ s.seed }}</td>
+              <th scope="row">{{ s.name }}</th>
+              <td>{{ s.wins }}</td>
+              <td>{{ s.losses }}</td>
+            </tr>
+          </tbody>
+        </table>
+      </div>
+    </div>
+    `
+}
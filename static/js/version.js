@@ -15,7 +15,7 @@ export default {
         async fetchData() {
           this.error = false;
           this.loading = true;
-          let url = `/version`;
+          let url = `/api/v1/version`;
           try {
             const version_response = await fetch(url)
             this.error = false;
@@ -0,0 +1,159 @@
+// Package store saves the players and games to a JSON snapshot file on
+// shutdown and restores them on startup. Boards aren't part of the snapshot,
+// so games which weren't finished are restored as aborted. The api tokens
+// and jwt sessions are saved as well, so logouts and revocations outlast a
+// restart. Tournaments aren't part of the snapshot, their games are restored
+// as aborted like any other unfinished game.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang_battleship/api"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version int            `json:"version"`
+	SavedAt time.Time      `json:"saved_at"`
+	Players []playerRecord `json:"players"`
+	Games   []game.Game    `json:"games"`
+	// Events holds the event logs of the games by game id, for replays.
+	Events map[string][]game.Event `json:"events,omitempty"`
+	// RevokedJWTs holds the expiry of the revoked jwts by jwt id.
+	RevokedJWTs map[string]int64 `json:"revoked_jwts,omitempty"`
+	// Sessions holds the expiry of the jwts issued by player and jwt id.
+	Sessions  map[string]map[string]int64 `json:"sessions,omitempty"`
+	APITokens []api.StoredAPIToken        `json:"api_tokens,omitempty"`
+}
+
+// playerRecord holds the fields of a player hidden from the API.
+type playerRecord struct {
+	Name             string               `json:"name"`
+	PasswordHash     string               `json:"password_hash"`
+	ID               uuid.UUID            `json:"id"`
+	RegistrationDate time.Time            `json:"registration_date"`
+	Wins             int                  `json:"wins"`
+	Losses           int                  `json:"losses"`
+	Profile          player.Profile       `json:"profile"`
+	Stats            player.Statistics    `json:"stats"`
+	TurnsToWin       int                  `json:"turns_to_win"`
+	History          []player.MatchRecord `json:"history"`
+	Moderator        bool                 `json:"moderator,omitempty"`
+	Friends          []string             `json:"friends,omitempty"`
+	FriendRequests   []string             `json:"friend_requests,omitempty"`
+}
+
+// Save writes all players, games and credentials to path. The snapshot is written to a
+// temporary file first, so a crash never leaves a truncated snapshot.
+func Save(path string) error {
+	s := snapshot{Version: snapshotVersion, SavedAt: time.Now().UTC(), Players: []playerRecord{}, Games: []game.Game{}, Events: map[string][]game.Event{}}
+	for _, p := range player.AllPlayersList {
+		s.Players = append(s.Players, playerRecord{
+			Name:             p.Name,
+			PasswordHash:     p.PasswordHash,
+			ID:               p.ID,
+			RegistrationDate: p.RegistrationDate,
+			Wins:             p.Wins,
+			Losses:           p.Losses,
+			Profile:          p.Profile,
+			Stats:            p.Stats,
+			TurnsToWin:       p.Stats.TurnsToWin,
+			History:          p.History,
+			Moderator:        p.Moderator,
+			Friends:          p.Friends,
+			FriendRequests:   p.FriendRequests,
+		})
+	}
+	for _, g := range game.All() {
+		g.Mutex().Lock()
+		s.Games = append(s.Games, *g)
+		s.Events[g.ID.String()] = g.Events(0)
+		g.Mutex().Unlock()
+	}
+	s.RevokedJWTs = api.JWTBlacklist.Snapshot()
+	s.Sessions = api.JWTSessions.Snapshot()
+	s.APITokens = api.APITokens.Snapshot()
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load restores the players, games and credentials of the snapshot at path. A missing
+// snapshot isn't an error, the server just starts empty.
+func Load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var s snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("failed to decode snapshot %s: %s", path, err)
+	}
+	if s.Version != snapshotVersion {
+		return fmt.Errorf("snapshot %s has unsupported version %d", path, s.Version)
+	}
+	for _, r := range s.Players {
+		if _, ok := player.AllPlayersMap[r.Name]; ok {
+			continue
+		}
+		p := &player.Player{
+			Name:             r.Name,
+			PasswordHash:     r.PasswordHash,
+			ID:               r.ID,
+			RegistrationDate: r.RegistrationDate,
+			Wins:             r.Wins,
+			Losses:           r.Losses,
+			Profile:          r.Profile,
+			Stats:            r.Stats,
+			History:          r.History,
+			Moderator:        r.Moderator,
+			Friends:          r.Friends,
+			FriendRequests:   r.FriendRequests,
+		}
+		p.Stats.TurnsToWin = r.TurnsToWin
+		player.AllPlayersMap[p.Name] = p
+		player.AllPlayersList = append(player.AllPlayersList, p)
+	}
+	sort.Sort(player.AllPlayersList)
+	for i := range s.Games {
+		g := s.Games[i]
+		if _, err := game.GetByUUID(g.ID.String()); err == nil {
+			continue
+		}
+		g.Abort()
+		g.RestoreEvents(s.Events[g.ID.String()])
+		game.AllGames = append(game.AllGames, &g)
+	}
+	api.JWTBlacklist.Restore(s.RevokedJWTs)
+	api.JWTSessions.Restore(s.Sessions)
+	api.APITokens.Restore(s.APITokens)
+	return nil
+}
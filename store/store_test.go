@@ -0,0 +1,83 @@
+package store
+
+import (
+	"golang_battleship/api"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveLoad(t *testing.T) {
+	p, _ := player.NewPlayer("Jotaro", "hash")
+	p.ScoreWin()
+	p.RecordShot("torpedo", true)
+	player.NewPlayer("Dio", "")
+	p.RequestFriendship("Dio")
+	running, _ := game.NewGame(12, 12, 2, "running", 2, "Jotaro", "Dio")
+	running.State = game.StateRunning
+	finished, _ := game.NewGame(12, 12, 2, "finished", 2, "Jotaro", "Dio")
+	finished.Say(*p, "ora ora")
+	finished.State = game.StateFinished
+	finished.Winner = "Jotaro"
+	p.Moderator = true
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := Save(path); err != nil {
+		t.Fatalf("failed to save state: %s", err)
+	}
+	player.AllPlayersMap = player.PlayerMap{}
+	player.AllPlayersList = player.PlayerList{}
+	game.AllGames = []*game.Game{}
+
+	if err := Load(path); err != nil {
+		t.Fatalf("failed to load state: %s", err)
+	}
+	restored, err := player.GetByName("Jotaro")
+	if err != nil || restored.PasswordHash != "hash" || restored.Wins != 1 || restored.Stats.ShotsFired != 1 || restored.ID != p.ID || !restored.Moderator {
+		t.Errorf("player not restored, got %+v, %v", restored, err)
+	}
+	if dio, _ := player.GetByName("Dio"); len(dio.FriendRequests) != 1 || dio.FriendRequests[0] != "Jotaro" {
+		t.Errorf("friend request not restored, got %+v", dio)
+	}
+	g, err := game.GetByUUID(finished.ID.String())
+	if err != nil || g.State != game.StateFinished || g.Winner != "Jotaro" || len(g.Participants) != 2 {
+		t.Errorf("finished game not restored, got %+v, %v", g, err)
+	}
+	if events := g.Events(0); len(events) != 3 || events[2].Text != "ora ora" {
+		t.Errorf("event log of finished game not restored, got %+v", events)
+	}
+	g, err = game.GetByUUID(running.ID.String())
+	if err != nil || g.State != game.StateAborted {
+		t.Errorf("expected running game to be restored as aborted, got %+v, %v", g, err)
+	}
+
+	if err := Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("missing snapshot should be ignored, got %s", err)
+	}
+}
+
+func TestSaveLoadCredentials(t *testing.T) {
+	player.NewPlayer("Polnareff", "")
+	token, secret, _ := api.APITokens.Create("Polnareff", "silver chariot", api.ScopePlay, 0)
+	expiry := time.Now().Add(time.Hour).Unix()
+	api.JWTBlacklist.Blacklist("revoked-jwt", expiry)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := Save(path); err != nil {
+		t.Fatalf("failed to save state: %s", err)
+	}
+	// a restart starts without tokens
+	api.APITokens.RevokeAll("Polnareff")
+
+	if err := Load(path); err != nil {
+		t.Fatalf("failed to load state: %s", err)
+	}
+	if name, err := api.AuthenticateBot(secret); err != nil || name != "Polnareff" {
+		t.Errorf("api token %s not restored, got %s, %v", token.ID, name, err)
+	}
+	if revoked := api.JWTBlacklist.Snapshot(); revoked["revoked-jwt"] != expiry {
+		t.Errorf("revoked jwt not restored, got %v", revoked)
+	}
+}
@@ -0,0 +1,542 @@
+package tournament
+
+import (
+	"fmt"
+	"golang_battleship/board"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type Format int
+
+type Seeding int
+
+type TournamentState int
+
+type Tournament struct {
+	ID              uuid.UUID             `json:"id"`
+	Name            string                `json:"name"`
+	Organizer       string                `json:"organizer"`
+	Format          Format                `json:"format"`
+	Seeding         Seeding               `json:"seeding"`
+	State           TournamentState       `json:"state"`
+	MaxParticipants int                   `json:"max_participants"`
+	BoardParameters board.BoardParameters `json:"board_parameters"`
+	CreationDate    time.Time             `json:"creation_date"`
+	Participants    []string              `json:"participants"`
+	Rounds          [][]*Match            `json:"rounds"`
+	Winner          string                `json:"winner,omitempty"`
+	schedule        [][][2]string
+	mu              *sync.Mutex
+}
+
+// Match is a pairing within a tournament round. A match with a single
+// player is a bye, its player advances without a game being played.
+type Match struct {
+	Players []string   `json:"players"`
+	GameID  *uuid.UUID `json:"game_id,omitempty"`
+	Winner  string     `json:"winner,omitempty"`
+	Loser   string     `json:"loser,omitempty"`
+}
+
+type Standing struct {
+	Name       string `json:"name"`
+	Seed       int    `json:"seed"`
+	Wins       int    `json:"wins"`
+	Losses     int    `json:"losses"`
+	Eliminated bool   `json:"eliminated"`
+}
+
+const (
+	SingleElimination Format = iota
+	DoubleElimination
+	RoundRobin
+)
+
+const (
+	SeedByWins Seeding = iota
+	SeedByRating
+)
+
+const (
+	StateRegistration TournamentState = iota
+	StateRunning
+	StateFinished
+)
+
+const (
+	MinParticipants        = 2
+	DefaultMaxParticipants = 16
+)
+
+const ValidTournamentIDRegex = game.ValidGameIDRegex
+
+var AllTournaments []*Tournament
+
+// registry guards the creation of tournaments against the lookups from
+// other goroutines, such as the hooks of finished games.
+var registry sync.RWMutex
+
+// lazyInit guards the lazy creation of tournament locks.
+var lazyInit sync.Mutex
+
+var FormatMap = map[string]Format{
+	"single-elimination": SingleElimination,
+	"double-elimination": DoubleElimination,
+	"round-robin":        RoundRobin,
+}
+
+var SeedingMap = map[string]Seeding{
+	"wins":   SeedByWins,
+	"rating": SeedByRating,
+}
+
+var TournamentStateMap = map[string]TournamentState{
+	"registration": StateRegistration,
+	"running":      StateRunning,
+	"finished":     StateFinished,
+}
+
+func init() {
+	game.OnFinish(gameFinished)
+	game.OnAbort(gameAborted)
+}
+
+func GetByUUID(uuid string) (*Tournament, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, t := range AllTournaments {
+		if t.ID.String() == uuid {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("no tournament found for uuid %s", uuid)
+}
+
+// List returns the registered tournaments.
+func List() []*Tournament {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]*Tournament{}, AllTournaments...)
+}
+
+// Mutex serializes the changes to t, the API handlers and the game hooks
+// hold it while acting on the tournament. The methods of Tournament don't
+// lock by themselves. Game locks are taken before it, as games report their
+// results while being locked.
+func (t *Tournament) Mutex() *sync.Mutex {
+	lazyInit.Lock()
+	defer lazyInit.Unlock()
+	if t.mu == nil {
+		t.mu = &sync.Mutex{}
+	}
+	return t.mu
+}
+
+// Snapshot returns a copy of t which shares neither participants nor
+// rounds with it, the caller has to hold the lock of t.
+func (t *Tournament) Snapshot() Tournament {
+	s := *t
+	s.Participants = append([]string{}, t.Participants...)
+	s.Rounds = make([][]*Match, len(t.Rounds))
+	for i, round := range t.Rounds {
+		s.Rounds[i] = []*Match{}
+		for _, m := range round {
+			c := *m
+			s.Rounds[i] = append(s.Rounds[i], &c)
+		}
+	}
+	return s
+}
+
+func NewTournament(name string, organizer string, format Format, seeding Seeding, maxparticipants int, bp board.BoardParameters) (*Tournament, error) {
+	if len(name) == 0 {
+		return nil, fmt.Errorf("tournament name must not be empty")
+	}
+	if format < SingleElimination || format > RoundRobin {
+		return nil, fmt.Errorf("unknown tournament format %d", format)
+	}
+	if seeding < SeedByWins || seeding > SeedByRating {
+		return nil, fmt.Errorf("unknown seeding %d", seeding)
+	}
+	if maxparticipants == 0 {
+		maxparticipants = DefaultMaxParticipants
+	}
+	if maxparticipants < MinParticipants {
+		return nil, fmt.Errorf("tournament needs room for at least %d participants, got %d", MinParticipants, maxparticipants)
+	}
+	if err := game.ValidateBoardParameters(bp); err != nil {
+		return nil, err
+	}
+	t := Tournament{
+		ID:              uuid.New(),
+		Name:            name,
+		Organizer:       organizer,
+		Format:          format,
+		Seeding:         seeding,
+		State:           StateRegistration,
+		MaxParticipants: maxparticipants,
+		BoardParameters: bp,
+		CreationDate:    time.Now(),
+		Participants:    []string{},
+		Rounds:          [][]*Match{},
+	}
+	registry.Lock()
+	AllTournaments = append(AllTournaments, &t)
+	registry.Unlock()
+	log.Info(fmt.Sprintf("Created new tournament %s (%s) with max. participants %d", t.ID, name, maxparticipants))
+	return &t, nil
+}
+
+func (t *Tournament) Register(playername string) error {
+	if t.State != StateRegistration {
+		return fmt.Errorf("registration for tournament %s is closed", t.ID)
+	}
+	if _, ok := player.Lookup(playername); !ok {
+		return fmt.Errorf("player name %s doesnt exist", playername)
+	}
+	if t.isParticipant(playername) {
+		return fmt.Errorf("player %s is already registered for tournament %s", playername, t.ID)
+	}
+	if len(t.Participants) >= t.MaxParticipants {
+		return fmt.Errorf("tournament %s has reached max participants (%d/%d)", t.ID, len(t.Participants), t.MaxParticipants)
+	}
+	t.Participants = append(t.Participants, playername)
+	return nil
+}
+
+func (t *Tournament) Withdraw(playername string) error {
+	if t.State != StateRegistration {
+		return fmt.Errorf("cannot withdraw from tournament %s after it has started", t.ID)
+	}
+	for i, p := range t.Participants {
+		if p == playername {
+			t.Participants = append(t.Participants[:i], t.Participants[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("player %s is not registered for tournament %s", playername, t.ID)
+}
+
+// Start closes the registration, seeds the participants and creates the games of the first round.
+func (t *Tournament) Start() error {
+	if t.State != StateRegistration {
+		return fmt.Errorf("tournament %s has already started", t.ID)
+	}
+	if len(t.Participants) < MinParticipants {
+		return fmt.Errorf("tournament %s needs at least %d participants to start (%d/%d)", t.ID, MinParticipants, len(t.Participants), t.MaxParticipants)
+	}
+	t.seed()
+	if t.Format == RoundRobin {
+		t.schedule = roundRobinSchedule(t.Participants)
+	}
+	t.State = StateRunning
+	log.Info(fmt.Sprintf("Started tournament %s with participants %v", t.ID, t.Participants))
+	return t.nextRound()
+}
+
+func (t Tournament) Standings() []Standing {
+	standings := []Standing{}
+	for i, p := range t.Participants {
+		s := Standing{Name: p, Seed: i + 1}
+		for _, round := range t.Rounds {
+			for _, m := range round {
+				if m.Winner == p && len(m.Loser) > 0 {
+					s.Wins += 1
+				} else if m.Loser == p {
+					s.Losses += 1
+				}
+			}
+		}
+		switch t.Format {
+		case SingleElimination:
+			s.Eliminated = s.Losses >= 1
+		case DoubleElimination:
+			s.Eliminated = s.Losses >= 2
+		}
+		standings = append(standings, s)
+	}
+	if t.State == StateRegistration {
+		return standings
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Name == t.Winner {
+			return true
+		}
+		if standings[j].Name == t.Winner {
+			return false
+		}
+		if standings[i].Eliminated != standings[j].Eliminated {
+			return !standings[i].Eliminated
+		}
+		if standings[i].Wins != standings[j].Wins {
+			return standings[i].Wins > standings[j].Wins
+		}
+		return standings[i].Losses < standings[j].Losses
+	})
+	return standings
+}
+
+func (t Tournament) isParticipant(playername string) bool {
+	for _, p := range t.Participants {
+		if p == playername {
+			return true
+		}
+	}
+	return false
+}
+
+// seed orders the participants from strongest to weakest, ties keep their registration order.
+func (t *Tournament) seed() {
+	stats := func(name string) (int, int) {
+		if p, err := player.GetByName(name); err == nil {
+			return p.Wins, p.Losses
+		}
+		return 0, 0
+	}
+	rating := func(wins, losses int) float64 {
+		if wins+losses == 0 {
+			return 0
+		}
+		return float64(wins) / float64(wins+losses)
+	}
+	sort.SliceStable(t.Participants, func(i, j int) bool {
+		wi, li := stats(t.Participants[i])
+		wj, lj := stats(t.Participants[j])
+		if t.Seeding == SeedByRating && rating(wi, li) != rating(wj, lj) {
+			return rating(wi, li) > rating(wj, lj)
+		}
+		if wi != wj {
+			return wi > wj
+		}
+		return li < lj
+	})
+}
+
+func (t *Tournament) currentRound() []*Match {
+	if len(t.Rounds) == 0 {
+		return nil
+	}
+	return t.Rounds[len(t.Rounds)-1]
+}
+
+func (t *Tournament) nextRound() error {
+	var pairings [][]string
+	switch t.Format {
+	case SingleElimination:
+		pairings = t.eliminationPairings(1)
+	case DoubleElimination:
+		pairings = t.eliminationPairings(2)
+	case RoundRobin:
+		pairings = t.roundRobinPairings()
+	}
+	if pairings == nil {
+		t.finish()
+		return nil
+	}
+	round := []*Match{}
+	for _, players := range pairings {
+		m := &Match{Players: players}
+		if len(players) == 1 {
+			m.Winner = players[0]
+		} else {
+			if err := t.startMatch(m, len(t.Rounds)+1); err != nil {
+				return err
+			}
+		}
+		round = append(round, m)
+	}
+	t.Rounds = append(t.Rounds, round)
+	if roundFinished(round) {
+		return t.nextRound()
+	}
+	return nil
+}
+
+// startMatch creates the locked game in which the players of m play their match.
+func (t *Tournament) startMatch(m *Match, round int) error {
+	description := fmt.Sprintf("%s, round %d: %s vs. %s", t.Name, round, m.Players[0], m.Players[1])
+	bp := t.BoardParameters
+	g, err := game.NewGame(bp.SizeX, bp.SizeY, bp.MaxShips, description, 2, m.Players...)
+	if err != nil {
+		return fmt.Errorf("failed to create game for tournament %s: %s", t.ID, err)
+	}
+	g.Locked = true
+	m.GameID = &g.ID
+	return nil
+}
+
+// eliminationPairings pairs the players which have lost fewer than maxLosses
+// games with players of the same loss count, strongest against weakest.
+// Odd players out get a bye. The last two players are paired regardless of
+// their losses, which makes up the grand final of a double elimination.
+func (t *Tournament) eliminationPairings(maxLosses int) [][]string {
+	losses := make(map[string]int)
+	for _, round := range t.Rounds {
+		for _, m := range round {
+			if len(m.Loser) > 0 {
+				losses[m.Loser] += 1
+			}
+		}
+	}
+	groups := make([][]string, maxLosses)
+	alive := 0
+	for _, p := range t.Participants {
+		if losses[p] < maxLosses {
+			groups[losses[p]] = append(groups[losses[p]], p)
+			alive++
+		}
+	}
+	if alive < 2 {
+		return nil
+	}
+	if alive == 2 {
+		final := []string{}
+		for _, group := range groups {
+			final = append(final, group...)
+		}
+		return [][]string{final}
+	}
+	pairings := [][]string{}
+	for _, group := range groups {
+		if len(group)%2 == 1 {
+			pairings = append(pairings, []string{group[0]})
+			group = group[1:]
+		}
+		for i := 0; i < len(group)/2; i++ {
+			pairings = append(pairings, []string{group[i], group[len(group)-1-i]})
+		}
+	}
+	return pairings
+}
+
+func (t *Tournament) roundRobinPairings() [][]string {
+	if len(t.Rounds) >= len(t.schedule) {
+		return nil
+	}
+	pairings := [][]string{}
+	for _, pair := range t.schedule[len(t.Rounds)] {
+		if len(pair[0]) > 0 && len(pair[1]) > 0 {
+			pairings = append(pairings, []string{pair[0], pair[1]})
+		}
+	}
+	return pairings
+}
+
+// roundRobinSchedule pairs every player with every other player once using the circle method.
+func roundRobinSchedule(players []string) [][][2]string {
+	circle := append([]string{}, players...)
+	if len(circle)%2 == 1 {
+		circle = append(circle, "")
+	}
+	n := len(circle)
+	schedule := [][][2]string{}
+	for r := 0; r < n-1; r++ {
+		round := [][2]string{}
+		for i := 0; i < n/2; i++ {
+			round = append(round, [2]string{circle[i], circle[n-1-i]})
+		}
+		schedule = append(schedule, round)
+		circle = append([]string{circle[0], circle[n-1]}, circle[1:n-1]...)
+	}
+	return schedule
+}
+
+func (t *Tournament) finish() {
+	t.State = StateFinished
+	switch t.Format {
+	case RoundRobin:
+		t.Winner = t.Standings()[0].Name
+	default:
+		for _, s := range t.Standings() {
+			if !s.Eliminated {
+				t.Winner = s.Name
+				break
+			}
+		}
+	}
+	log.Info(fmt.Sprintf("Tournament %s was won by %s", t.ID, t.Winner))
+}
+
+func roundFinished(round []*Match) bool {
+	for _, m := range round {
+		if len(m.Winner) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func gameFinished(g *game.Game) {
+	for _, t := range List() {
+		t.Mutex().Lock()
+		done := t.matchFinished(g)
+		t.Mutex().Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+// matchFinished records the result of the game g if it belongs to the
+// current round of t, it reports whether it did.
+func (t *Tournament) matchFinished(g *game.Game) bool {
+	if t.State != StateRunning {
+		return false
+	}
+	for _, m := range t.currentRound() {
+		if m.GameID == nil || *m.GameID != g.ID {
+			continue
+		}
+		m.Winner = g.Winner
+		for _, p := range m.Players {
+			if p != g.Winner {
+				m.Loser = p
+			}
+		}
+		if roundFinished(t.currentRound()) {
+			if err := t.nextRound(); err != nil {
+				log.Error(err)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gameAborted replays a match whose game was aborted or deleted before it
+// was decided, so the round doesn't stall.
+func gameAborted(g *game.Game) {
+	for _, t := range List() {
+		t.Mutex().Lock()
+		done := t.matchAborted(g)
+		t.Mutex().Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+// matchAborted replays the undecided match of t played in g, it reports
+// whether there was one.
+func (t *Tournament) matchAborted(g *game.Game) bool {
+	if t.State != StateRunning {
+		return false
+	}
+	for _, m := range t.currentRound() {
+		if m.GameID == nil || *m.GameID != g.ID || len(m.Winner) > 0 {
+			continue
+		}
+		if err := t.startMatch(m, len(t.Rounds)); err != nil {
+			log.Error(err)
+		}
+		return true
+	}
+	return false
+}
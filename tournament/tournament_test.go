@@ -0,0 +1,139 @@
+package tournament
+
+import (
+	"fmt"
+	"golang_battleship/board"
+	"golang_battleship/game"
+	"golang_battleship/player"
+	"sync"
+	"testing"
+)
+
+var testBoardParameters = board.BoardParameters{SizeX: 12, SizeY: 12, MaxShips: 5}
+
+// playRound lets the better seeded player win every open game of the current round.
+func playRound(t *testing.T, tm *Tournament) {
+	for _, m := range tm.currentRound() {
+		if m.GameID == nil || len(m.Winner) > 0 {
+			continue
+		}
+		g, err := game.GetByUUID(m.GameID.String())
+		if err != nil {
+			t.Fatalf("missing game for match %v: %s", m.Players, err)
+		}
+		if err := g.Finish(m.Players[0]); err != nil {
+			t.Fatalf("failed to finish game %s: %s", g.ID, err)
+		}
+	}
+}
+
+func newTestTournament(t *testing.T, format Format, prefix string, players int) *Tournament {
+	tm, err := NewTournament(prefix+" Cup", prefix+"0", format, SeedByWins, 0, testBoardParameters)
+	if err != nil {
+		t.Fatalf("failed to create tournament: %s", err)
+	}
+	for i := 0; i < players; i++ {
+		name := fmt.Sprintf("%s%d", prefix, i)
+		p, _ := player.NewPlayer(name, "")
+		for w := 0; w < players-i; w++ {
+			p.ScoreWin()
+		}
+		if err := tm.Register(name); err != nil {
+			t.Fatalf("failed to register %s: %s", name, err)
+		}
+	}
+	if err := tm.Start(); err != nil {
+		t.Fatalf("failed to start tournament: %s", err)
+	}
+	return tm
+}
+
+func TestSingleElimination(t *testing.T) {
+	tm := newTestTournament(t, SingleElimination, "Single", 5)
+	if tm.Participants[0] != "Single0" {
+		t.Errorf("expected Single0 to be seeded first, got %v", tm.Participants)
+	}
+	for i := 0; tm.State == StateRunning && i < 10; i++ {
+		playRound(t, tm)
+	}
+	if tm.State != StateFinished || tm.Winner != "Single0" {
+		t.Errorf("expected Single0 to win, got state %d and winner %s after %d rounds", tm.State, tm.Winner, len(tm.Rounds))
+	}
+	if len(tm.Rounds) != 3 {
+		t.Errorf("expected 3 rounds for 5 players, got %d", len(tm.Rounds))
+	}
+}
+
+func TestDoubleElimination(t *testing.T) {
+	tm := newTestTournament(t, DoubleElimination, "Double", 4)
+	for i := 0; tm.State == StateRunning && i < 20; i++ {
+		playRound(t, tm)
+	}
+	if tm.State != StateFinished || tm.Winner != "Double0" {
+		t.Errorf("expected Double0 to win, got state %d and winner %s", tm.State, tm.Winner)
+	}
+	for _, s := range tm.Standings() {
+		if s.Name != tm.Winner && s.Losses != 2 {
+			t.Errorf("expected %s to be eliminated with 2 losses, got %d", s.Name, s.Losses)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	tm := newTestTournament(t, RoundRobin, "Robin", 3)
+	for i := 0; tm.State == StateRunning && i < 10; i++ {
+		playRound(t, tm)
+	}
+	standings := tm.Standings()
+	for _, s := range standings {
+		if s.Wins+s.Losses != 2 {
+			t.Errorf("expected %s to play 2 games, got %d", s.Name, s.Wins+s.Losses)
+		}
+	}
+	if tm.Winner != standings[0].Name {
+		t.Errorf("expected winner %s to lead the standings, got %v", tm.Winner, standings)
+	}
+}
+
+func TestDeletedMatchIsReplayed(t *testing.T) {
+	tm := newTestTournament(t, SingleElimination, "Replay", 2)
+	m := tm.currentRound()[0]
+	deleted := *m.GameID
+	if err := game.DeleteByUUID(deleted.String()); err != nil {
+		t.Fatalf("failed to delete game %s: %s", deleted, err)
+	}
+	if m.GameID == nil || *m.GameID == deleted {
+		t.Fatalf("expected the match of %v to get a new game, got %v", m.Players, m.GameID)
+	}
+	playRound(t, tm)
+	if tm.State != StateFinished || tm.Winner != "Replay0" {
+		t.Errorf("expected Replay0 to win the replayed match, got state %d and winner %s", tm.State, tm.Winner)
+	}
+}
+
+func TestConcurrentlyFinishedRound(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		tm := newTestTournament(t, SingleElimination, fmt.Sprintf("Race%dx", i), 4)
+		var wg sync.WaitGroup
+		for _, m := range tm.currentRound() {
+			g, err := game.GetByUUID(m.GameID.String())
+			if err != nil {
+				t.Fatalf("missing game for match %v: %s", m.Players, err)
+			}
+			wg.Add(1)
+			go func(g *game.Game, winner string) {
+				defer wg.Done()
+				g.Mutex().Lock()
+				defer g.Mutex().Unlock()
+				g.Finish(winner)
+			}(g, m.Players[0])
+		}
+		wg.Wait()
+		tm.Mutex().Lock()
+		rounds := len(tm.Rounds)
+		tm.Mutex().Unlock()
+		if rounds != 2 {
+			t.Fatalf("expected 2 rounds after finishing the first one, got %d", rounds)
+		}
+	}
+}
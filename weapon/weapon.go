@@ -1,5 +1,10 @@
 package weapon
 
+import (
+	"fmt"
+	"sort"
+)
+
 type coordinate struct {
 	x, y int
 }
@@ -7,6 +12,7 @@ type coordinate struct {
 type Exploder interface {
 	Explode(coordinate) []coordinate
 	Symbol() rune
+	Name() string
 }
 
 type weapon struct {
@@ -22,10 +28,50 @@ type seaMine struct {
 	weapon
 }
 
+var weaponMap = map[string]Exploder{
+	"Torpedo": simpleTorpedo{weapon{"Torpedo", 'X'}},
+	"SeaMine": seaMine{weapon{"SeaMine", 'M'}},
+}
+
+const DefaultWeapon = "Torpedo"
+
+// Names returns the names of all weapons in alphabetical order.
+func Names() []string {
+	names := []string{}
+	for name := range weaponMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func NewCoordinate(x, y int) coordinate {
+	return coordinate{x, y}
+}
+
+func (coordinate coordinate) X() int {
+	return coordinate.x
+}
+
+func (coordinate coordinate) Y() int {
+	return coordinate.y
+}
+
+func GetByName(name string) (Exploder, error) {
+	if w, ok := weaponMap[name]; ok {
+		return w, nil
+	}
+	return nil, fmt.Errorf("no weapon with name %s available", name)
+}
+
 func (weapon weapon) Symbol() rune {
 	return weapon.symbol
 }
 
+func (weapon weapon) Name() string {
+	return weapon.name
+}
+
 func (s seaMine) Explode(c coordinate) []coordinate {
 	affectedCoordinates := []coordinate{}
 	affectedCoordinates = append(affectedCoordinates, c)